@@ -0,0 +1,49 @@
+package firewall
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// RequestInfo describes a request, e.g. from an access log, to be evaluated by DecideBatch
+type RequestInfo struct {
+	Method string
+	Path   string
+	Host   string
+	SrcIP  net.IP
+	// Header optionally carries request headers such as User-Agent
+	Header http.Header
+}
+
+/*DecideBatch evaluates a list of requests against the current rule set and returns
+* the decisions in the same order. Like Decide, requests are not counted towards
+* rate limits, so replaying historical traffic does not ban anyone
+ */
+func (fw *Firewall) DecideBatch(requests []RequestInfo) []Decision {
+	decisions := make([]Decision, len(requests))
+	for i, info := range requests {
+		decisions[i] = fw.decide(info.request(), false)
+	}
+	return decisions
+}
+
+// request builds the http.Request described by the RequestInfo
+func (info RequestInfo) request() *http.Request {
+	r := &http.Request{
+		Method: info.Method,
+		URL:    &url.URL{Path: info.Path},
+		Host:   info.Host,
+		Header: info.Header,
+	}
+	if r.Method == "" {
+		r.Method = http.MethodGet
+	}
+	if r.Header == nil {
+		r.Header = make(http.Header)
+	}
+	if info.SrcIP != nil {
+		r.RemoteAddr = net.JoinHostPort(info.SrcIP.String(), "0")
+	}
+	return r
+}
@@ -0,0 +1,84 @@
+package firewall
+
+import (
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDecideBatchMatchesDecide(t *testing.T) {
+	fw := New()
+	if err := fw.AddPathRule("/admin", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	opts := PathOptions{UserAgent: `^monitoring-agent/\d+`}
+	if err := fw.AddPathRuleWithOptions("/metrics", []string{"192.168.0.0/16"}, opts); err != nil {
+		t.Fatal(err)
+	}
+	requests := []RequestInfo{
+		{Method: http.MethodGet, Path: "/admin", SrcIP: net.ParseIP("10.1.2.3")},
+		{Method: http.MethodPost, Path: "/admin/users", SrcIP: net.ParseIP("198.51.100.1")},
+		{Path: "/metrics", SrcIP: net.ParseIP("192.168.1.1"), Header: http.Header{"User-Agent": {"monitoring-agent/2"}}},
+		{Path: "/metrics", SrcIP: net.ParseIP("192.168.1.1"), Header: http.Header{"User-Agent": {"curl/8.0"}}},
+		{Path: "/public", SrcIP: net.ParseIP("203.0.113.7")},
+	}
+	decisions := fw.DecideBatch(requests)
+	if len(decisions) != len(requests) {
+		t.Fatalf("got %d decisions for %d requests", len(decisions), len(requests))
+	}
+	for i, info := range requests {
+		method := info.Method
+		if method == "" {
+			method = http.MethodGet
+		}
+		r := newTestRequest(method, info.Path, info.SrcIP.String())
+		for name, values := range info.Header {
+			r.Header[name] = values
+		}
+		want := fw.Decide(r)
+		got := decisions[i]
+		if got.Allowed != want.Allowed || got.Reason != want.Reason || got.Rule != want.Rule || got.Path != want.Path || !got.SrcIP.Equal(want.SrcIP) {
+			t.Errorf("request %d: batch decided %+v, Decide decided %+v", i, got, want)
+		}
+	}
+}
+
+func TestDecideBatchIsNotRateLimited(t *testing.T) {
+	fw := New()
+	fw.RateLimit = 1
+	fw.BanDuration = time.Minute
+	if err := fw.AddPathRule("/", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	info := RequestInfo{Path: "/", SrcIP: net.ParseIP("10.1.2.3")}
+	for i, d := range fw.DecideBatch([]RequestInfo{info, info, info}) {
+		if d.Reason != ReasonTrusted {
+			t.Errorf("replayed request %d: got %s, want trusted", i, d.Reason)
+		}
+	}
+	if d := fw.Decide(newTestRequest(http.MethodGet, "/", "10.1.2.3")); d.Reason != ReasonTrusted {
+		t.Errorf("got %s after replaying traffic, want trusted", d.Reason)
+	}
+}
+
+func TestDecideHasNoSideEffects(t *testing.T) {
+	fw := New()
+	fw.RateLimit = 1
+	fw.BanDuration = time.Minute
+	if err := fw.AddPathRule("/", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if d := fw.Decide(newTestRequest(http.MethodGet, "/", "10.1.2.3")); d.Reason != ReasonTrusted {
+			t.Errorf("previewed request %d: got %s, want trusted", i, d.Reason)
+		}
+	}
+	if rate := fw.RequestRate(); rate != 0 {
+		t.Errorf("previewed requests counted towards the request rate: %g", rate)
+	}
+	// the source was neither rate limited nor banned by previewing its requests
+	if w := serveBlocked(fw, newTestRequest(http.MethodGet, "/", "10.1.2.3")); w.Code != http.StatusOK {
+		t.Errorf("got status %d serving a request after previewing others, want 200", w.Code)
+	}
+}
@@ -0,0 +1,92 @@
+package firewall
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serveBlocked serves a request through a wrapped handler and returns the response
+func serveBlocked(fw *Firewall, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	fw.Wrap(func(w http.ResponseWriter, r *http.Request) {}).ServeHTTP(w, r)
+	return w
+}
+
+func TestBlockStatusAndBody(t *testing.T) {
+	fw := New()
+	fw.BlockStatus = http.StatusNotFound
+	fw.BlockBody = "404 page not found"
+	fw.BlockPathTraversal = true
+	fw.Rules.DeniedNetblocks = []net.IPNet{mustParseCIDR(t, "203.0.113.0/24")}
+	if err := fw.AddPathRule("/admin", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	// protected, non-existent and denied paths must be indistinguishable
+	for _, r := range []*http.Request{
+		newTestRequest(http.MethodGet, "/admin", "198.51.100.1"),
+		newTestRequest(http.MethodGet, "/nothing", "198.51.100.1"),
+		newTestRequest(http.MethodGet, "/admin", "203.0.113.1"),
+	} {
+		w := serveBlocked(fw, r)
+		if w.Code != http.StatusNotFound || w.Body.String() != "404 page not found\n" {
+			t.Errorf("%s from %s: got %d %q, want the configured 404", r.URL.Path, r.RemoteAddr, w.Code, w.Body.String())
+		}
+	}
+	// blocks which are not access denials keep their own response
+	w := serveBlocked(fw, newTestRequest(http.MethodGet, "/admin/%2e%2e/x", "10.1.2.3"))
+	if w.Code != http.StatusBadRequest || w.Body.String() == "404 page not found\n" {
+		t.Errorf("path traversal: got %d %q, want a 400", w.Code, w.Body.String())
+	}
+	if w := serveBlocked(fw, newTestRequest(http.MethodGet, "/admin", "10.1.2.3")); w.Code != http.StatusOK {
+		t.Errorf("trusted request: got %d, want 200", w.Code)
+	}
+}
+
+func TestDefaultBlockResponse(t *testing.T) {
+	w := serveBlocked(New(), newTestRequest(http.MethodGet, "/admin", "198.51.100.1"))
+	if w.Code != http.StatusForbidden || w.Body.String() != "Forbidden\n" {
+		t.Errorf("got %d %q, want 403 Forbidden", w.Code, w.Body.String())
+	}
+}
+
+func TestBlockHeaders(t *testing.T) {
+	fw := New()
+	fw.BlockHeaders = http.Header{"X-Edge-Block": {"firewall"}}
+	fw.BlockReasonHeader = "X-Firewall-Block-Reason"
+	fw.Rules.DeniedNetblocks = []net.IPNet{mustParseCIDR(t, "203.0.113.0/24")}
+	if err := fw.AddPathRule("/admin", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	for src, reason := range map[string]string{"198.51.100.1": "untrusted", "203.0.113.1": "denied"} {
+		w := serveBlocked(fw, newTestRequest(http.MethodGet, "/admin", src))
+		if got := w.Header().Get("X-Edge-Block"); got != "firewall" {
+			t.Errorf("%s: got X-Edge-Block %q, want firewall", src, got)
+		}
+		if got := w.Header().Get("X-Firewall-Block-Reason"); got != reason {
+			t.Errorf("%s: got reason header %q, want %q", src, got, reason)
+		}
+	}
+	w := serveBlocked(fw, newTestRequest(http.MethodGet, "/admin", "10.1.2.3"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("trusted request: got %d, want 200", w.Code)
+	}
+	for _, name := range []string{"X-Edge-Block", "X-Firewall-Block-Reason"} {
+		if got := w.Header().Get(name); got != "" {
+			t.Errorf("allowed response carries %s: %q", name, got)
+		}
+	}
+}
+
+func TestNoBlockReasonByDefault(t *testing.T) {
+	w := serveBlocked(New(), newTestRequest(http.MethodGet, "/admin", "198.51.100.1"))
+	for name, values := range w.Header() {
+		for _, value := range values {
+			if strings.Contains(value, "no_rule") {
+				t.Errorf("blocked response discloses its reason in %s: %q", name, value)
+			}
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package firewall
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMaxBodyBytes(t *testing.T) {
+	fw := New()
+	if err := fw.AddPathRuleWithOptions("/upload", []string{"10.0.0.0/8"}, PathOptions{MaxBodyBytes: 16}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name          string
+		size          int
+		contentLength bool
+		status        int
+		readErr       bool
+	}{
+		{"within limit", 16, true, http.StatusOK, false},
+		{"over limit", 17, true, http.StatusRequestEntityTooLarge, false},
+		{"chunked within limit", 16, false, http.StatusOK, false},
+		{"chunked over limit", 17, false, http.StatusOK, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var readErr error
+			h := fw.Wrap(func(w http.ResponseWriter, r *http.Request) {
+				_, readErr = io.ReadAll(r.Body)
+			})
+			r := httptest.NewRequest(http.MethodPost, "/upload", bytes.NewReader(bytes.Repeat([]byte("a"), test.size)))
+			r.RemoteAddr = "10.1.2.3:1234"
+			if !test.contentLength {
+				r.ContentLength = -1
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != test.status {
+				t.Fatalf("got status %d, want %d", w.Code, test.status)
+			}
+			if (readErr != nil) != test.readErr {
+				t.Errorf("handler read error %v, want an error=%t", readErr, test.readErr)
+			}
+		})
+	}
+}
+
+func TestMaxBodyBytesAppliesToTrustedSources(t *testing.T) {
+	fw := New()
+	if err := fw.AddPathRuleWithOptions("/upload", []string{"10.0.0.0/8"}, PathOptions{MaxBodyBytes: 16}); err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/upload", bytes.NewReader(make([]byte, 17)))
+	r.RemoteAddr = "10.1.2.3:1234"
+	if d := fw.Decide(r); d.Reason != ReasonBodyTooLarge {
+		t.Errorf("got %s for a trusted source's oversized body, want body_too_large", d.Reason)
+	}
+	if d := fw.Decide(newTestRequest(http.MethodPost, "/other", "10.1.2.3")); d.Reason == ReasonBodyTooLarge {
+		t.Error("body limit applied to another path")
+	}
+}
@@ -0,0 +1,94 @@
+package firewall
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBreakerThreshold = 0.5
+	defaultBreakerWindow    = 10 * time.Second
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+/*CircuitBreaker narrows access to a path while its backend fails. Wrap feeds it
+* the status of every response to an allowed request for the path: once at least
+* MinRequests responses within Window have a 5xx share of Threshold or more, the
+* breaker opens, and for Cooldown only sources in StrictNetblocks are trusted by
+* the path's rule. It then closes and starts counting afresh. A breaker must be
+* attached to a single path, by pointer, see PathOptions.Breaker
+ */
+type CircuitBreaker struct {
+	// StrictNetblocks replace the path's trusted netblocks while the breaker is open
+	StrictNetblocks []net.IPNet
+	// Threshold is the share of 5xx responses, from 0 to 1, which opens the breaker, half by default
+	Threshold float64
+	// MinRequests is the number of responses within a window below which the breaker doesn't open
+	MinRequests int
+	// Window is how long responses are counted over, 10 seconds by default
+	Window time.Duration
+	// Cooldown is how long the breaker stays open, 30 seconds by default
+	Cooldown time.Duration
+
+	mu          sync.Mutex
+	windowStart time.Time
+	responses   int
+	failures    int
+	openUntil   time.Time
+}
+
+// IsOpen checks whether the breaker is open, i.e. the path is restricted to StrictNetblocks, at a time
+func (b *CircuitBreaker) IsOpen(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return now.Before(b.openUntil)
+}
+
+// record counts a response status at a time and reports whether it opened the breaker
+func (b *CircuitBreaker) record(status int, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if now.Before(b.openUntil) {
+		return false
+	}
+	window := b.Window
+	if window <= 0 {
+		window = defaultBreakerWindow
+	}
+	if now.Sub(b.windowStart) >= window {
+		b.windowStart, b.responses, b.failures = now, 0, 0
+	}
+	b.responses++
+	if status >= 500 {
+		b.failures++
+	}
+	threshold := b.Threshold
+	if threshold <= 0 {
+		threshold = defaultBreakerThreshold
+	}
+	if b.failures == 0 || b.responses < b.MinRequests || float64(b.failures) < threshold*float64(b.responses) {
+		return false
+	}
+	cooldown := b.Cooldown
+	if cooldown <= 0 {
+		cooldown = defaultBreakerCooldown
+	}
+	b.openUntil = now.Add(cooldown)
+	b.windowStart, b.responses, b.failures = time.Time{}, 0, 0
+	return true
+}
+
+// observeResponse feeds a response to an allowed request to the breaker of its rule, if any
+func (fw *Firewall) observeResponse(d Decision, status int) {
+	if d.breaker == nil || status == 0 {
+		return
+	}
+	if d.breaker.record(status, fw.now()) {
+		fw.mu.RLock()
+		fw.logf("circuit breaker for %s opened, restricting it to its strict netblocks", d.Rule)
+		fw.mu.RUnlock()
+	}
+}
@@ -0,0 +1,123 @@
+package firewall
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	fw := New()
+	fw.Now = func() time.Time { return now }
+	breaker := &CircuitBreaker{
+		StrictNetblocks: []net.IPNet{mustParseCIDR(t, "10.1.0.0/16")},
+		Threshold:       0.5,
+		MinRequests:     4,
+		Window:          10 * time.Second,
+		Cooldown:        time.Minute,
+	}
+	if err := fw.AddPathRuleWithOptions("/api", []string{"10.0.0.0/8"}, PathOptions{Breaker: breaker}); err != nil {
+		t.Fatal(err)
+	}
+	failing := false
+	h := fw.Wrap(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	})
+	serve := func(src string) int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, newTestRequest(http.MethodGet, "/api", src))
+		return w.Code
+	}
+
+	// a healthy backend keeps the breaker closed
+	for i := 0; i < 10; i++ {
+		serve("10.2.0.1")
+	}
+	if breaker.IsOpen(now) {
+		t.Fatal("breaker opened while the backend was healthy")
+	}
+
+	// failures below MinRequests within the window don't open it
+	now = now.Add(10 * time.Second)
+	failing = true
+	for i := 0; i < 3; i++ {
+		if status := serve("10.2.0.1"); status != http.StatusBadGateway {
+			t.Fatalf("got status %d from the failing backend, want 502", status)
+		}
+	}
+	if breaker.IsOpen(now) {
+		t.Fatal("breaker opened before MinRequests responses")
+	}
+	serve("10.2.0.1")
+	if !breaker.IsOpen(now) {
+		t.Fatal("breaker still closed after 4 failures out of 4 responses")
+	}
+
+	// while open, only the strict netblocks are trusted
+	failing = false
+	if status := serve("10.2.0.1"); status != http.StatusForbidden {
+		t.Errorf("got status %d for a source outside the strict netblocks, want 403", status)
+	}
+	if status := serve("10.1.0.1"); status != http.StatusOK {
+		t.Errorf("got status %d for a source in the strict netblocks, want 200", status)
+	}
+
+	// and once the cooldown is over access relaxes again
+	now = now.Add(time.Minute)
+	if breaker.IsOpen(now) {
+		t.Fatal("breaker still open after its cooldown")
+	}
+	if status := serve("10.2.0.1"); status != http.StatusOK {
+		t.Errorf("got status %d once the breaker closed, want 200", status)
+	}
+}
+
+func TestCircuitBreakerThreshold(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	b := &CircuitBreaker{Threshold: 0.5, MinRequests: 4}
+	// 3 failures out of 7 is below the threshold, and 4xx responses don't count as failures
+	for _, status := range []int{200, 200, 500, 200, 503, 404, 500} {
+		if b.record(status, now) {
+			t.Fatalf("breaker opened at %d", status)
+		}
+	}
+	if !b.record(500, now) {
+		t.Fatal("breaker didn't open at half of the responses failing")
+	}
+	if !b.IsOpen(now.Add(defaultBreakerCooldown-time.Second)) || b.IsOpen(now.Add(defaultBreakerCooldown)) {
+		t.Error("breaker not open for the default cooldown")
+	}
+
+	// responses in past windows are forgotten
+	now = now.Add(defaultBreakerCooldown)
+	for _, status := range []int{500, 500, 500} {
+		b.record(status, now)
+	}
+	now = now.Add(defaultBreakerWindow)
+	if b.record(500, now) {
+		t.Error("breaker opened counting responses from a previous window")
+	}
+}
+
+func TestCircuitBreakerDefaultThreshold(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	b := &CircuitBreaker{MinRequests: 2}
+	// healthy responses never open a breaker, whatever its settings
+	for i := 0; i < 10; i++ {
+		if b.record(http.StatusOK, now) {
+			t.Fatal("breaker without a Threshold opened on successful responses")
+		}
+	}
+	now = now.Add(defaultBreakerWindow)
+	if b.record(http.StatusOK, now) || b.record(http.StatusOK, now) || b.record(http.StatusInternalServerError, now) {
+		t.Fatal("breaker opened below the default threshold")
+	}
+	if !b.record(http.StatusInternalServerError, now) {
+		t.Error("breaker didn't open at the default threshold")
+	}
+}
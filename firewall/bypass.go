@@ -0,0 +1,36 @@
+package firewall
+
+import (
+	"fmt"
+	"time"
+)
+
+/*SetPathBypass allows all traffic to a path, regardless of its rule, until the given
+* deadline, after which the path's rule is enforced again. Deny lists still apply
+* while a bypass is active. A zero deadline removes the bypass
+ */
+func (fw *Firewall) SetPathBypass(path string, until time.Time) {
+	fw.mu.Lock()
+	if until.IsZero() {
+		delete(fw.bypasses, path)
+	} else {
+		if fw.bypasses == nil {
+			fw.bypasses = make(map[string]time.Time)
+		}
+		fw.bypasses[path] = until
+	}
+	detail := "bypass removed"
+	if !until.IsZero() {
+		detail = fmt.Sprintf("bypass enabled until %s", until.Format(time.RFC3339))
+	}
+	fw.logf("%s for %s", detail, path)
+	fw.mu.Unlock()
+
+	fw.ruleChanged(RuleChangeEvent{Action: RuleUpdated, Path: path, Detail: detail})
+}
+
+// bypassActive checks whether a path is bypassed as of now, expired bypasses are ignored
+func (fw *Firewall) bypassActive(path string, now time.Time) (time.Time, bool) {
+	until, ok := fw.bypasses[path]
+	return until, ok && now.Before(until)
+}
@@ -0,0 +1,70 @@
+package firewall
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetPathBypass(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	now := time.Unix(1700000000, 0)
+	fw := New()
+	fw.Log = true
+	fw.Now = func() time.Time { return now }
+	err := fw.LoadRules(strings.NewReader(`{"paths": {"/admin": {"allow": ["10.0.0.0/8"], "deny": ["203.0.113.0/24"]}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decide := func(path, src string) Decision {
+		return fw.Decide(newTestRequest(http.MethodGet, path, src))
+	}
+	if d := decide("/admin", "198.51.100.1"); d.Allowed {
+		t.Fatal("untrusted source allowed before the bypass")
+	}
+
+	fw.SetPathBypass("/admin", now.Add(time.Hour))
+	if d := decide("/admin", "198.51.100.1"); d.Reason != ReasonBypass {
+		t.Errorf("got %s during the bypass, want bypass", d.Reason)
+	}
+	if d := decide("/admin", "203.0.113.5"); d.Reason != ReasonDenied {
+		t.Errorf("got %s for a denied source during the bypass, want denied", d.Reason)
+	}
+	if d := decide("/other", "198.51.100.1"); d.Allowed {
+		t.Error("bypass applied to another path")
+	}
+	if !strings.Contains(buf.String(), "bypass active for /admin") {
+		t.Errorf("bypassed request was not logged: %q", buf.String())
+	}
+
+	now = now.Add(59 * time.Minute)
+	if d := decide("/admin", "198.51.100.1"); d.Reason != ReasonBypass {
+		t.Errorf("got %s before the bypass expired, want bypass", d.Reason)
+	}
+	now = now.Add(time.Minute)
+	if d := decide("/admin", "198.51.100.1"); d.Reason != ReasonUntrusted {
+		t.Errorf("got %s once the bypass expired, want untrusted", d.Reason)
+	}
+	if d := decide("/admin", "10.1.2.3"); d.Reason != ReasonTrusted {
+		t.Errorf("got %s for a trusted source once the bypass expired, want trusted", d.Reason)
+	}
+}
+
+func TestRemovePathBypass(t *testing.T) {
+	fw := New()
+	if err := fw.AddPathRule("/admin", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	fw.SetPathBypass("/admin", time.Now().Add(time.Hour))
+	fw.SetPathBypass("/admin", time.Time{})
+	if d := fw.Decide(newTestRequest(http.MethodGet, "/admin", "198.51.100.1")); d.Reason != ReasonUntrusted {
+		t.Errorf("got %s once the bypass was removed, want untrusted", d.Reason)
+	}
+}
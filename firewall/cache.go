@@ -0,0 +1,86 @@
+package firewall
+
+import (
+	"fmt"
+	"net"
+)
+
+// CacheKey is a path and source IP pair whose lookups WarmCache pre-populates
+type CacheKey struct {
+	Path string
+	IP   net.IP
+}
+
+/*WarmCache pre-populates the decision cache with the deny list and trusted
+* netblock lookups for known path and source IP pairs, e.g. replayed from an
+* access log, so that the first requests after a start don't all miss. Paths are
+* normalized as request paths are. It does nothing unless DecisionCacheSize is set
+ */
+func (fw *Firewall) WarmCache(entries []CacheKey) {
+	fw.mu.RLock()
+	defer fw.mu.RUnlock()
+
+	for _, entry := range entries {
+		if entry.IP == nil {
+			continue
+		}
+		path := fw.normalizePath(entry.Path)
+		fw.cachedDenied(path, entry.IP)
+		if rule, ok := fw.Rules.PathToNetblocks[path]; ok {
+			fw.cachedTrusted(path, rule, entry.IP)
+		}
+		if len(fw.Rules.DefaultNetblocks) > 0 {
+			fw.cachedTrusted(DefaultRule, fw.Rules.DefaultNetblocks, entry.IP)
+		}
+	}
+}
+
+// DecisionCacheStats returns the hit and miss counts of the decision cache, which are zero while it is disabled
+func (fw *Firewall) DecisionCacheStats() ResolverCacheStats {
+	fw.mu.RLock()
+	defer fw.mu.RUnlock()
+
+	if cache := fw.decisionCache(); cache != nil {
+		return cache.Stats()
+	}
+	return ResolverCacheStats{}
+}
+
+// decisionCache returns the firewall's decision cache, nil when DecisionCacheSize is not set
+func (fw *Firewall) decisionCache() *ResolverCache {
+	if fw.DecisionCacheSize <= 0 {
+		return nil
+	}
+	fw.cacheOnce.Do(func() {
+		fw.cache = NewResolverCache(0, fw.DecisionCacheSize, nil)
+	})
+	return fw.cache
+}
+
+// cachedDenied checks whether a source IP is denied on a path, the firewall's lock must be held
+func (fw *Firewall) cachedDenied(path string, src net.IP) bool {
+	return fw.cachedLookup("deny", path, src, func() bool { return fw.isDenied(path, src) })
+}
+
+// cachedTrusted checks whether a source IP is trusted by a rule's netblocks, the firewall's lock must be held
+func (fw *Firewall) cachedTrusted(rule string, netblocks []net.IPNet, src net.IP) bool {
+	return fw.cachedLookup("allow", rule, src, func() bool { return IPIsTrusted(netblocks, src) })
+}
+
+/*cachedLookup answers a lookup from the decision cache when it is enabled. Keys
+* carry the rule set's version, so lookups made against replaced rules are never
+* hit again and age out of the cache
+ */
+func (fw *Firewall) cachedLookup(kind, path string, src net.IP, lookup func() bool) bool {
+	cache := fw.decisionCache()
+	if cache == nil || src == nil {
+		return lookup()
+	}
+	key := fmt.Sprintf("%d|%s|%s|%s", fw.version, kind, src, path)
+	if matched, ok := cache.get(key); ok {
+		return matched
+	}
+	matched := lookup()
+	cache.put(key, matched)
+	return matched
+}
@@ -0,0 +1,62 @@
+package firewall
+
+import (
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestWarmCache(t *testing.T) {
+	fw := New()
+	fw.DecisionCacheSize = 100
+	if err := fw.AddPathRule("/admin", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	fw.WarmCache([]CacheKey{
+		{Path: "/admin", IP: net.ParseIP("10.1.2.3")},
+		{Path: "/admin", IP: net.ParseIP("198.51.100.1")},
+		// skipped
+		{Path: "/admin"},
+	})
+	// a deny list and a trusted netblocks lookup for each source
+	if stats := fw.DecisionCacheStats(); stats.Hits != 0 || stats.Misses != 4 || stats.Entries != 4 {
+		t.Fatalf("got stats %+v after warming, want 4 misses and entries", stats)
+	}
+
+	for src, reason := range map[string]Reason{"10.1.2.3": ReasonTrusted, "198.51.100.1": ReasonUntrusted} {
+		if d := fw.Decide(newTestRequest(http.MethodGet, "/admin", src)); d.Reason != reason {
+			t.Errorf("%s: got %s, want %s", src, d.Reason, reason)
+		}
+	}
+	if stats := fw.DecisionCacheStats(); stats.Hits != 4 || stats.Misses != 4 {
+		t.Errorf("got stats %+v, want the warmed lookups to be hit", stats)
+	}
+	// a source which wasn't warmed misses
+	fw.Decide(newTestRequest(http.MethodGet, "/admin", "10.4.5.6"))
+	if stats := fw.DecisionCacheStats(); stats.Hits != 4 || stats.Misses != 6 {
+		t.Errorf("got stats %+v, want a cold source to miss", stats)
+	}
+
+	// changing the rules invalidates warmed lookups
+	if err := fw.SetPathRule("/admin", []string{"198.51.100.0/24"}); err != nil {
+		t.Fatal(err)
+	}
+	if d := fw.Decide(newTestRequest(http.MethodGet, "/admin", "198.51.100.1")); d.Reason != ReasonTrusted {
+		t.Errorf("got %s once the rule changed, want trusted", d.Reason)
+	}
+	if stats := fw.DecisionCacheStats(); stats.Hits != 4 {
+		t.Errorf("got stats %+v, want no hits for lookups against the previous rules", stats)
+	}
+}
+
+func TestWarmCacheDisabled(t *testing.T) {
+	fw := New()
+	if err := fw.AddPathRule("/admin", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	fw.WarmCache([]CacheKey{{Path: "/admin", IP: net.ParseIP("10.1.2.3")}})
+	fw.Decide(newTestRequest(http.MethodGet, "/admin", "10.1.2.3"))
+	if stats := fw.DecisionCacheStats(); stats != (ResolverCacheStats{}) {
+		t.Errorf("got stats %+v without a decision cache, want none", stats)
+	}
+}
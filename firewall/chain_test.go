@@ -0,0 +1,74 @@
+package firewall
+
+import (
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestRequireTrustedChain(t *testing.T) {
+	for _, behindProxy := range []bool{false, true} {
+		fw := New()
+		if behindProxy {
+			fw.TrustedProxies = []net.IPNet{mustParseCIDR(t, "172.16.0.0/12")}
+		}
+		opts := PathOptions{RequireTrustedChain: true}
+		if err := fw.AddPathRuleWithOptions("/internal", []string{"10.0.0.0/8"}, opts); err != nil {
+			t.Fatal(err)
+		}
+		tests := []struct {
+			name      string
+			peer      string
+			forwarded string
+			allowed   bool
+		}{
+			{"trusted peer without chain", "10.0.0.1", "", true},
+			{"trusted chain and peer", "10.0.0.1", "10.1.1.1, 10.2.2.2", true},
+			{"untrusted origin", "10.0.0.1", "198.51.100.1, 10.2.2.2", false},
+			{"untrusted middle hop", "10.0.0.1", "10.1.1.1, 198.51.100.1, 10.2.2.2", false},
+			{"unparseable hop", "10.0.0.1", "10.1.1.1, unknown", false},
+			// the client resolved through a trusted proxy is trusted, but the proxy isn't
+			{"untrusted peer", "172.16.0.1", "10.1.1.1", false},
+			{"untrusted peer without chain", "198.51.100.1", "", false},
+		}
+		for _, test := range tests {
+			r := newTestRequest(http.MethodGet, "/internal", test.peer)
+			if test.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", test.forwarded)
+			}
+			if d := fw.Decide(r); d.Allowed != test.allowed {
+				t.Errorf("%s, behind proxy %t: got %s, want allowed=%t", test.name, behindProxy, d.Reason, test.allowed)
+			}
+		}
+	}
+}
+
+func TestAnyAndAllIPsTrusted(t *testing.T) {
+	trusted := []net.IPNet{mustParseCIDR(t, "10.0.0.0/8"), mustParseCIDR(t, "2001:db8::/32")}
+	ips := func(addrs ...string) []net.IP {
+		var parsed []net.IP
+		for _, addr := range addrs {
+			parsed = append(parsed, net.ParseIP(addr))
+		}
+		return parsed
+	}
+	tests := []struct {
+		name     string
+		chain    []net.IP
+		any, all bool
+	}{
+		{"all trusted", ips("10.1.1.1", "2001:db8::1"), true, true},
+		{"mixed", ips("198.51.100.1", "10.1.1.1"), true, false},
+		{"none trusted", ips("198.51.100.1", "203.0.113.1"), false, false},
+		{"unparseable entry", ips("10.1.1.1", "garbage"), true, false},
+		{"empty", nil, false, false},
+	}
+	for _, test := range tests {
+		if got := AnyIPTrusted(trusted, test.chain); got != test.any {
+			t.Errorf("%s: AnyIPTrusted got %t, want %t", test.name, got, test.any)
+		}
+		if got := AllIPsTrusted(trusted, test.chain); got != test.all {
+			t.Errorf("%s: AllIPsTrusted got %t, want %t", test.name, got, test.all)
+		}
+	}
+}
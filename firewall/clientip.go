@@ -0,0 +1,81 @@
+package firewall
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+/*ClientIP returns the IP of the client which made a request, as the firewall
+* resolves it for its decisions. When the request's peer is one of the firewall's
+* TrustedProxies, the X-Forwarded-For header (or, without one, the Forwarded
+* header) is walked from the closest hop back, skipping trusted proxies, and the
+* first untrusted hop is the client. At most MaxProxyHops forwarded hops are
+* walked when it is set, and a client still hidden behind a trusted proxy once
+* they are is nil, which no rule trusts. A hop which can't be parsed is never
+* skipped, and makes the client nil too. Otherwise the client is the peer in
+* RemoteAddr
+ */
+func (fw *Firewall) ClientIP(r *http.Request) net.IP {
+	fw.mu.RLock()
+	defer fw.mu.RUnlock()
+
+	return fw.clientIP(r)
+}
+
+func (fw *Firewall) clientIP(r *http.Request) net.IP {
+	client := remoteIP(r)
+	if !IPIsTrusted(fw.TrustedProxies, client) {
+		return client
+	}
+	chain := ForwardedChain(r)
+	if len(chain) == 0 {
+		chain = forwardedFor(r)
+	}
+	for i, hops := len(chain)-1, 0; i >= 0; i, hops = i-1, hops+1 {
+		if fw.MaxProxyHops > 0 && hops >= fw.MaxProxyHops {
+			if IPIsTrusted(fw.TrustedProxies, client) {
+				// the client is further away than the hops walked, so it is unknown
+				return nil
+			}
+			break
+		}
+		if chain[i] == nil {
+			// never skip past a hop which can't be parsed, nor fall back to the proxy
+			return nil
+		}
+		client = chain[i]
+		if !IPIsTrusted(fw.TrustedProxies, client) {
+			break
+		}
+	}
+	return client
+}
+
+/*forwardedFor returns the IPs in the "for" parameters of a request's RFC 7239
+* Forwarded headers, in order from the original client to the last proxy. Entries
+* which are not IPs, such as obfuscated identifiers, are returned as nil
+ */
+func forwardedFor(r *http.Request) []net.IP {
+	var chain []net.IP
+	for _, header := range r.Header.Values("Forwarded") {
+		for _, element := range strings.Split(header, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok || !strings.EqualFold(key, "for") {
+					continue
+				}
+				chain = append(chain, parseForwardedNode(strings.Trim(value, `"`)))
+			}
+		}
+	}
+	return chain
+}
+
+// parseForwardedNode parses the IP of a Forwarded node such as "192.0.2.1:4711" or "[2001:db8::1]"
+func parseForwardedNode(node string) net.IP {
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		node = host
+	}
+	return net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(node, "["), "]"))
+}
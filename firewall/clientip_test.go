@@ -0,0 +1,95 @@
+package firewall
+
+import (
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	fw := New()
+	fw.TrustedProxies = []net.IPNet{mustParseCIDR(t, "10.0.0.0/8")}
+	tests := []struct {
+		name      string
+		peer      string
+		forwarded string
+		header    string
+		want      string
+	}{
+		{"untrusted peer", "198.51.100.1", "203.0.113.1", "X-Forwarded-For", "198.51.100.1"},
+		{"trusted peer without header", "10.0.0.1", "", "X-Forwarded-For", "10.0.0.1"},
+		{"closest untrusted hop", "10.0.0.1", "203.0.113.1, 198.51.100.1, 10.0.0.2", "X-Forwarded-For", "198.51.100.1"},
+		{"hop with port", "10.0.0.1", "203.0.113.1:4711", "X-Forwarded-For", "203.0.113.1"},
+		{"IPv6 hop with port", "10.0.0.1", "[2001:db8::1]:4711", "X-Forwarded-For", "2001:db8::1"},
+		{"unparseable closest hop", "10.0.0.1", "203.0.113.1, unknown", "X-Forwarded-For", ""},
+		{"unparseable hop behind a trusted one", "10.0.0.1", "garbage, 10.0.0.2", "X-Forwarded-For", ""},
+		{"unparseable hop beyond the client", "10.0.0.1", "garbage, 198.51.100.1", "X-Forwarded-For", "198.51.100.1"},
+		{"forwarded header", "10.0.0.1", `for=203.0.113.1, for="[2001:db8::1]:4711"`, "Forwarded", "2001:db8::1"},
+		{"obfuscated forwarded node", "10.0.0.1", "for=_hidden", "Forwarded", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := newTestRequest(http.MethodGet, "/", test.peer)
+			if test.forwarded != "" {
+				r.Header.Set(test.header, test.forwarded)
+			}
+			got := fw.ClientIP(r)
+			if (test.want == "" && got != nil) || (test.want != "" && !got.Equal(net.ParseIP(test.want))) {
+				t.Errorf("got %v, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestUnparseableHopIsNotTrusted(t *testing.T) {
+	fw := New()
+	fw.TrustedProxies = []net.IPNet{mustParseCIDR(t, "10.0.0.0/8")}
+	if err := fw.AddPathRule("/internal", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	r := newTestRequest(http.MethodGet, "/internal", "10.0.0.1")
+	r.Header.Set("X-Forwarded-For", "not-an-ip")
+	if d := fw.Decide(r); d.Allowed {
+		t.Error("request with an unparseable forwarded hop allowed as the trusted proxy")
+	}
+}
+
+func TestMaxProxyHops(t *testing.T) {
+	fw := New()
+	fw.TrustedProxies = []net.IPNet{mustParseCIDR(t, "10.0.0.0/8")}
+	tests := []struct {
+		name      string
+		hops      int
+		forwarded string
+		want      string
+	}{
+		{"client within the limit", 1, "203.0.113.1, 198.51.100.7", "198.51.100.7"},
+		{"client at the limit", 2, "203.0.113.1, 198.51.100.7, 10.0.0.2", "198.51.100.7"},
+		// the proxy is never returned in place of a client beyond the limit
+		{"client beyond the limit", 1, "198.51.100.7, 10.0.0.2", ""},
+		{"client beyond the limit of several proxies", 2, "198.51.100.7, 10.0.0.3, 10.0.0.2", ""},
+		{"no limit", 0, "198.51.100.7, 10.0.0.3, 10.0.0.2", "198.51.100.7"},
+		{"only proxies within the limit", 3, "10.0.0.3, 10.0.0.2", "10.0.0.3"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fw.MaxProxyHops = test.hops
+			r := newTestRequest(http.MethodGet, "/", "10.0.0.1")
+			r.Header.Set("X-Forwarded-For", test.forwarded)
+			got := fw.ClientIP(r)
+			if (test.want == "" && got != nil) || (test.want != "" && !got.Equal(net.ParseIP(test.want))) {
+				t.Errorf("got %v, want %q", got, test.want)
+			}
+		})
+	}
+
+	fw.MaxProxyHops = 1
+	if err := fw.AddPathRule("/internal", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	r := newTestRequest(http.MethodGet, "/internal", "10.0.0.1")
+	r.Header.Set("X-Forwarded-For", "198.51.100.7, 10.0.0.2")
+	if d := fw.Decide(r); d.Allowed {
+		t.Error("client beyond MaxProxyHops allowed as the trusted proxy in front of it")
+	}
+}
@@ -0,0 +1,27 @@
+package firewall
+
+/*acquire takes one of the max in-flight slots for a rule without blocking, returning
+* a function which releases it, or false when all slots are taken. Slots are per
+* rule rather than per path, so that the default rule's are shared by every path it
+* evaluates, and requests for arbitrary paths don't each add a semaphore
+ */
+func (fw *Firewall) acquire(rule string, max int) (func(), bool) {
+	fw.semaphoresMu.Lock()
+	if fw.semaphores == nil {
+		fw.semaphores = make(map[string]chan struct{})
+	}
+	sem, ok := fw.semaphores[rule]
+	if !ok || cap(sem) != max {
+		// in-flight requests release the slots of the semaphore they acquired
+		sem = make(chan struct{}, max)
+		fw.semaphores[rule] = sem
+	}
+	fw.semaphoresMu.Unlock()
+
+	select {
+	case sem <- struct{}{}:
+		return func() { <-sem }, true
+	default:
+		return nil, false
+	}
+}
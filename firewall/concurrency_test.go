@@ -0,0 +1,96 @@
+package firewall
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// blockingHandler returns a handler which blocks until released, signalling each request it starts serving
+func blockingHandler(started chan<- struct{}, release <-chan struct{}) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}
+}
+
+// serve serves a request from a trusted source in the background, returning the channel its status is sent on
+func serve(h http.Handler, path string) <-chan int {
+	status := make(chan int, 1)
+	go func() {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, newTestRequest(http.MethodGet, path, "10.1.2.3"))
+		status <- w.Code
+	}()
+	return status
+}
+
+func TestMaxConcurrent(t *testing.T) {
+	fw := New()
+	if err := fw.AddPathRuleWithOptions("/slow", []string{"10.0.0.0/8"}, PathOptions{MaxConcurrent: 2}); err != nil {
+		t.Fatal(err)
+	}
+	started, release := make(chan struct{}), make(chan struct{})
+	h := fw.Wrap(blockingHandler(started, release))
+
+	statuses := []<-chan int{serve(h, "/slow"), serve(h, "/slow")}
+	<-started
+	<-started
+	if status := <-serve(h, "/slow"); status != http.StatusServiceUnavailable {
+		t.Errorf("got %d with every slot taken, want 503", status)
+	}
+	// releases one of the requests being served, freeing a slot
+	release <- struct{}{}
+	select {
+	case status := <-statuses[0]:
+		statuses[0] = statuses[1]
+		if status != http.StatusOK {
+			t.Errorf("got %d, want 200", status)
+		}
+	case status := <-statuses[1]:
+		if status != http.StatusOK {
+			t.Errorf("got %d, want 200", status)
+		}
+	}
+
+	statuses[1] = serve(h, "/slow")
+	<-started
+	close(release)
+	for _, status := range statuses {
+		if status := <-status; status != http.StatusOK {
+			t.Errorf("got %d once a slot was released, want 200", status)
+		}
+	}
+}
+
+func TestMaxConcurrentOnDefaultRuleIsShared(t *testing.T) {
+	fw := New()
+	rules := fw.GetRules()
+	rules.DefaultNetblocks = []net.IPNet{mustParseCIDR(t, "10.0.0.0/8")}
+	rules.DefaultOptions = PathOptions{MaxConcurrent: 1}
+	if err := fw.ReplaceRules(rules); err != nil {
+		t.Fatal(err)
+	}
+	started, release := make(chan struct{}, 128), make(chan struct{})
+	h := fw.Wrap(blockingHandler(started, release))
+
+	first := serve(h, "/a")
+	<-started
+	if status := <-serve(h, "/b"); status != http.StatusServiceUnavailable {
+		t.Errorf("got %d for another path of the default rule, want 503", status)
+	}
+	close(release)
+	if status := <-first; status != http.StatusOK {
+		t.Errorf("got %d, want 200", status)
+	}
+	for i := 0; i < 100; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), newTestRequest(http.MethodGet, fmt.Sprintf("/path%d", i), "10.1.2.3"))
+	}
+	fw.semaphoresMu.Lock()
+	defer fw.semaphoresMu.Unlock()
+	if len(fw.semaphores) != 1 {
+		t.Errorf("got %d semaphores for the default rule, want 1", len(fw.semaphores))
+	}
+}
@@ -0,0 +1,113 @@
+package firewall
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// ConditionInput is what conditions are evaluated against
+type ConditionInput struct {
+	Request *http.Request
+	// SrcIP is the client's IP, see ClientIP
+	SrcIP net.IP
+	// Now is the current time according to the firewall's clock
+	Now time.Time
+}
+
+/*Condition is a node of a rule tree, see AddPathCondition. Leaves match a single
+* property of a request, such as IPIn or Header, and are combined with All, Any
+* and Not, e.g.
+*	All(Any(officeIPs, vpnIPs), Header("X-Team", "infra"))
+ */
+type Condition interface {
+	// Match checks whether a request satisfies the condition
+	Match(in ConditionInput) bool
+}
+
+// ConditionFunc adapts a function to the Condition interface
+type ConditionFunc func(in ConditionInput) bool
+
+// Match calls the function
+func (f ConditionFunc) Match(in ConditionInput) bool {
+	return f(in)
+}
+
+// IPIn matches requests whose source IP is part of any of the given network CIDRs
+func IPIn(networks ...string) (Condition, error) {
+	netblocks, err := parseCIDRs(networks)
+	if err != nil {
+		return nil, err
+	}
+	return ConditionFunc(func(in ConditionInput) bool {
+		return IPIsTrusted(netblocks, in.SrcIP)
+	}), nil
+}
+
+// Header matches requests with the given header, with the given value unless it is empty
+func Header(name, value string) Condition {
+	return ConditionFunc(func(in ConditionInput) bool {
+		values := in.Request.Header.Values(name)
+		if value == "" {
+			return len(values) > 0
+		}
+		return containsString(values, value)
+	})
+}
+
+// Method matches requests with one of the given methods
+func Method(methods ...string) Condition {
+	opts := PathOptions{Methods: methods}
+	return ConditionFunc(func(in ConditionInput) bool {
+		return opts.appliesTo(in.Request.Method)
+	})
+}
+
+// Between matches requests made from start until end, either of which may be zero to leave that side unbounded
+func Between(start, end time.Time) Condition {
+	return ConditionFunc(func(in ConditionInput) bool {
+		return (start.IsZero() || !in.Now.Before(start)) && (end.IsZero() || in.Now.Before(end))
+	})
+}
+
+// All matches requests which satisfy every one of the given conditions
+func All(conditions ...Condition) Condition {
+	return ConditionFunc(func(in ConditionInput) bool {
+		for _, c := range conditions {
+			if !c.Match(in) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// Any matches requests which satisfy at least one of the given conditions
+func Any(conditions ...Condition) Condition {
+	return ConditionFunc(func(in ConditionInput) bool {
+		for _, c := range conditions {
+			if c.Match(in) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Not matches requests which do not satisfy the given condition
+func Not(condition Condition) Condition {
+	return ConditionFunc(func(in ConditionInput) bool {
+		return !condition.Match(in)
+	})
+}
+
+/*AddPathCondition adds a rule which trusts the requests to a path satisfying
+* a rule tree, rather than a list of netblocks. AddPathRule(path, networks) is
+* equivalent to adding the condition IPIn(networks...), other than the netblocks
+* being listed by Info, exported and diffed. Conditions are not part of the JSON
+* configuration
+ */
+func (fw *Firewall) AddPathCondition(path string, condition Condition, opts PathOptions) error {
+	opts.Condition = condition
+	return fw.AddPathRuleWithOptions(path, nil, opts)
+}
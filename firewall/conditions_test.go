@@ -0,0 +1,109 @@
+package firewall
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func mustIPIn(t *testing.T, networks ...string) Condition {
+	t.Helper()
+	condition, err := IPIn(networks...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return condition
+}
+
+func TestConditionTree(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	fw := New()
+	fw.Now = func() time.Time { return now }
+	// (office OR vpn) AND team header AND NOT (DELETE outside the change window)
+	tree := All(
+		Any(mustIPIn(t, "10.0.0.0/8"), mustIPIn(t, "172.16.0.0/12")),
+		Header("X-Team", "infra"),
+		Not(All(Method(http.MethodDelete), Not(Between(now.Add(time.Hour), now.Add(2*time.Hour))))),
+	)
+	if err := fw.AddPathCondition("/deploy", tree, PathOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, method, src, team string
+		later, allowed          bool
+	}{
+		{"office", http.MethodPost, "10.1.2.3", "infra", false, true},
+		{"vpn", http.MethodPost, "172.16.0.1", "infra", false, true},
+		{"other network", http.MethodPost, "198.51.100.1", "infra", false, false},
+		{"other team", http.MethodPost, "10.1.2.3", "web", false, false},
+		{"no team", http.MethodPost, "10.1.2.3", "", false, false},
+		{"delete outside the window", http.MethodDelete, "10.1.2.3", "infra", false, false},
+		{"delete within the window", http.MethodDelete, "10.1.2.3", "infra", true, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.later {
+				defer func(at time.Time) { now = at }(now)
+				now = now.Add(90 * time.Minute)
+			}
+			r := newTestRequest(test.method, "/deploy", test.src)
+			if test.team != "" {
+				r.Header.Set("X-Team", test.team)
+			}
+			d := fw.Decide(r)
+			if d.Allowed != test.allowed {
+				t.Errorf("got %s, want allowed=%t", d.Reason, test.allowed)
+			}
+		})
+	}
+}
+
+func TestConditionLeaves(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	r := newTestRequest(http.MethodGet, "/", "10.1.2.3")
+	r.Header.Add("X-Roles", "reader")
+	r.Header.Add("X-Roles", "admin")
+	in := ConditionInput{Request: r, SrcIP: remoteIP(r), Now: now}
+	tests := []struct {
+		name      string
+		condition Condition
+		match     bool
+	}{
+		{"IP in", mustIPIn(t, "10.0.0.0/8"), true},
+		{"IP not in", mustIPIn(t, "192.168.0.0/16"), false},
+		{"header present", Header("X-Roles", ""), true},
+		{"header absent", Header("X-Other", ""), false},
+		{"any header value", Header("X-Roles", "admin"), true},
+		{"header value", Header("X-Roles", "owner"), false},
+		{"method", Method("post", "get"), true},
+		{"other method", Method(http.MethodPost), false},
+		{"since", Between(now, time.Time{}), true},
+		{"until", Between(time.Time{}, now), false},
+		{"empty All", All(), true},
+		{"empty Any", Any(), false},
+	}
+	for _, test := range tests {
+		if got := test.condition.Match(in); got != test.match {
+			t.Errorf("%s: got %t, want %t", test.name, got, test.match)
+		}
+	}
+	if _, err := IPIn("not a cidr"); err == nil {
+		t.Error("got a condition for an invalid network")
+	}
+}
+
+func TestPathRuleMatchesIPCondition(t *testing.T) {
+	rule, condition := New(), New()
+	if err := rule.AddPathRule("/admin", []string{"10.0.0.0/8", "2001:db8::/32"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := condition.AddPathCondition("/admin", mustIPIn(t, "10.0.0.0/8", "2001:db8::/32"), PathOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, src := range []string{"10.1.2.3", "2001:db8::1", "198.51.100.1", "2001:db9::1"} {
+		want := rule.Decide(newTestRequest(http.MethodGet, "/admin", src))
+		if got := condition.Decide(newTestRequest(http.MethodGet, "/admin", src)); got.Reason != want.Reason {
+			t.Errorf("%s: got %s by condition, %s by the path rule", src, got.Reason, want.Reason)
+		}
+	}
+}
@@ -0,0 +1,355 @@
+package firewall
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ConfigVersion is the version of the Config schema written by Export
+const ConfigVersion = 1
+
+// ErrUnsupportedConfigVersion will be returned when importing a Config of an unknown version
+var ErrUnsupportedConfigVersion = errors.New("unsupported config version")
+
+/*Config is a versioned snapshot of all the configurable state of a firewall: its
+* rules, grants, bypasses, netblock groups along with the rules referencing them,
+* and settings. Settings which are code, such as hooks and stores, are not part of
+* it and are left untouched by Import. Neither are the PathOptions which are code
+* or secrets, such as a Resolver or a SignatureSecret: they are listed by name in
+* each rule's CodeOptions, and Import keeps them from the current rule for the
+* same path, failing when one is missing. The other state left out, and untouched
+* by Import, is MaxRules, the DecisionSecret, the tiers loaded by LoadRulesLayer,
+* the sources learned in learning mode and counters such as metrics
+ */
+type Config struct {
+	Version int `json:"version"`
+	RulesConfig
+	Grants                    map[string][]GrantConfig `json:"grants,omitempty"`
+	Bypasses                  map[string]time.Time     `json:"bypasses,omitempty"`
+	Log                       bool                     `json:"log"`
+	AllowedLogSampleRate      float64                  `json:"allowed_log_sample_rate,omitempty"`
+	LogFormat                 LogFormat                `json:"log_format,omitempty"`
+	BlockPathTraversal        bool                     `json:"block_path_traversal"`
+	CollapseSlashes           bool                     `json:"collapse_slashes"`
+	ResolveDotSegments        bool                     `json:"resolve_dot_segments"`
+	BlockStatus               int                      `json:"block_status,omitempty"`
+	BlockBody                 string                   `json:"block_body,omitempty"`
+	ReasonStatus              map[Reason]int           `json:"reason_status,omitempty"`
+	ProblemJSON               bool                     `json:"problem_json"`
+	ProblemDetailIncludesPath bool                     `json:"problem_detail_includes_path"`
+	BlockHeaders              http.Header              `json:"block_headers,omitempty"`
+	BlockReasonHeader         string                   `json:"block_reason_header,omitempty"`
+	Listener                  string                   `json:"listener,omitempty"`
+	RejectSpoofedSources      bool                     `json:"reject_spoofed_sources"`
+	PublicListeners           []string                 `json:"public_listeners,omitempty"`
+	AllowPreflight            bool                     `json:"allow_preflight"`
+	RequireTLS                bool                     `json:"require_tls"`
+	TrustedProxies            []string                 `json:"trusted_proxies,omitempty"`
+	MaxProxyHops              int                      `json:"max_proxy_hops,omitempty"`
+	TrustLocalhost            bool                     `json:"trust_localhost"`
+	TrustPrivateRanges        bool                     `json:"trust_private_ranges"`
+	FailClosedOnResolverError bool                     `json:"fail_closed_on_resolver_error"`
+	DecisionHeader            string                   `json:"decision_header,omitempty"`
+	WhoAmIReasons             bool                     `json:"who_am_i_reasons"`
+	RecoverPanics             bool                     `json:"recover_panics"`
+	RePanic                   bool                     `json:"re_panic"`
+	RateLimit                 int                      `json:"rate_limit,omitempty"`
+	RateWindow                Duration                 `json:"rate_window,omitempty"`
+	BanDuration               Duration                 `json:"ban_duration,omitempty"`
+	Learn                     bool                     `json:"learn"`
+	LearnIPv4PrefixLength     int                      `json:"learn_ipv4_prefix_length,omitempty"`
+	LearnIPv6PrefixLength     int                      `json:"learn_ipv6_prefix_length,omitempty"`
+	MaxLearnedSources         int                      `json:"max_learned_sources,omitempty"`
+	DecisionCacheSize         int                      `json:"decision_cache_size,omitempty"`
+	MaxRuleAge                Duration                 `json:"max_rule_age,omitempty"`
+
+	Groups          map[string][]string             `json:"groups,omitempty"`
+	GroupReferences map[string]GroupReferenceConfig `json:"group_references,omitempty"`
+}
+
+/*GroupReferenceConfig is the JSON schema for how a path's rule was defined in terms
+* of netblocks and groups, see DefineGroup. The rule's allow list in Paths already
+* includes the groups' netblocks, the references let redefining a group update it
+ */
+type GroupReferenceConfig struct {
+	Networks []string `json:"networks,omitempty"`
+	Groups   []string `json:"groups"`
+}
+
+// GrantConfig is the JSON schema for a temporary access grant
+type GrantConfig struct {
+	Netblock string    `json:"netblock"`
+	Expires  time.Time `json:"expires"`
+}
+
+// Duration is a time.Duration which is encoded in JSON as a string such as "1m30s"
+type Duration time.Duration
+
+// MarshalJSON encodes the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON decodes the duration from a string
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("could not decode duration: %s", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("could not parse duration: %s", err)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Export returns a snapshot of all the configurable state of the firewall
+func (fw *Firewall) Export() Config {
+	// the state is copied under the lock, and only serialized once it is released
+	fw.mu.RLock()
+	rules := copyRules(fw.Rules)
+	config := Config{
+		Version:                   ConfigVersion,
+		Grants:                    make(map[string][]GrantConfig),
+		Bypasses:                  make(map[string]time.Time),
+		Log:                       fw.Log,
+		AllowedLogSampleRate:      fw.AllowedLogSampleRate,
+		LogFormat:                 fw.LogFormat,
+		BlockPathTraversal:        fw.BlockPathTraversal,
+		CollapseSlashes:           fw.CollapseSlashes,
+		ResolveDotSegments:        fw.ResolveDotSegments,
+		BlockStatus:               fw.BlockStatus,
+		BlockBody:                 fw.BlockBody,
+		ReasonStatus:              copyReasonStatus(fw.ReasonStatus),
+		ProblemJSON:               fw.ProblemJSON,
+		ProblemDetailIncludesPath: fw.ProblemDetailIncludesPath,
+		BlockHeaders:              fw.BlockHeaders.Clone(),
+		BlockReasonHeader:         fw.BlockReasonHeader,
+		Listener:                  fw.Listener,
+		RejectSpoofedSources:      fw.RejectSpoofedSources,
+		PublicListeners:           append([]string(nil), fw.PublicListeners...),
+		AllowPreflight:            fw.AllowPreflight,
+		RequireTLS:                fw.RequireTLS,
+		TrustedProxies:            formatCIDRs(fw.TrustedProxies),
+		MaxProxyHops:              fw.MaxProxyHops,
+		TrustLocalhost:            fw.TrustLocalhost,
+		TrustPrivateRanges:        fw.TrustPrivateRanges,
+		FailClosedOnResolverError: fw.FailClosedOnResolverError,
+		DecisionHeader:            fw.DecisionHeader,
+		WhoAmIReasons:             fw.WhoAmIReasons,
+		RecoverPanics:             fw.RecoverPanics,
+		RePanic:                   fw.RePanic,
+		RateLimit:                 fw.RateLimit,
+		RateWindow:                Duration(fw.RateWindow),
+		BanDuration:               Duration(fw.BanDuration),
+		Learn:                     fw.Learn,
+		LearnIPv4PrefixLength:     fw.LearnIPv4PrefixLength,
+		LearnIPv6PrefixLength:     fw.LearnIPv6PrefixLength,
+		MaxLearnedSources:         fw.MaxLearnedSources,
+		DecisionCacheSize:         fw.DecisionCacheSize,
+		MaxRuleAge:                Duration(fw.MaxRuleAge),
+	}
+	for path, until := range fw.bypasses {
+		config.Bypasses[path] = until
+	}
+	if len(fw.groups) > 0 {
+		config.Groups = make(map[string][]string, len(fw.groups))
+		for name, netblocks := range fw.groups {
+			config.Groups[name] = formatCIDRs(netblocks)
+		}
+	}
+	if len(fw.groupRefs) > 0 {
+		config.GroupReferences = make(map[string]GroupReferenceConfig, len(fw.groupRefs))
+		for path, ref := range fw.groupRefs {
+			config.GroupReferences[path] = GroupReferenceConfig{
+				Networks: formatCIDRs(ref.netblocks),
+				Groups:   append([]string(nil), ref.groups...),
+			}
+		}
+	}
+	fw.mu.RUnlock()
+
+	config.RulesConfig = rulesConfig(rules)
+	for path, grants := range rules.PathToGrants {
+		for _, grant := range grants {
+			config.Grants[path] = append(config.Grants[path], GrantConfig{
+				Netblock: grant.Netblock.String(),
+				Expires:  grant.Expires,
+			})
+		}
+	}
+	return config
+}
+
+/*Import validates a Config and, only if it is entirely valid, atomically replaces
+* the firewall's state with it. A decision cache already in use keeps its size
+ */
+func (fw *Firewall) Import(config Config) (err error) {
+	defer fw.reloadDone(&err)
+
+	if config.Version != ConfigVersion {
+		return fmt.Errorf("%s: %d", ErrUnsupportedConfigVersion, config.Version)
+	}
+	rules, err := config.Rules()
+	if err != nil {
+		return err
+	}
+	for path, grantConfigs := range config.Grants {
+		for _, grantConfig := range grantConfigs {
+			_, netblock, err := net.ParseCIDR(grantConfig.Netblock)
+			if err != nil {
+				return fmt.Errorf("invalid grant for path %s: could not parse CIDR: %s", path, err)
+			}
+			rules.PathToGrants[path] = append(rules.PathToGrants[path], Grant{Netblock: *netblock, Expires: grantConfig.Expires})
+		}
+	}
+	if rules, err = prepareRules(rules); err != nil {
+		return err
+	}
+	trustedProxies, err := parseCIDRs(config.TrustedProxies)
+	if err != nil {
+		return fmt.Errorf("invalid trusted proxies: %s", err)
+	}
+	if config.BlockStatus != 0 && (config.BlockStatus < 100 || config.BlockStatus > 999) {
+		return fmt.Errorf("invalid block status: %d", config.BlockStatus)
+	}
+	for reason, status := range config.ReasonStatus {
+		if status < 100 || status > 999 {
+			return fmt.Errorf("invalid status for reason %s: %d", reason, status)
+		}
+	}
+	if config.AllowedLogSampleRate < 0 || config.AllowedLogSampleRate > 1 {
+		return fmt.Errorf("invalid allowed log sample rate: %v", config.AllowedLogSampleRate)
+	}
+	if !config.LogFormat.valid() {
+		return fmt.Errorf("invalid log format: %q", config.LogFormat)
+	}
+	if config.RateLimit < 0 || config.RateWindow < 0 || config.BanDuration < 0 {
+		return errors.New("rate limit, rate window and ban duration must not be negative")
+	}
+	if config.LearnIPv4PrefixLength < 0 || config.LearnIPv4PrefixLength > 8*net.IPv4len ||
+		config.LearnIPv6PrefixLength < 0 || config.LearnIPv6PrefixLength > 8*net.IPv6len {
+		return fmt.Errorf("invalid learning prefix lengths: /%d and /%d", config.LearnIPv4PrefixLength, config.LearnIPv6PrefixLength)
+	}
+	if config.MaxLearnedSources < 0 || config.DecisionCacheSize < 0 || config.MaxRuleAge < 0 {
+		return errors.New("max learned sources, decision cache size and max rule age must not be negative")
+	}
+	bypasses := make(map[string]time.Time, len(config.Bypasses))
+	for path, until := range config.Bypasses {
+		bypasses[path] = until
+	}
+	groups, groupRefs, err := importGroups(config, rules)
+	if err != nil {
+		return err
+	}
+	denyTree := newDenyTree(rules.DeniedNetblocks)
+
+	fw.mu.Lock()
+	err = fw.checkRuleCount(ruleCount(rules))
+	if err == nil {
+		rules, err = keepCodeOptions(config.RulesConfig, rules, fw.Rules)
+	}
+	if err != nil {
+		fw.mu.Unlock()
+		return err
+	}
+	fw.Rules = rules
+	fw.globalDenyTree.Store(denyTree)
+	fw.groups = groups
+	fw.groupRefs = groupRefs
+	fw.bypasses = bypasses
+	fw.Log = config.Log
+	fw.AllowedLogSampleRate = config.AllowedLogSampleRate
+	fw.LogFormat = config.LogFormat
+	fw.BlockPathTraversal = config.BlockPathTraversal
+	fw.CollapseSlashes = config.CollapseSlashes
+	fw.ResolveDotSegments = config.ResolveDotSegments
+	fw.BlockStatus = config.BlockStatus
+	fw.BlockBody = config.BlockBody
+	fw.ReasonStatus = copyReasonStatus(config.ReasonStatus)
+	fw.ProblemJSON = config.ProblemJSON
+	fw.ProblemDetailIncludesPath = config.ProblemDetailIncludesPath
+	fw.BlockHeaders = config.BlockHeaders.Clone()
+	fw.BlockReasonHeader = config.BlockReasonHeader
+	fw.Listener = config.Listener
+	fw.RejectSpoofedSources = config.RejectSpoofedSources
+	fw.PublicListeners = append([]string(nil), config.PublicListeners...)
+	fw.AllowPreflight = config.AllowPreflight
+	fw.RequireTLS = config.RequireTLS
+	fw.TrustedProxies = trustedProxies
+	fw.MaxProxyHops = config.MaxProxyHops
+	fw.TrustLocalhost = config.TrustLocalhost
+	fw.TrustPrivateRanges = config.TrustPrivateRanges
+	fw.FailClosedOnResolverError = config.FailClosedOnResolverError
+	fw.DecisionHeader = config.DecisionHeader
+	fw.WhoAmIReasons = config.WhoAmIReasons
+	fw.RecoverPanics = config.RecoverPanics
+	fw.RePanic = config.RePanic
+	fw.RateLimit = config.RateLimit
+	fw.RateWindow = time.Duration(config.RateWindow)
+	fw.BanDuration = time.Duration(config.BanDuration)
+	fw.Learn = config.Learn
+	fw.LearnIPv4PrefixLength = config.LearnIPv4PrefixLength
+	fw.LearnIPv6PrefixLength = config.LearnIPv6PrefixLength
+	fw.MaxLearnedSources = config.MaxLearnedSources
+	fw.DecisionCacheSize = config.DecisionCacheSize
+	fw.MaxRuleAge = time.Duration(config.MaxRuleAge)
+	fw.lastReload = fw.now()
+	fw.version++
+	fw.mu.Unlock()
+
+	fw.ruleChanged(RuleChangeEvent{Action: RulesReloaded, Detail: "imported config"})
+	return nil
+}
+
+// importGroups parses a Config's netblock groups and the references to them of the rules it defines
+func importGroups(config Config, rules Rules) (map[string][]net.IPNet, map[string]groupRef, error) {
+	groups := make(map[string][]net.IPNet, len(config.Groups))
+	for name, networks := range config.Groups {
+		if name == "" || strings.HasPrefix(name, GroupPrefix) {
+			return nil, nil, fmt.Errorf("invalid group name: %q", name)
+		}
+		netblocks, err := parseCIDRs(networks)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid group %s: %s", name, err)
+		}
+		groups[name] = netblocks
+	}
+	refs := make(map[string]groupRef, len(config.GroupReferences))
+	for path, refConfig := range config.GroupReferences {
+		if _, ok := rules.PathToNetblocks[path]; !ok {
+			return nil, nil, fmt.Errorf("group references for path %s, which has no rule", path)
+		}
+		netblocks, err := parseCIDRs(refConfig.Networks)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid group references for path %s: %s", path, err)
+		}
+		for _, group := range refConfig.Groups {
+			if _, ok := groups[group]; !ok {
+				return nil, nil, fmt.Errorf("%s: %s%s", ErrUnknownGroup, GroupPrefix, group)
+			}
+		}
+		if len(refConfig.Groups) > 0 {
+			refs[path] = groupRef{netblocks: netblocks, groups: append([]string(nil), refConfig.Groups...)}
+		}
+	}
+	return groups, refs, nil
+}
+
+// copyReasonStatus copies a map of status codes by reason
+func copyReasonStatus(statuses map[Reason]int) map[Reason]int {
+	if statuses == nil {
+		return nil
+	}
+	copied := make(map[Reason]int, len(statuses))
+	for reason, status := range statuses {
+		copied[reason] = status
+	}
+	return copied
+}
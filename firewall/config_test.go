@@ -0,0 +1,195 @@
+package firewall
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newCodeOptionsFirewall returns a firewall with rules whose options can't be part of a config
+func newCodeOptionsFirewall(t *testing.T) *Firewall {
+	fw := newSignatureFirewall(t, PathOptions{})
+	resolver := ResolverFunc(func(ctx context.Context, ip net.IP) (bool, error) {
+		return ip.String() == "198.51.100.1", nil
+	})
+	if err := fw.AddPathRuleWithOptions("/geo", []string{"10.0.0.0/8"}, PathOptions{Resolver: resolver}); err != nil {
+		t.Fatal(err)
+	}
+	return fw
+}
+
+// checkCodeOptionDecisions checks the decisions of the rules set up by newCodeOptionsFirewall
+func checkCodeOptionDecisions(t *testing.T, fw *Firewall) {
+	t.Helper()
+	unsigned := newTestRequest(http.MethodPost, "/hook", "10.1.2.3")
+	if d := fw.Decide(unsigned); d.Allowed {
+		t.Error("unsigned request allowed")
+	}
+	signed := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader("payload"))
+	signed.RemoteAddr = "10.1.2.3:1234"
+	signed.Header.Set("X-Signature", sign([]byte("payload")))
+	if d := fw.Decide(signed); !d.Allowed {
+		t.Errorf("signed request blocked: %s", d.Reason)
+	}
+	if d := fw.Decide(newTestRequest(http.MethodGet, "/geo", "198.51.100.1")); !d.Allowed {
+		t.Errorf("request matching the resolver blocked: %s", d.Reason)
+	}
+	if d := fw.Decide(newTestRequest(http.MethodGet, "/geo", "198.51.100.2")); d.Allowed {
+		t.Error("request not matching the resolver allowed")
+	}
+}
+
+func TestImportKeepsCodeOptions(t *testing.T) {
+	fw := newCodeOptionsFirewall(t)
+	checkCodeOptionDecisions(t, fw)
+
+	var encoded bytes.Buffer
+	if err := json.NewEncoder(&encoded).Encode(fw.Export()); err != nil {
+		t.Fatal(err)
+	}
+	var config Config
+	if err := json.NewDecoder(&encoded).Decode(&config); err != nil {
+		t.Fatal(err)
+	}
+	if got := config.Paths["/hook"].CodeOptions; len(got) != 1 || got[0] != "signature_secret" {
+		t.Errorf("got code options %v for /hook, want [signature_secret]", got)
+	}
+	if err := fw.Import(config); err != nil {
+		t.Fatal(err)
+	}
+	checkCodeOptionDecisions(t, fw)
+}
+
+func TestImportRejectsMissingCodeOptions(t *testing.T) {
+	config := newCodeOptionsFirewall(t).Export()
+	fw := New()
+	if err := fw.AddPathRule("/other", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.Import(config); err == nil {
+		t.Fatal("imported rules whose code options the firewall doesn't have")
+	}
+	if !fw.HasRule("/other") || fw.HasRule("/hook") {
+		t.Error("rules changed by a failed import")
+	}
+	if d := fw.Decide(newTestRequest(http.MethodPost, "/hook", "10.1.2.3")); d.Allowed {
+		t.Error("unsigned request allowed after a failed import")
+	}
+}
+
+func TestLoadRulesKeepsCodeOptions(t *testing.T) {
+	fw := newCodeOptionsFirewall(t)
+	var encoded bytes.Buffer
+	if err := json.NewEncoder(&encoded).Encode(fw.Export().RulesConfig); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.LoadRules(&encoded); err != nil {
+		t.Fatal(err)
+	}
+	checkCodeOptionDecisions(t, fw)
+
+	if _, err := fw.LoadRulesLayer(strings.NewReader(`{"paths": {"/geo": {"allow": ["10.0.0.0/8"], "code_options": ["resolver"]}, "/hook": {"allow": ["10.0.0.0/8"], "signature_header": "X-Signature"}}}`), 0); err != nil {
+		t.Fatal(err)
+	}
+	checkCodeOptionDecisions(t, fw)
+}
+
+func TestLoadRulesRejectsSignatureHeaderWithoutSecret(t *testing.T) {
+	fw := New()
+	err := fw.LoadRules(strings.NewReader(`{"paths": {"/hook": {"allow": ["10.0.0.0/8"], "signature_header": "X-Signature"}}}`))
+	if err == nil {
+		t.Fatal("loaded a signature header without a secret")
+	}
+	if fw.HasRule("/hook") {
+		t.Error("rules changed by a failed load")
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	fw := New()
+	if err := fw.DefineGroup("office", []string{"198.51.100.0/24"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.AddPathRule("/admin", []string{"@office", "10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.AddPathRule("/public", []string{"0.0.0.0/0"}); err != nil {
+		t.Fatal(err)
+	}
+	fw.Learn = true
+	fw.LearnIPv4PrefixLength, fw.LearnIPv6PrefixLength, fw.MaxLearnedSources = 24, 64, 500
+	fw.DecisionCacheSize = 1000
+	fw.MaxRuleAge = time.Hour
+
+	var encoded bytes.Buffer
+	if err := json.NewEncoder(&encoded).Encode(fw.Export()); err != nil {
+		t.Fatal(err)
+	}
+	var config Config
+	if err := json.Unmarshal(encoded.Bytes(), &config); err != nil {
+		t.Fatal(err)
+	}
+	restored := New()
+	if err := restored.Import(config); err != nil {
+		t.Fatal(err)
+	}
+	var reencoded bytes.Buffer
+	if err := json.NewEncoder(&reencoded).Encode(restored.Export()); err != nil {
+		t.Fatal(err)
+	}
+	if reencoded.String() != encoded.String() {
+		t.Errorf("export of the restored firewall differs:\n got %s\nwant %s", reencoded.String(), encoded.String())
+	}
+	if !restored.Learn || restored.LearnIPv4PrefixLength != 24 || restored.LearnIPv6PrefixLength != 64 || restored.MaxLearnedSources != 500 {
+		t.Error("learning settings not restored")
+	}
+	if restored.DecisionCacheSize != 1000 || restored.MaxRuleAge != time.Hour {
+		t.Error("decision cache size or max rule age not restored")
+	}
+
+	// the restored rule still references the group
+	if err := restored.DefineGroup("office", []string{"203.0.113.0/24"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := formatNetblocks(restored.GetRules().PathToNetblocks["/admin"]); got != "10.0.0.0/8 203.0.113.0/24" {
+		t.Errorf("got /admin trusting %s once the group was redefined, want 10.0.0.0/8 203.0.113.0/24", got)
+	}
+}
+
+func TestImportRejectsInvalidGroups(t *testing.T) {
+	valid := func() Config {
+		config := Config{Version: ConfigVersion}
+		config.Paths = map[string]PathConfig{"/admin": {Allow: []string{"198.51.100.0/24"}}}
+		config.Groups = map[string][]string{"office": {"198.51.100.0/24"}}
+		config.GroupReferences = map[string]GroupReferenceConfig{"/admin": {Groups: []string{"office"}}}
+		return config
+	}
+	if err := New().Import(valid()); err != nil {
+		t.Fatal(err)
+	}
+	invalid := map[string]func(config *Config){
+		"invalid group name":    func(config *Config) { config.Groups["@office"] = []string{"10.0.0.0/8"} },
+		"invalid group network": func(config *Config) { config.Groups["office"] = []string{"not a cidr"} },
+		"reference to unknown group": func(config *Config) {
+			config.GroupReferences["/admin"] = GroupReferenceConfig{Groups: []string{"campus"}}
+		},
+		"reference without a rule": func(config *Config) {
+			config.GroupReferences["/other"] = GroupReferenceConfig{Groups: []string{"office"}}
+		},
+		"invalid learning prefix": func(config *Config) { config.LearnIPv4PrefixLength = 33 },
+		"negative cache size":     func(config *Config) { config.DecisionCacheSize = -1 },
+	}
+	for name, corrupt := range invalid {
+		config := valid()
+		corrupt(&config)
+		if err := New().Import(config); err == nil {
+			t.Errorf("%s: imported", name)
+		}
+	}
+}
@@ -0,0 +1,473 @@
+package firewall
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// DefaultRule is the Rule of decisions made by the default rule
+const DefaultRule = "*"
+
+/*Decision represents the outcome of running a request through the firewall. It
+* implements error so that it can be returned as is by non-HTTP integrations,
+* Err returns nil for allowed decisions
+ */
+type Decision struct {
+	// Allowed is true when the request may reach the wrapped handler
+	Allowed bool
+	// Reason is why the request was allowed or not
+	Reason Reason
+	// Status is the HTTP status code written for requests which are not allowed
+	Status int
+	// Rule is the path of the rule which matched, DefaultRule for the
+	// default rule and empty when no rule was evaluated
+	Rule string
+	// Path is the request path, after any normalization, the decision was made for
+	Path string
+	// SrcIP is the source IP the decision was made for
+	SrcIP net.IP
+
+	maxBodyBytes  int64
+	maxConcurrent int
+	onUntrusted   func(w http.ResponseWriter, r *http.Request)
+	retryAfter    time.Duration
+	preflight     http.Handler
+	breaker       *CircuitBreaker
+	recoverPanics bool
+	rePanic       bool
+}
+
+// Error describes the decision
+func (d Decision) Error() string {
+	if d.Allowed {
+		return fmt.Sprintf("firewall allowed request from %s for %s: %s", d.SrcIP, d.Path, d.Reason)
+	}
+	return fmt.Sprintf("firewall blocked request from %s for %s: %s", d.SrcIP, d.Path, d.Reason)
+}
+
+// Err returns the decision as an error when the request is not allowed and nil otherwise
+func (d Decision) Err() error {
+	if d.Allowed {
+		return nil
+	}
+	return d
+}
+
+// HTTPStatus returns the HTTP status code for the decision, 200 when the request is allowed
+func (d Decision) HTTPStatus() int {
+	if d.Allowed {
+		return http.StatusOK
+	}
+	if d.Status != 0 {
+		return d.Status
+	}
+	return d.Reason.HTTPStatus()
+}
+
+// decided sets the reason for a decision along with whether it is allowed and its status
+func (fw *Firewall) decided(d Decision, reason Reason) Decision {
+	d.Reason = reason
+	d.Allowed = reason.Allowed()
+	if !d.Allowed {
+		d.Status = fw.statusFor(reason)
+	}
+	return d
+}
+
+/*Decide runs a request through the firewall and returns its decision without
+* writing a response, which makes it useful for testing and previewing firewall
+* configurations directly. It evaluates the request as Wrap does, except that it
+* has no side effects: the request is not counted towards RateLimit nor the
+* request rate ShedAbove is compared to, and bans and rate limits are not checked
+ */
+func (fw *Firewall) Decide(r *http.Request) Decision {
+	return fw.decide(r, false)
+}
+
+/*pendingDecision is a request's decision as evaluated under the firewall's lock,
+* pending the checks which may block, such as resolver lookups or reading the
+* request body to verify its signature, which are made once the lock is released.
+* Every outcome is decided up front: allowed when the source is trusted and the
+* options' conditions hold, otherwise
+ */
+type pendingDecision struct {
+	trusted   bool
+	opts      PathOptions
+	allowed   Decision
+	otherwise Decision
+	// audit logs that a staged rule would have blocked the request when it ends up otherwise
+	audit bool
+	// resolve consults the options' Resolver for a source the rule doesn't trust,
+	// which is then trusted when it matches and chainTrusted is set. Failed lookups
+	// end in resolverError when failClosed is set
+	resolve       bool
+	chainTrusted  bool
+	failClosed    bool
+	resolverError Decision
+}
+
+// decidedNow is a pending decision which needs no further checks
+func decidedNow(d Decision) pendingDecision {
+	return pendingDecision{otherwise: d}
+}
+
+// decide evaluates a request, counting it towards rate limits when limit is set
+func (fw *Firewall) decide(r *http.Request, limit bool) Decision {
+	fw.mu.RLock()
+	d, screened := fw.screen(r)
+	var limits limitSettings
+	if screened && limit {
+		fw.rateMeter.hit(fw.now())
+		limits = fw.limitSettings()
+	}
+	fw.mu.RUnlock()
+	if !screened {
+		return d
+	}
+
+	if limit {
+		// the stores may be remote, they are consulted without holding the lock
+		if reason, retryAfter, ok := fw.checkLimits(limits, d.SrcIP); !ok {
+			d.retryAfter = retryAfter
+			fw.mu.RLock()
+			defer fw.mu.RUnlock()
+			return fw.decided(d, reason)
+		}
+	}
+
+	fw.mu.RLock()
+	p := fw.evaluate(r, d)
+	fw.mu.RUnlock()
+
+	return fw.conclude(r, p)
+}
+
+// conclude checks the conditions of a pending decision, without holding the firewall's lock, and returns the outcome
+func (fw *Firewall) conclude(r *http.Request, p pendingDecision) Decision {
+	if p.resolve {
+		src := p.otherwise.SrcIP
+		matched, err := p.opts.Resolver.Match(r.Context(), src)
+		if err != nil {
+			fw.logfUnlocked("could not resolve %s for %s: %s", src, p.otherwise.Path, err)
+			if p.failClosed {
+				return p.resolverError
+			}
+		}
+		p.trusted = err == nil && matched && p.chainTrusted
+	}
+	if p.trusted && p.opts.Matches(r) {
+		return p.allowed
+	}
+	if p.audit {
+		fw.logfUnlocked("audit: staged rule for %s would have blocked request from %s", p.otherwise.Rule, p.otherwise.SrcIP)
+	}
+	return p.otherwise
+}
+
+/*screen resolves a request's source and path and rejects malformed or spoofed
+* requests, returning false along with the decision when it does. The firewall's
+* lock must be held
+ */
+func (fw *Firewall) screen(r *http.Request) (Decision, bool) {
+	srcIP := fw.clientIP(r)
+	path := fw.normalizePath(requestPath(r))
+	d := Decision{Path: path, SrcIP: srcIP, recoverPanics: fw.RecoverPanics, rePanic: fw.RePanic}
+
+	if fw.BlockPathTraversal && HasPathTraversal(r.URL) {
+		return fw.decided(d, ReasonPathTraversal), false
+	}
+	if fw.RejectSpoofedSources {
+		if claimed, spoofed := fw.spoofedSource(r, srcIP); spoofed {
+			fw.logf("rejected request from %s for %s claiming private source %s", remoteIP(r), path, claimed)
+			return fw.decided(d, ReasonSpoofed), false
+		}
+	}
+	return d, true
+}
+
+// evaluate evaluates a screened request up to the conditions which may block, the firewall's lock must be held
+func (fw *Firewall) evaluate(r *http.Request, d Decision) pendingDecision {
+	srcIP, path := d.SrcIP, d.Path
+
+	// deny lists take precedence over every other rule
+	if fw.cachedDenied(path, srcIP) {
+		return decidedNow(fw.decided(d, ReasonDenied))
+	}
+	if until, ok := fw.bypassActive(path, fw.now()); ok {
+		fw.logf("bypass active for %s until %s, allowed request from %s", path, until.Format(time.RFC3339), srcIP)
+		d.Rule = path
+		return decidedNow(fw.decided(d, ReasonBypass))
+	}
+	if fw.AllowPreflight && IsPreflight(r) {
+		d.preflight = fw.PreflightHandler
+		return decidedNow(fw.decided(d, ReasonPreflight))
+	}
+	// evaluate only the most specific rule: the request URI's, the path's, or the default rule
+	rulePath := fw.rulePath(path, r.URL.RawQuery, r.Method)
+	rule, hasRule := fw.Rules.PathToNetblocks[rulePath]
+	var opts PathOptions
+	if hasRule && !fw.ruleApplies(rulePath, r.Method) {
+		// disabled rules, and rules scoped to other methods, behave as if the path had no rule
+		rule, hasRule = nil, false
+	}
+	if hasRule {
+		d.Rule = rulePath
+		opts = fw.Rules.PathToOptions[rulePath]
+	} else if len(fw.Rules.DefaultNetblocks) > 0 {
+		rule, hasRule = fw.Rules.DefaultNetblocks, true
+		d.Rule = DefaultRule
+		opts = fw.Rules.DefaultOptions
+	}
+	if opts.ShedAbove > 0 && fw.rateMeter.rate(fw.now()) > opts.ShedAbove {
+		return decidedNow(fw.decided(d, ReasonShed))
+	}
+	if len(opts.Listeners) > 0 && !containsString(opts.Listeners, fw.ListenerName(r)) {
+		return decidedNow(fw.decided(d, ReasonWrongListener))
+	}
+	if (fw.RequireTLS || opts.RequireTLS) && !fw.IsTLS(r) {
+		return decidedNow(fw.decided(d, ReasonTLSRequired))
+	}
+	if !opts.tlsAcceptable(r.TLS) {
+		return decidedNow(fw.decided(d, ReasonWeakTLS))
+	}
+	trusted := (hasRule && fw.ruleTrusts(r, d.Rule, rule, opts, srcIP)) || grantIsActive(fw.Rules.PathToGrants[rulePath], srcIP, fw.now()) || fw.trustsLocal(srcIP)
+	chainTrusted := !opts.RequireTrustedChain || AllIPsTrusted(rule, append(ForwardedChain(r), remoteIP(r)))
+	p := pendingDecision{trusted: trusted && chainTrusted, opts: opts, allowed: fw.admitted(r, d, opts, ReasonTrusted)}
+	if !trusted && hasRule && opts.Resolver != nil && srcIP != nil {
+		p.resolve, p.chainTrusted = true, chainTrusted
+		p.failClosed, p.resolverError = fw.FailClosedOnResolverError, fw.decided(d, ReasonResolverError)
+	}
+	switch {
+	case hasRule && !opts.enforcedOn(srcIP):
+		p.otherwise, p.audit = fw.admitted(r, d, opts, ReasonAudited), true
+	case hasRule:
+		d.onUntrusted = opts.OnUntrusted
+		p.otherwise = fw.decided(d, ReasonUntrusted)
+	case fw.failOpen(r.Method):
+		// never for paths with a rule, which would otherwise let untrusted sources through
+		p.otherwise = fw.admitted(r, d, opts, ReasonFailOpen)
+	default:
+		p.otherwise = fw.decided(d, ReasonNoRule)
+	}
+	return p
+}
+
+// admitted decides a request allowed for a reason, unless its body is too large for the options, the firewall's lock must be held
+func (fw *Firewall) admitted(r *http.Request, d Decision, opts PathOptions, reason Reason) Decision {
+	if opts.MaxBodyBytes > 0 && r.ContentLength > opts.MaxBodyBytes {
+		return fw.decided(d, ReasonBodyTooLarge)
+	}
+	d.maxBodyBytes = opts.MaxBodyBytes
+	d.maxConcurrent = opts.MaxConcurrent
+	d.breaker = opts.Breaker
+	return fw.decided(d, reason)
+}
+
+/*rulePath returns the key of the rule to evaluate for a request: the path followed
+* by "?" and the raw query when a rule with MatchRequestURI exists for exactly
+* that and applies to the request's method, and the path otherwise. A request URI
+* rule which is disabled or scoped to other methods never shadows the path's rule
+ */
+func (fw *Firewall) rulePath(path, rawQuery, method string) string {
+	if rawQuery == "" {
+		return path
+	}
+	uri := path + "?" + rawQuery
+	if _, ok := fw.Rules.PathToNetblocks[uri]; ok && fw.Rules.PathToOptions[uri].MatchRequestURI && fw.ruleApplies(uri, method) {
+		return uri
+	}
+	return path
+}
+
+// IsPreflight checks whether a request is a CORS preflight request
+func IsPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+/*ruleTrusts checks whether a rule trusts a request's source: by its breaker's
+* strict netblocks while it is open, by its condition when it has one and by its
+* netblocks otherwise
+ */
+func (fw *Firewall) ruleTrusts(r *http.Request, rulePath string, netblocks []net.IPNet, opts PathOptions, src net.IP) bool {
+	if opts.Breaker != nil && opts.Breaker.IsOpen(fw.now()) {
+		return IPIsTrusted(opts.Breaker.StrictNetblocks, src)
+	}
+	if opts.Condition != nil {
+		return opts.Condition.Match(ConditionInput{Request: r, SrcIP: src, Now: fw.now()})
+	}
+	return fw.cachedTrusted(rulePath, netblocks, src)
+}
+
+// ruleApplies checks whether the existing rule for a path is enabled and applies to a method
+func (fw *Firewall) ruleApplies(path, method string) bool {
+	return !fw.Rules.DisabledPaths[path] && fw.Rules.PathToOptions[path].appliesTo(method)
+}
+
+// trustsLocal checks whether an IP address is trusted on every path by TrustLocalhost or TrustPrivateRanges
+func (fw *Firewall) trustsLocal(src net.IP) bool {
+	if src == nil {
+		return false
+	}
+	return (fw.TrustLocalhost && src.IsLoopback()) || (fw.TrustPrivateRanges && src.IsPrivate())
+}
+
+// isDenied checks whether an IP address is part of the global or the path's deny list
+func (fw *Firewall) isDenied(path string, src net.IP) bool {
+	return fw.globalDenied(src) || IPIsTrusted(fw.Rules.PathToDeniedNetblocks[path], src)
+}
+
+/*IsTLS checks whether a request was made over TLS, either directly or, when the
+* request comes from one of the firewall's TrustedProxies, as reported by the
+* X-Forwarded-Proto header
+ */
+func (fw *Firewall) IsTLS(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	if !IPIsTrusted(fw.TrustedProxies, remoteIP(r)) {
+		return false
+	}
+	return strings.EqualFold(strings.TrimSpace(r.Header.Get("X-Forwarded-Proto")), "https")
+}
+
+/*ListenerName returns the name of the listener a request arrived on: the firewall's
+* Listener label when set, otherwise the port of the server's local address (e.g.
+* "8443"), so that the same handler can be guarded differently on each listener
+ */
+func (fw *Firewall) ListenerName(r *http.Request) string {
+	if fw.Listener != "" {
+		return fw.Listener
+	}
+	addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if !ok {
+		return ""
+	}
+	_, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return ""
+	}
+	return port
+}
+
+// containsString checks whether a list of strings contains a given string
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIP returns the IP of a request's direct peer
+func remoteIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		// RemoteAddr without a port
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// failOpen determines whether requests with a method for paths without a rule are allowed
+func (fw *Firewall) failOpen(method string) bool {
+	for m, open := range fw.Rules.MethodFailOpen {
+		if strings.EqualFold(m, method) {
+			return open
+		}
+	}
+	if fw.FailOpenWhen != nil {
+		return fw.FailOpenWhen()
+	}
+	return fw.Rules.FailOpen
+}
+
+/*requestPath returns the path rules are looked up by, the same whichever HTTP
+* version the request was made with. net/http parses both the HTTP/1.x request
+* target and the HTTP/2 :path pseudo-header with url.ParseRequestURI, so r.URL.Path
+* is decoded identically for both, and the HTTP/1.x absolute form (e.g.
+* "GET http://host/a") yields the same path as its origin form. The one difference
+* is an absolute form without a path ("GET http://host"), which HTTP/2 can't
+* express as :path must then be "/": such paths are canonicalized to "/". CONNECT
+* requests, which have no path under either version, keep an empty path, and
+* "OPTIONS *" keeps "*"
+ */
+func requestPath(r *http.Request) string {
+	if r.URL.Path == "" && r.Method != http.MethodConnect && r.URL.Opaque == "" {
+		return "/"
+	}
+	return r.URL.Path
+}
+
+// normalizePath applies the firewall's path normalization options to a request path
+func (fw *Firewall) normalizePath(p string) string {
+	if fw.ResolveDotSegments && p != "" {
+		cleaned := path.Clean(p)
+		// path.Clean drops trailing slashes, which are significant to rule lookups
+		if strings.HasSuffix(p, "/") && cleaned != "/" {
+			cleaned += "/"
+		}
+		return cleaned
+	}
+	if fw.CollapseSlashes {
+		for strings.Contains(p, "//") {
+			p = strings.Replace(p, "//", "/", -1)
+		}
+	}
+	return p
+}
+
+// maxPathDecodes bounds how many layers of percent-encoding are peeled off a path
+const maxPathDecodes = 3
+
+/*HasPathTraversal checks whether a URL's path contains a ".." segment, either
+* literally or once decoded. Backslashes are treated as separators and the path
+* is decoded repeatedly to catch double encodings such as "%252e%252e%252f"
+ */
+func HasPathTraversal(u *url.URL) bool {
+	if hasDotDotSegment(u.Path) {
+		return true
+	}
+	p := u.EscapedPath()
+	for i := 0; i <= maxPathDecodes; i++ {
+		if hasDotDotSegment(p) {
+			return true
+		}
+		decoded, err := url.PathUnescape(p)
+		if err != nil || decoded == p {
+			return false
+		}
+		p = decoded
+	}
+	return false
+}
+
+func hasDotDotSegment(p string) bool {
+	for _, segment := range strings.Split(strings.Replace(p, "\\", "/", -1), "/") {
+		if segment == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+/*ForwardedChain returns the IPs listed in a request's X-Forwarded-For headers,
+* in order from the original client to the last proxy. Ports, which some proxies
+* append (e.g. "192.0.2.1:4711" or "[2001:db8::1]:4711"), are stripped. Entries
+* which are not valid IPs are returned as nil so that they are never considered
+* trusted
+ */
+func ForwardedChain(r *http.Request) []net.IP {
+	var chain []net.IP
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, entry := range strings.Split(header, ",") {
+			chain = append(chain, parseForwardedNode(strings.TrimSpace(entry)))
+		}
+	}
+	return chain
+}
@@ -0,0 +1,254 @@
+package firewall
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestDecideMatchesWrap(t *testing.T) {
+	fw := New()
+	fw.BlockPathTraversal = true
+	fw.TrustedProxies = []net.IPNet{mustParseCIDR(t, "172.16.0.0/12")}
+	fw.Rules.DeniedNetblocks = []net.IPNet{mustParseCIDR(t, "10.9.0.0/16")}
+	if err := fw.AddPathRule("/admin", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.AddPathRuleWithOptions("/upload", []string{"10.0.0.0/8"}, PathOptions{MaxBodyBytes: 4}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.AddPathRuleWithOptions("/write", []string{"10.0.0.0/8"}, PathOptions{Methods: []string{http.MethodPost}}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		method    string
+		target    string
+		src       string
+		forwarded string
+		body      string
+	}{
+		{"trusted", http.MethodGet, "/admin", "10.1.2.3", "", ""},
+		{"untrusted", http.MethodGet, "/admin", "198.51.100.1", "", ""},
+		{"denied", http.MethodGet, "/admin", "10.9.1.1", "", ""},
+		{"no rule", http.MethodGet, "/other", "10.1.2.3", "", ""},
+		{"trusted through proxy", http.MethodGet, "/admin", "172.16.0.1", "10.1.2.3", ""},
+		{"untrusted through proxy", http.MethodGet, "/admin", "172.16.0.1", "198.51.100.1", ""},
+		{"spoofed forwarded header", http.MethodGet, "/admin", "198.51.100.1", "10.1.2.3", ""},
+		{"path traversal", http.MethodGet, "/admin/%2e%2e/secret", "10.1.2.3", "", ""},
+		{"body too large", http.MethodPost, "/upload", "10.1.2.3", "", "too large"},
+		{"body within limit", http.MethodPost, "/upload", "10.1.2.3", "", "ok"},
+		{"method with rule", http.MethodPost, "/write", "10.1.2.3", "", ""},
+		{"method without rule", http.MethodGet, "/write", "10.1.2.3", "", ""},
+	}
+	h := fw.Wrap(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := func() *http.Request {
+				r := httptest.NewRequest(test.method, test.target, strings.NewReader(test.body))
+				r.RemoteAddr = net.JoinHostPort(test.src, "1234")
+				if test.forwarded != "" {
+					r.Header.Set("X-Forwarded-For", test.forwarded)
+				}
+				return r
+			}
+			d := fw.Decide(request())
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, request())
+			if w.Code != d.HTTPStatus() {
+				t.Errorf("Decide returned %s with status %d, Wrap responded %d", d.Reason, d.HTTPStatus(), w.Code)
+			}
+		})
+	}
+}
+
+func TestPathTraversal(t *testing.T) {
+	fw := New()
+	fw.BlockPathTraversal = true
+	fw.Rules.FailOpen = true
+	tests := []struct {
+		path      string
+		traversal bool
+	}{
+		{"/static/../etc/passwd", true},
+		{"/static/..", true},
+		{"/static/..%2fetc", true},
+		{"/static/..%2Fetc", true},
+		{"/static/%2e%2e/etc", true},
+		{"/static/%2E%2E%2Fetc", true},
+		{"/static/%252e%252e%252fetc", true},
+		{"/static/..\\etc", true},
+		{"/static/..%5cetc", true},
+		{"/static/file..txt", false},
+		{"/static/...", false},
+		{"/static/a.b/c", false},
+		{"/static/%2e/file", false},
+		{"/", false},
+	}
+	for _, test := range tests {
+		u, err := url.Parse(test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := HasPathTraversal(u); got != test.traversal {
+			t.Errorf("%s: got traversal=%t, want %t", test.path, got, test.traversal)
+		}
+		r := newTestRequest(http.MethodGet, "/", "10.1.2.3")
+		r.URL = u
+		d := fw.Decide(r)
+		if test.traversal && (d.Reason != ReasonPathTraversal || d.HTTPStatus() != http.StatusBadRequest) {
+			t.Errorf("%s: got %s with status %d, want path_traversal with 400", test.path, d.Reason, d.HTTPStatus())
+		}
+		if !test.traversal && !d.Allowed {
+			t.Errorf("%s: benign path blocked: %s", test.path, d.Reason)
+		}
+	}
+}
+
+func TestPathNormalization(t *testing.T) {
+	tests := []struct {
+		path                     string
+		collapse, resolve, trust bool
+	}{
+		{"/api/status", false, false, true},
+		{"/api//status", false, false, false},
+		{"/api//status", true, false, true},
+		{"//api///status", true, false, true},
+		{"/api/./status", true, false, false},
+		{"/api/./status", false, true, true},
+		{"/api/x/../status", false, true, true},
+		{"/api//status", false, true, true},
+		{"/api/status/", false, true, false},
+	}
+	for _, test := range tests {
+		fw := New()
+		fw.CollapseSlashes, fw.ResolveDotSegments = test.collapse, test.resolve
+		if err := fw.AddPathRule("/api/status", []string{"10.0.0.0/8"}); err != nil {
+			t.Fatal(err)
+		}
+		var received string
+		h := fw.Wrap(func(w http.ResponseWriter, r *http.Request) { received = r.URL.Path })
+		r := newTestRequest(http.MethodGet, "/", "10.1.2.3")
+		r.URL.Path = test.path
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if allowed := w.Code == http.StatusOK; allowed != test.trust {
+			t.Errorf("%s with collapse=%t resolve=%t: got %d, want allowed=%t", test.path, test.collapse, test.resolve, w.Code, test.trust)
+		}
+		if test.trust && received != test.path {
+			t.Errorf("%s: handler received %s, want the path untouched", test.path, received)
+		}
+	}
+}
+
+func TestDecisionErr(t *testing.T) {
+	fw := New()
+	if err := fw.AddPathRule("/admin", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.Decide(newTestRequest(http.MethodGet, "/admin", "10.1.2.3")).Err(); err != nil {
+		t.Errorf("got error %v for an allowed request", err)
+	}
+	err := fw.Decide(newTestRequest(http.MethodGet, "/admin", "198.51.100.1")).Err()
+	var d Decision
+	if !errors.As(err, &d) || d.Reason != ReasonUntrusted {
+		t.Fatalf("got error %v, want an untrusted decision", err)
+	}
+	if want := "firewall blocked request from 198.51.100.1 for /admin: untrusted"; err.Error() != want {
+		t.Errorf("got %q, want %q", err.Error(), want)
+	}
+}
+
+func TestRequestPathAcrossProtocols(t *testing.T) {
+	fw := New()
+	for _, path := range []string{"/", "/admin", "/admin/", "/café", "/a/b"} {
+		if err := fw.AddPathRule(path, []string{"127.0.0.0/8"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fw.AddPathRule("/other", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	h := fw.Wrap(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(r.Proto)) })
+	h1 := httptest.NewServer(h)
+	defer h1.Close()
+	h2 := httptest.NewUnstartedServer(h)
+	h2.EnableHTTP2 = true
+	h2.StartTLS()
+	defer h2.Close()
+
+	tests := []struct {
+		target string
+		status int
+	}{
+		{"/admin", http.StatusOK},
+		{"/admin?q=1", http.StatusOK},
+		{"/admin/", http.StatusOK},
+		{"/caf%C3%A9", http.StatusOK},
+		{"/a%2Fb", http.StatusOK},
+		{"/other", http.StatusForbidden},
+		{"/unregistered", http.StatusForbidden},
+	}
+	for _, srv := range []struct {
+		server *httptest.Server
+		proto  string
+	}{{h1, "HTTP/1.1"}, {h2, "HTTP/2.0"}} {
+		for _, test := range tests {
+			resp, err := srv.server.Client().Get(srv.server.URL + test.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != test.status || resp.Proto != srv.proto {
+				t.Errorf("%s over %s: got %d over %s, want %d", test.target, srv.proto, resp.StatusCode, resp.Proto, test.status)
+			}
+		}
+	}
+
+	// the HTTP/1.x absolute form without a path is looked up as "/", like HTTP/2's :path
+	conn, err := net.Dial("tcp", h1.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("GET http://" + h1.Listener.Addr().String() + " HTTP/1.1\r\nHost: example.com\r\n\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("got %d for an absolute form without a path, want the rule for / to apply", resp.StatusCode)
+	}
+}
+
+func TestRequestPath(t *testing.T) {
+	tests := []struct {
+		method, target, path string
+	}{
+		{http.MethodGet, "/admin", "/admin"},
+		{http.MethodGet, "http://example.com", "/"},
+		{http.MethodGet, "http://example.com/admin", "/admin"},
+		{http.MethodOptions, "*", "*"},
+		{http.MethodConnect, "example.com:443", ""},
+	}
+	for _, test := range tests {
+		r := &http.Request{Method: test.method}
+		var err error
+		if test.method == http.MethodConnect {
+			r.URL = &url.URL{Host: test.target}
+		} else if r.URL, err = url.ParseRequestURI(test.target); err != nil {
+			t.Fatal(err)
+		}
+		if path := requestPath(r); path != test.path {
+			t.Errorf("%s %s: got path %q, want %q", test.method, test.target, path, test.path)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package firewall
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*setDecisionHeader sets the DecisionHeader on a request about to reach the
+* wrapped handler, replacing any value sent by the client. The value describes the
+* decision, e.g. "allowed; reason=trusted; ip=192.0.2.1", and when DecisionSecret
+* is set it is followed by "; ts=<unix seconds>; sig=<hex HMAC-SHA256>" of everything
+* before "; sig=", see VerifyDecisionHeader
+ */
+func (fw *Firewall) setDecisionHeader(r *http.Request, d Decision) {
+	fw.mu.RLock()
+	header, secret := fw.DecisionHeader, fw.DecisionSecret
+	fw.mu.RUnlock()
+
+	if header == "" {
+		return
+	}
+	r.Header.Del(header)
+	if !d.Allowed {
+		return
+	}
+	value := fmt.Sprintf("allowed; reason=%s; ip=%s", d.Reason, d.SrcIP)
+	if len(secret) > 0 {
+		value += fmt.Sprintf("; ts=%d", fw.now().Unix())
+		value += "; sig=" + signDecision(value, secret)
+	}
+	r.Header.Set(header, value)
+}
+
+/*VerifyDecisionHeader checks, e.g. in a backend behind the firewall, that the value
+* of a signed decision header was set by a firewall sharing the secret no longer
+* than maxAge ago, so that clients can't forge or replay it
+ */
+func VerifyDecisionHeader(value string, secret []byte, maxAge time.Duration) bool {
+	i := strings.LastIndex(value, "; sig=")
+	if i < 0 || len(secret) == 0 {
+		return false
+	}
+	payload, sig := value[:i], value[i+len("; sig="):]
+	if !hmac.Equal([]byte(sig), []byte(signDecision(payload, secret))) {
+		return false
+	}
+	j := strings.LastIndex(payload, "; ts=")
+	if j < 0 {
+		return false
+	}
+	ts, err := strconv.ParseInt(payload[j+len("; ts="):], 10, 64)
+	if err != nil {
+		return false
+	}
+	age := time.Since(time.Unix(ts, 0))
+	return age >= -time.Minute && age <= maxAge
+}
+
+// signDecision returns the hex encoded HMAC-SHA256 of a decision header's payload
+func signDecision(payload string, secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
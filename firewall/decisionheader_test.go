@@ -0,0 +1,83 @@
+package firewall
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// forwardedDecision serves a request through Wrap, returning the decision header the inner handler received, if it was reached
+func forwardedDecision(fw *Firewall, src string) (string, bool) {
+	var value string
+	reached := false
+	h := fw.Wrap(func(w http.ResponseWriter, r *http.Request) {
+		value, reached = r.Header.Get("X-Firewall-Decision"), true
+	})
+	r := newTestRequest(http.MethodGet, "/admin", src)
+	r.Header.Set("X-Firewall-Decision", "allowed; reason=trusted; ip="+src)
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	return value, reached
+}
+
+func TestDecisionHeader(t *testing.T) {
+	fw := New()
+	fw.DecisionHeader = "X-Firewall-Decision"
+	onUntrusted := func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("X-Firewall-Decision"); got != "" {
+			t.Errorf("OnUntrusted received the client's decision header %q", got)
+		}
+	}
+	if err := fw.AddPathRuleWithOptions("/admin", []string{"10.0.0.0/8"}, PathOptions{OnUntrusted: onUntrusted}); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := forwardedDecision(fw, "10.1.2.3"); value != "allowed; reason=trusted; ip=10.1.2.3" {
+		t.Errorf("got decision header %q for an allowed request", value)
+	}
+	if _, reached := forwardedDecision(fw, "198.51.100.1"); reached {
+		t.Error("blocked request reached the handler")
+	}
+}
+
+func TestSignedDecisionHeader(t *testing.T) {
+	secret := []byte("shared secret")
+	fw := New()
+	fw.DecisionHeader = "X-Firewall-Decision"
+	fw.DecisionSecret = secret
+	if err := fw.AddPathRule("/admin", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	value, _ := forwardedDecision(fw, "10.1.2.3")
+	if !strings.HasPrefix(value, "allowed; reason=trusted; ip=10.1.2.3; ts=") {
+		t.Fatalf("got decision header %q", value)
+	}
+	if !VerifyDecisionHeader(value, secret, time.Minute) {
+		t.Errorf("could not verify %q", value)
+	}
+	tests := map[string]struct {
+		value  string
+		secret []byte
+	}{
+		"tampered":   {strings.Replace(value, "10.1.2.3", "10.1.2.4", 1), secret},
+		"wrong key":  {value, []byte("other secret")},
+		"no key":     {value, nil},
+		"unsigned":   {"allowed; reason=trusted; ip=10.1.2.3", secret},
+		"client set": {"allowed; reason=trusted; ip=10.1.2.3; ts=0; sig=00", secret},
+	}
+	for name, test := range tests {
+		if VerifyDecisionHeader(test.value, test.secret, time.Minute) {
+			t.Errorf("%s: verified %q", name, test.value)
+		}
+	}
+
+	// replayed headers expire
+	fw.Now = func() time.Time { return time.Now().Add(-2 * time.Minute) }
+	old, _ := forwardedDecision(fw, "10.1.2.3")
+	if VerifyDecisionHeader(old, secret, time.Minute) {
+		t.Errorf("verified %q older than its max age", old)
+	}
+	if !VerifyDecisionHeader(old, secret, 3*time.Minute) {
+		t.Errorf("could not verify %q within its max age", old)
+	}
+}
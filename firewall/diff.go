@@ -0,0 +1,78 @@
+package firewall
+
+import (
+	"net"
+	"sort"
+)
+
+// RuleDiff describes the changes between two rule sets
+type RuleDiff struct {
+	// Added are the paths which only have a rule in the new rule set
+	Added []string
+	// Removed are the paths which only have a rule in the old rule set
+	Removed []string
+	// Modified maps paths with a rule in both rule sets to the changes in their netblocks
+	Modified map[string]NetblockDiff
+}
+
+// NetblockDiff describes the changes between two lists of netblocks
+type NetblockDiff struct {
+	Added   []net.IPNet
+	Removed []net.IPNet
+}
+
+// Empty checks whether there are no changes in the diff
+func (diff RuleDiff) Empty() bool {
+	return len(diff.Added) == 0 && len(diff.Removed) == 0 && len(diff.Modified) == 0
+}
+
+// DiffRules compares the trusted netblocks of each path between two rule sets, paths are reported in lexical order
+func DiffRules(old, new Rules) RuleDiff {
+	diff := RuleDiff{Modified: make(map[string]NetblockDiff)}
+	for path, oldNetblocks := range old.PathToNetblocks {
+		newNetblocks, ok := new.PathToNetblocks[path]
+		if !ok {
+			diff.Removed = append(diff.Removed, path)
+			continue
+		}
+		if netblockDiff := DiffNetblocks(oldNetblocks, newNetblocks); len(netblockDiff.Added) > 0 || len(netblockDiff.Removed) > 0 {
+			diff.Modified[path] = netblockDiff
+		}
+	}
+	for path := range new.PathToNetblocks {
+		if _, ok := old.PathToNetblocks[path]; !ok {
+			diff.Added = append(diff.Added, path)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	return diff
+}
+
+// DiffNetblocks compares two lists of netblocks, ignoring order and duplicates
+func DiffNetblocks(old, new []net.IPNet) NetblockDiff {
+	var diff NetblockDiff
+	oldSet := netblockSet(old)
+	newSet := netblockSet(new)
+	for _, netblock := range DedupNetblocks(new) {
+		if !oldSet[netblock.String()] {
+			diff.Added = append(diff.Added, netblock)
+		}
+	}
+	for _, netblock := range DedupNetblocks(old) {
+		if !newSet[netblock.String()] {
+			diff.Removed = append(diff.Removed, netblock)
+		}
+	}
+	return diff
+}
+
+// netblockSet returns the set of canonical string forms of a list of netblocks
+func netblockSet(netblocks []net.IPNet) map[string]bool {
+	set := make(map[string]bool, len(netblocks))
+	for _, netblock := range netblocks {
+		netblock = canonicalNetblock(netblock)
+		set[netblock.String()] = true
+	}
+	return set
+}
@@ -0,0 +1,55 @@
+package firewall
+
+import (
+	"strings"
+	"testing"
+)
+
+// mustRules returns the rule set described by a JSON config
+func mustRules(t *testing.T, config string) Rules {
+	t.Helper()
+	fw := New()
+	if err := fw.LoadRules(strings.NewReader(config)); err != nil {
+		t.Fatal(err)
+	}
+	return fw.GetRules()
+}
+
+func TestDiffRules(t *testing.T) {
+	old := mustRules(t, `{"paths": {
+		"/removed": {"allow": ["10.0.0.0/8"]},
+		"/modified": {"allow": ["10.0.0.0/8", "192.168.0.0/16"]},
+		"/reordered": {"allow": ["10.0.0.0/8", "172.16.0.0/12"]},
+		"/unchanged": {"allow": ["10.0.0.0/8"]}
+	}}`)
+	new := mustRules(t, `{"paths": {
+		"/added": {"allow": ["198.51.100.0/24"]},
+		"/also_added": {"allow": []},
+		"/modified": {"allow": ["10.0.0.0/8", "203.0.113.0/24", "203.0.113.0/24"]},
+		"/reordered": {"allow": ["172.16.0.0/12", "10.1.2.3/8"]},
+		"/unchanged": {"allow": ["10.0.0.0/8"]}
+	}}`)
+	diff := DiffRules(old, new)
+	if got := strings.Join(diff.Added, " "); got != "/added /also_added" {
+		t.Errorf("got added paths %q, want /added /also_added", got)
+	}
+	if got := strings.Join(diff.Removed, " "); got != "/removed" {
+		t.Errorf("got removed paths %q, want /removed", got)
+	}
+	if len(diff.Modified) != 1 {
+		t.Fatalf("got modified paths %v, want only /modified", diff.Modified)
+	}
+	modified := diff.Modified["/modified"]
+	if got := formatNetblocks(modified.Added); got != "203.0.113.0/24" {
+		t.Errorf("got added netblocks %q, want 203.0.113.0/24", got)
+	}
+	if got := formatNetblocks(modified.Removed); got != "192.168.0.0/16" {
+		t.Errorf("got removed netblocks %q, want 192.168.0.0/16", got)
+	}
+	if diff.Empty() {
+		t.Error("diff with changes reported as empty")
+	}
+	if diff := DiffRules(old, old); !diff.Empty() {
+		t.Errorf("got %+v comparing a rule set with itself, want an empty diff", diff)
+	}
+}
@@ -0,0 +1,44 @@
+package firewall
+
+// DisablePathRule stops enforcing a path's rule, so that the path falls back to the default rule or fail-open
+func (fw *Firewall) DisablePathRule(path string) error {
+	return fw.setPathRuleDisabled(path, true)
+}
+
+// EnablePathRule resumes enforcing a path's rule after DisablePathRule
+func (fw *Firewall) EnablePathRule(path string) error {
+	return fw.setPathRuleDisabled(path, false)
+}
+
+// PathRuleEnabled checks whether a path has a rule which is being enforced
+func (fw *Firewall) PathRuleEnabled(path string) bool {
+	fw.mu.RLock()
+	defer fw.mu.RUnlock()
+
+	_, hasRule := fw.Rules.PathToNetblocks[path]
+	return hasRule && !fw.Rules.DisabledPaths[path]
+}
+
+func (fw *Firewall) setPathRuleDisabled(path string, disabled bool) error {
+	fw.mu.Lock()
+	if _, hasRule := fw.Rules.PathToNetblocks[path]; !hasRule {
+		fw.mu.Unlock()
+		return ErrPathHasNoRule
+	}
+	if disabled {
+		if fw.Rules.DisabledPaths == nil {
+			fw.Rules.DisabledPaths = make(map[string]bool)
+		}
+		fw.Rules.DisabledPaths[path] = true
+	} else {
+		delete(fw.Rules.DisabledPaths, path)
+	}
+	fw.mu.Unlock()
+
+	detail := "enabled"
+	if disabled {
+		detail = "disabled"
+	}
+	fw.ruleChanged(RuleChangeEvent{Action: RuleUpdated, Path: path, Detail: detail})
+	return nil
+}
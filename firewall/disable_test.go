@@ -0,0 +1,71 @@
+package firewall
+
+import (
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestDisablePathRule(t *testing.T) {
+	fw := New()
+	if err := fw.AddPathRule("/admin", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	decide := func(src string) Decision {
+		return fw.Decide(newTestRequest(http.MethodGet, "/admin", src))
+	}
+	if d := decide("198.51.100.1"); d.Reason != ReasonUntrusted {
+		t.Fatalf("got %s before disabling the rule, want untrusted", d.Reason)
+	}
+
+	if err := fw.DisablePathRule("/admin"); err != nil {
+		t.Fatal(err)
+	}
+	if fw.PathRuleEnabled("/admin") {
+		t.Error("disabled rule reported as enabled")
+	}
+	if !fw.HasRule("/admin") {
+		t.Error("disabling the rule removed it")
+	}
+	if d := decide("198.51.100.1"); d.Reason != ReasonNoRule {
+		t.Errorf("got %s with the rule disabled, want no_rule", d.Reason)
+	}
+	fw.Rules.FailOpen = true
+	if d := decide("198.51.100.1"); d.Reason != ReasonFailOpen {
+		t.Errorf("got %s with the rule disabled and failing open, want fail_open", d.Reason)
+	}
+	fw.Rules.FailOpen = false
+	fw.Rules.DefaultNetblocks = []net.IPNet{mustParseCIDR(t, "198.51.100.0/24")}
+	if d := decide("198.51.100.1"); d.Reason != ReasonTrusted || d.Rule != DefaultRule {
+		t.Errorf("got %s by rule %q with the rule disabled, want trusted by the default rule", d.Reason, d.Rule)
+	}
+	if d := decide("10.1.2.3"); d.Reason != ReasonUntrusted {
+		t.Errorf("got %s for a source trusted only by the disabled rule, want untrusted", d.Reason)
+	}
+
+	if err := fw.EnablePathRule("/admin"); err != nil {
+		t.Fatal(err)
+	}
+	if !fw.PathRuleEnabled("/admin") {
+		t.Error("re-enabled rule reported as disabled")
+	}
+	if d := decide("10.1.2.3"); d.Reason != ReasonTrusted || d.Rule != "/admin" {
+		t.Errorf("got %s by rule %q once re-enabled, want trusted by /admin", d.Reason, d.Rule)
+	}
+	if d := decide("198.51.100.1"); d.Reason != ReasonUntrusted {
+		t.Errorf("got %s once re-enabled, want untrusted", d.Reason)
+	}
+}
+
+func TestDisablePathWithoutRule(t *testing.T) {
+	fw := New()
+	if err := fw.DisablePathRule("/admin"); err != ErrPathHasNoRule {
+		t.Errorf("got %v disabling a path without a rule, want ErrPathHasNoRule", err)
+	}
+	if err := fw.EnablePathRule("/admin"); err != ErrPathHasNoRule {
+		t.Errorf("got %v enabling a path without a rule, want ErrPathHasNoRule", err)
+	}
+	if fw.PathRuleEnabled("/admin") {
+		t.Error("path without a rule reported as enabled")
+	}
+}
@@ -0,0 +1,37 @@
+package firewall
+
+import "time"
+
+// RuleChangeAction is the kind of change made to the firewall's rules
+type RuleChangeAction string
+
+const (
+	// RuleAdded is the action of adding a path rule
+	RuleAdded RuleChangeAction = "add"
+	// RuleRemoved is the action of removing a path rule
+	RuleRemoved RuleChangeAction = "remove"
+	// RuleUpdated is the action of modifying an existing path rule, e.g. disabling it or granting temporary access
+	RuleUpdated RuleChangeAction = "update"
+	// RulesReloaded is the action of replacing the whole rule set
+	RulesReloaded RuleChangeAction = "reload"
+)
+
+// RuleChangeEvent describes a change made to the firewall's rules
+type RuleChangeEvent struct {
+	Action RuleChangeAction
+	// Path is the path whose rule changed, empty for reloads
+	Path string
+	// Detail is a human readable description of the change
+	Detail string
+	// Time is when the change was made according to the firewall's clock
+	Time time.Time
+}
+
+// ruleChanged fires the OnRuleChange hook, it must not be called while holding the firewall's lock
+func (fw *Firewall) ruleChanged(event RuleChangeEvent) {
+	if fw.OnRuleChange == nil {
+		return
+	}
+	event.Time = fw.now()
+	fw.OnRuleChange(event)
+}
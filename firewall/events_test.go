@@ -0,0 +1,66 @@
+package firewall
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOnRuleChange(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	fw := New()
+	fw.Now = func() time.Time { return now }
+	var events []RuleChangeEvent
+	fw.OnRuleChange = func(event RuleChangeEvent) {
+		// deadlocks unless the hook is called without holding the lock
+		fw.Info()
+		events = append(events, event)
+	}
+
+	mutations := []struct {
+		name   string
+		mutate func() error
+		want   RuleChangeEvent
+	}{
+		{"add", func() error { return fw.AddPathRule("/admin", []string{"10.0.0.0/8"}) },
+			RuleChangeEvent{Action: RuleAdded, Path: "/admin"}},
+		{"set", func() error { return fw.SetPathRule("/admin", []string{"10.0.0.0/8", "192.168.0.0/16"}) },
+			RuleChangeEvent{Action: RuleUpdated, Path: "/admin", Detail: "set 2 netblocks"}},
+		{"disable", func() error { return fw.DisablePathRule("/admin") },
+			RuleChangeEvent{Action: RuleUpdated, Path: "/admin", Detail: "disabled"}},
+		{"enable", func() error { return fw.EnablePathRule("/admin") },
+			RuleChangeEvent{Action: RuleUpdated, Path: "/admin", Detail: "enabled"}},
+		{"remove", func() error { return fw.RemovePathRule("/admin") },
+			RuleChangeEvent{Action: RuleRemoved, Path: "/admin"}},
+		{"reload", func() error { return fw.LoadRules(strings.NewReader(`{"paths": {"/a": {"allow": ["10.0.0.0/8"]}}}`)) },
+			RuleChangeEvent{Action: RulesReloaded}},
+		{"replace", func() error { return fw.ReplaceRules(fw.GetRules()) },
+			RuleChangeEvent{Action: RulesReloaded}},
+	}
+	for _, mutation := range mutations {
+		events = nil
+		if err := mutation.mutate(); err != nil {
+			t.Fatalf("%s: %s", mutation.name, err)
+		}
+		if len(events) != 1 {
+			t.Errorf("%s: got events %+v, want exactly one", mutation.name, events)
+			continue
+		}
+		want := mutation.want
+		want.Time = now
+		if got := events[0]; got.Action != want.Action || got.Path != want.Path || got.Detail != want.Detail || !got.Time.Equal(want.Time) {
+			t.Errorf("%s: got event %+v, want %+v", mutation.name, got, want)
+		}
+	}
+
+	events = nil
+	if err := fw.RemovePathRule("/nothing"); err == nil {
+		t.Fatal("removed a path without a rule")
+	}
+	if err := fw.AddPathRule("/a", []string{"not a cidr"}); err == nil {
+		t.Fatal("added a rule with an invalid netblock")
+	}
+	if len(events) != 0 {
+		t.Errorf("failed mutations fired events %+v", events)
+	}
+}
@@ -0,0 +1,76 @@
+package firewall
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Candidate is a rule which could evaluate a request, see Explain
+type Candidate struct {
+	// Rule is the key of the rule: a request URI, a path, or DefaultRule
+	Rule string
+	// Registered is true when the rule exists
+	Registered bool
+	// Applies is true when the rule exists, is enabled and applies to the request's method
+	Applies bool
+}
+
+// Explanation describes how the firewall evaluates a request
+type Explanation struct {
+	// Candidates are the rules which could evaluate the request, most specific
+	// first. Only the first one which applies is evaluated
+	Candidates []Candidate
+	// Decision is the firewall's decision for the request
+	Decision Decision
+}
+
+/*Explain describes which rule the firewall evaluates a request with, and why, along
+* with the resulting decision. Rules are considered most specific first (request URI,
+* path, default) and only the first which applies is evaluated, so conditions such as
+* a Resolver on a broader rule are never consulted when a more specific rule exists.
+* The request is not counted towards rate limits
+ */
+func (fw *Firewall) Explain(r *http.Request) Explanation {
+	d := fw.decide(r, false)
+
+	fw.mu.RLock()
+	defer fw.mu.RUnlock()
+
+	var candidates []Candidate
+	path := fw.normalizePath(requestPath(r))
+	if r.URL.RawQuery != "" {
+		uri := path + "?" + r.URL.RawQuery
+		_, registered := fw.Rules.PathToNetblocks[uri]
+		registered = registered && fw.Rules.PathToOptions[uri].MatchRequestURI
+		candidates = append(candidates, Candidate{Rule: uri, Registered: registered, Applies: registered && fw.ruleApplies(uri, r.Method)})
+	}
+	_, registered := fw.Rules.PathToNetblocks[path]
+	candidates = append(candidates, Candidate{Rule: path, Registered: registered, Applies: registered && fw.ruleApplies(path, r.Method)})
+	hasDefault := len(fw.Rules.DefaultNetblocks) > 0
+	candidates = append(candidates, Candidate{Rule: DefaultRule, Registered: hasDefault, Applies: hasDefault})
+	return Explanation{Candidates: candidates, Decision: d}
+}
+
+// String describes the explanation in a single line
+func (e Explanation) String() string {
+	var candidates []string
+	for _, c := range e.Candidates {
+		state := "not registered"
+		if c.Applies {
+			state = "applies"
+		} else if c.Registered {
+			state = "does not apply"
+		}
+		candidates = append(candidates, fmt.Sprintf("%s (%s)", c.Rule, state))
+	}
+	rule := e.Decision.Rule
+	if rule == "" {
+		rule = "none"
+	}
+	verdict := "blocked"
+	if e.Decision.Allowed {
+		verdict = "allowed"
+	}
+	return fmt.Sprintf("candidates: %s; rule: %s; %s: %s", strings.Join(candidates, ", "), rule, verdict, e.Decision.Reason)
+}
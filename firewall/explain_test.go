@@ -0,0 +1,70 @@
+package firewall
+
+import (
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestRequestURIRuleWhichDoesNotApplyFallsBackToPathRule(t *testing.T) {
+	fw := New()
+	// sources which fall through to the default rule would be allowed
+	fw.Rules.DefaultNetblocks = []net.IPNet{mustParseCIDR(t, "203.0.113.0/24")}
+	if err := fw.AddPathRule("/admin", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.AddRequestURIRule("/admin?debug=1", []string{"203.0.113.0/24"}, PathOptions{Methods: []string{http.MethodPost}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.AddRequestURIRule("/admin?off=1", []string{"203.0.113.0/24"}, PathOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.DisablePathRule("/admin?off=1"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method, target, src string
+		allowed             bool
+		rule                string
+		reason              Reason
+	}{
+		{http.MethodPost, "/admin?debug=1", "203.0.113.9", true, "/admin?debug=1", ReasonTrusted},
+		{http.MethodGet, "/admin?debug=1", "203.0.113.9", false, "/admin", ReasonUntrusted},
+		{http.MethodGet, "/admin?debug=1", "10.1.2.3", true, "/admin", ReasonTrusted},
+		{http.MethodGet, "/admin?off=1", "203.0.113.9", false, "/admin", ReasonUntrusted},
+		{http.MethodGet, "/admin", "203.0.113.9", false, "/admin", ReasonUntrusted},
+	}
+	for _, test := range tests {
+		d := fw.Decide(newTestRequest(test.method, test.target, test.src))
+		if d.Allowed != test.allowed || d.Rule != test.rule || d.Reason != test.reason {
+			t.Errorf("%s %s from %s: got allowed=%t rule=%q reason=%s, want allowed=%t rule=%q reason=%s",
+				test.method, test.target, test.src, d.Allowed, d.Rule, d.Reason, test.allowed, test.rule, test.reason)
+		}
+	}
+}
+
+func TestExplainMatchesEvaluatedRule(t *testing.T) {
+	fw := New()
+	if err := fw.AddPathRule("/admin", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.AddRequestURIRule("/admin?debug=1", []string{"203.0.113.0/24"}, PathOptions{Methods: []string{http.MethodPost}}); err != nil {
+		t.Fatal(err)
+	}
+
+	e := fw.Explain(newTestRequest(http.MethodGet, "/admin?debug=1", "203.0.113.9"))
+	var applies string
+	for _, c := range e.Candidates {
+		if c.Applies {
+			applies = c.Rule
+			break
+		}
+	}
+	if applies != "/admin" || e.Decision.Rule != applies {
+		t.Fatalf("first applicable candidate %q, evaluated rule %q: %s", applies, e.Decision.Rule, e)
+	}
+	if e.Candidates[0].Applies || !e.Candidates[0].Registered {
+		t.Errorf("request URI rule scoped to POST reported as %+v", e.Candidates[0])
+	}
+}
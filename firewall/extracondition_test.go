@@ -0,0 +1,82 @@
+package firewall
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestExtraCondition(t *testing.T) {
+	calls := 0
+	opts := PathOptions{
+		UserAgent: "^agent$",
+		ExtraCondition: func(r *http.Request) bool {
+			calls++
+			return r.Header.Get("X-Tenant") == "acme"
+		},
+	}
+	fw := New()
+	if err := fw.AddPathRuleWithOptions("/tenant", []string{"10.0.0.0/8"}, opts); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		src, userAgent, tenant string
+		allowed, evaluated     bool
+	}{
+		{"10.1.2.3", "agent", "acme", true, true},
+		{"10.1.2.3", "agent", "other", false, true},
+		{"10.1.2.3", "agent", "", false, true},
+		// evaluated last: not for untrusted sources, nor when another condition fails
+		{"198.51.100.1", "agent", "acme", false, false},
+		{"10.1.2.3", "curl/8.0", "acme", false, false},
+	}
+	for _, test := range tests {
+		calls = 0
+		r := newTestRequest(http.MethodGet, "/tenant", test.src)
+		r.Header.Set("User-Agent", test.userAgent)
+		r.Header.Set("X-Tenant", test.tenant)
+		d := fw.Decide(r)
+		if d.Allowed != test.allowed {
+			t.Errorf("%s, %q, tenant %q: got %s, want allowed=%t", test.src, test.userAgent, test.tenant, d.Reason, test.allowed)
+		}
+		if !test.allowed && d.Reason != ReasonUntrusted {
+			t.Errorf("%s, %q, tenant %q: got %s, want untrusted", test.src, test.userAgent, test.tenant, d.Reason)
+		}
+		if evaluated := calls > 0; evaluated != test.evaluated {
+			t.Errorf("%s, %q, tenant %q: condition evaluated=%t, want %t", test.src, test.userAgent, test.tenant, evaluated, test.evaluated)
+		}
+	}
+}
+
+func TestSlowExtraConditionDoesNotHoldLock(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	opts := PathOptions{ExtraCondition: func(r *http.Request) bool {
+		close(started)
+		<-release
+		return true
+	}}
+	fw := New()
+	if err := fw.AddPathRuleWithOptions("/slow", []string{"10.0.0.0/8"}, opts); err != nil {
+		t.Fatal(err)
+	}
+	decided := make(chan Decision)
+	go func() { decided <- fw.Decide(newTestRequest(http.MethodGet, "/slow", "10.1.2.3")) }()
+	<-started
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := fw.AddPathRule("/new", []string{"10.0.0.0/8"}); err != nil {
+			t.Error(err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a slow condition blocked rule changes")
+	}
+	close(release)
+	if d := <-decided; !d.Allowed {
+		t.Errorf("got %s once the condition returned, want allowed", d.Reason)
+	}
+}
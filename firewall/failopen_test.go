@@ -0,0 +1,91 @@
+package firewall
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestFailOpenOnlyAppliesToPathsWithoutRule pins that failing open never lets untrusted sources through to paths with a rule
+func TestFailOpenOnlyAppliesToPathsWithoutRule(t *testing.T) {
+	configure := map[string]func(fw *Firewall){
+		"FailOpen":       func(fw *Firewall) { fw.Rules.FailOpen = true },
+		"MethodFailOpen": func(fw *Firewall) { fw.Rules.MethodFailOpen = map[string]bool{"get": true} },
+		"FailOpenWhen":   func(fw *Firewall) { fw.FailOpenWhen = func() bool { return true } },
+	}
+	for name, failOpen := range configure {
+		fw := New()
+		failOpen(fw)
+		if err := fw.AddPathRule("/admin", []string{"10.0.0.0/8"}); err != nil {
+			t.Fatal(err)
+		}
+		tests := []struct {
+			path, src string
+			reason    Reason
+		}{
+			{"/admin", "10.1.2.3", ReasonTrusted},
+			{"/admin", "198.51.100.1", ReasonUntrusted},
+			{"/public", "198.51.100.1", ReasonFailOpen},
+		}
+		for _, test := range tests {
+			if d := fw.Decide(newTestRequest(http.MethodGet, test.path, test.src)); d.Reason != test.reason {
+				t.Errorf("%s: %s from %s: got %s, want %s", name, test.path, test.src, d.Reason, test.reason)
+			}
+		}
+	}
+
+	fw := New()
+	fw.Rules.MethodFailOpen = map[string]bool{http.MethodPost: false}
+	fw.Rules.FailOpen = true
+	if d := fw.Decide(newTestRequest(http.MethodPost, "/public", "198.51.100.1")); d.Reason != ReasonNoRule {
+		t.Errorf("got %s for a method which fails closed, want no_rule", d.Reason)
+	}
+}
+
+func TestFailOpenWhen(t *testing.T) {
+	fw := New()
+	healthy := false
+	fw.FailOpenWhen = func() bool { return healthy }
+	// FailOpenWhen takes precedence over FailOpen
+	fw.Rules.FailOpen = true
+	if d := fw.Decide(newTestRequest(http.MethodGet, "/public", "198.51.100.1")); d.Reason != ReasonNoRule {
+		t.Errorf("got %s while the callback reports false, want no_rule", d.Reason)
+	}
+	healthy = true
+	if d := fw.Decide(newTestRequest(http.MethodGet, "/public", "198.51.100.1")); d.Reason != ReasonFailOpen {
+		t.Errorf("got %s while the callback reports true, want fail_open", d.Reason)
+	}
+}
+
+func TestMethodFailOpen(t *testing.T) {
+	fw := New()
+	// reads fail open, writes fail closed, whatever FailOpenWhen says
+	err := fw.LoadRules(strings.NewReader(`{"method_fail_open": {"GET": true, "head": true, "POST": false, "PUT": false, "DELETE": false}, "paths": {"/admin": {"allow": ["10.0.0.0/8"]}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.FailOpenWhen = func() bool { return true }
+	tests := []struct {
+		method, path string
+		reason       Reason
+	}{
+		{http.MethodGet, "/unregistered", ReasonFailOpen},
+		{http.MethodHead, "/unregistered", ReasonFailOpen},
+		{http.MethodPost, "/unregistered", ReasonNoRule},
+		{http.MethodPut, "/unregistered", ReasonNoRule},
+		{"delete", "/unregistered", ReasonNoRule},
+		// methods which aren't listed fall back to FailOpenWhen
+		{http.MethodPatch, "/unregistered", ReasonFailOpen},
+		// paths with a rule never fail open
+		{http.MethodGet, "/admin", ReasonUntrusted},
+	}
+	for _, test := range tests {
+		if d := fw.Decide(newTestRequest(test.method, test.path, "198.51.100.1")); d.Reason != test.reason {
+			t.Errorf("%s %s: got %s, want %s", test.method, test.path, d.Reason, test.reason)
+		}
+	}
+	fw.FailOpenWhen = nil
+	if d := fw.Decide(newTestRequest(http.MethodPatch, "/unregistered", "198.51.100.1")); d.Reason != ReasonNoRule {
+		t.Errorf("got %s for an unlisted method, want FailOpen's no_rule", d.Reason)
+	}
+}
@@ -4,23 +4,208 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"math/rand"
 	"net"
 	"net/http"
-	"strings"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Firewall is a software defined, endpoint-selective firewall for HTTP servers
 type Firewall struct {
 	Rules Rules
 	Log   bool
+	// AllowedLogSampleRate is the fraction (0 to 1) of allowed requests which
+	// are logged, regardless of Log. Sampling uses SampleRand, which defaults
+	// to math/rand's Float64 and must be safe for concurrent use
+	AllowedLogSampleRate float64
+	SampleRand           func() float64
+	// LogFormat is the format of the lines logged for allowed and blocked
+	// requests. Lines in LogFormatCommon and LogFormatCombined are written to the
+	// standard logger without the "[FIREWALL] " prefix, clear its flags (see
+	// log.SetFlags) for lines log tooling can parse as is
+	LogFormat LogFormat
+	// BlockPathTraversal rejects requests with ".." path segments, in plain
+	// or percent-encoded form, with a 400 before any rule is evaluated
+	BlockPathTraversal bool
+	// CollapseSlashes collapses consecutive slashes in the request path, and
+	// ResolveDotSegments resolves "." and ".." segments, before rules are
+	// looked up. The path received by the wrapped handler is left untouched
+	CollapseSlashes    bool
+	ResolveDotSegments bool
+	// BlockStatus and BlockBody replace the default 403 "Forbidden" response
+	// written for requests denied by the rules, e.g. a 404 "Not Found" makes
+	// protected paths indistinguishable from non-existent ones
+	BlockStatus int
+	BlockBody   string
+	// ReasonStatus overrides the status code written for requests blocked for
+	// the given reasons, taking precedence over BlockStatus. By default bans
+	// and rate limits get a 429, with a Retry-After header when the ban's
+	// expiry is known, as opposed to the 403 of access denials
+	ReasonStatus map[Reason]int
+	// ProblemJSON writes blocked responses as RFC 7807 application/problem+json
+	// bodies. The detail member only names the blocked path when
+	// ProblemDetailIncludesPath is set
+	ProblemJSON               bool
+	ProblemDetailIncludesPath bool
+	// BlockHeaders are set on every blocked response. When BlockReasonHeader
+	// is set, a header by that name carrying the decision's Reason (e.g.
+	// "untrusted") is also set, no reason is disclosed by default
+	BlockHeaders      http.Header
+	BlockReasonHeader string
+	// Listener labels the listener the firewall guards (e.g. "internal"), it
+	// is matched against PathOptions.Listeners. See ListenerName
+	Listener string
+	// RejectSpoofedSources rejects requests from the public internet claiming a
+	// private, loopback or otherwise unroutable source, whether as their resolved
+	// client IP or in forwarding headers from an untrusted peer, with a 403 and
+	// logs them. Requests count as from the public internet when their peer is
+	// a public address which isn't one of the TrustedProxies, or when they arrive
+	// on one of PublicListeners (see ListenerName), which catches bogus peers.
+	// Clients behind proxies which add their private address to X-Forwarded-For
+	// without being trusted are rejected too
+	RejectSpoofedSources bool
+	PublicListeners      []string
+	// AllowPreflight lets CORS preflight requests (OPTIONS requests with an
+	// Access-Control-Request-Method header) through regardless of the path's
+	// rule, so that browsers can go on to make the actual, still gated, request.
+	// Deny lists, bans and rate limits still apply. PreflightHandler, when set,
+	// answers preflights instead of the wrapped handler
+	AllowPreflight   bool
+	PreflightHandler http.Handler
+	// RequireTLS rejects plaintext requests to every path with a 426, see IsTLS
+	RequireTLS bool
+	// TrustedProxies are the netblocks of proxies whose forwarding headers
+	// (e.g. X-Forwarded-For and X-Forwarded-Proto) are believed. MaxProxyHops,
+	// when set, bounds how many forwarded hops are walked, see ClientIP
+	TrustedProxies []net.IPNet
+	MaxProxyHops   int
+	// TrustLocalhost trusts loopback sources, and TrustPrivateRanges trusts
+	// RFC 1918 and RFC 4193 (ULA) sources, on every path in addition to the
+	// path's rule. Deny lists still apply. Meant for local development
+	TrustLocalhost     bool
+	TrustPrivateRanges bool
+	// FailClosedOnResolverError blocks requests when a path's Resolver fails,
+	// rather than treating the source as not matched. New and NewFirewall
+	// enable it
+	FailClosedOnResolverError bool
+	// RateLimit is the maximum number of requests allowed per source IP
+	// within RateWindow (one minute by default), zero disables rate limiting
+	RateLimit  int
+	RateWindow time.Duration
+	// BanDuration is how long a source IP exceeding RateLimit is banned for
+	BanDuration time.Duration
+	// Limiter and BanStore back rate limits and bans. They default to in-memory
+	// stores, which are not shared across processes
+	Limiter  Limiter
+	BanStore BanStore
+	// FailOpenWhen, when set, is consulted for requests to paths without a rule
+	// instead of Rules.FailOpen, e.g. to fail open only while a circuit breaker
+	// reports that doing so is safe
+	FailOpenWhen func() bool
+	// OnRuleChange, when set, is called after every change to the rules, e.g.
+	// to keep an audit trail. It is called without holding the firewall's lock
+	OnRuleChange func(event RuleChangeEvent)
+	// DecisionHeader, when set, names a header set on requests Wrap lets through
+	// to tell backends the firewall allowed them, any value sent by the client
+	// is removed. With DecisionSecret set the value is signed, see
+	// VerifyDecisionHeader
+	DecisionHeader string
+	DecisionSecret []byte
+	// WhoAmIReasons makes WhoAmIHandler disclose the reasons of decisions, e.g.
+	// no_rule or untrusted, rather than only whether they allow the caller. The
+	// reasons tell which paths have a rule, so only set it when the handler is
+	// itself restricted by a rule
+	WhoAmIReasons bool
+	// OnResponse, when set, is called once Wrap has responded to a request, with
+	// the decision, the response's status code and the number of body bytes
+	// written, whether by the wrapped handler or as the block response
+	OnResponse func(d Decision, status int, bytes int64)
+	// Tracer, when set, is handed every decision made by Wrap
+	Tracer Tracer
+	// RecoverPanics recovers from panics in the wrapped handler, responding
+	// with a 500, after the firewall's resources (e.g. MaxConcurrent slots)
+	// are released. With RePanic set the panic is raised again instead
+	RecoverPanics bool
+	RePanic       bool
+	// Learn records the sources of the requests Wrap sees for each path, to be
+	// turned into rules with SuggestRules. Sources are summarized to netblocks of
+	// LearnIPv4PrefixLength and LearnIPv6PrefixLength bits, by default the ones of
+	// HostNetblock, and at most MaxLearnedSources are kept. Learning does not
+	// change decisions, combine it with FailOpen to observe without enforcing
+	Learn                 bool
+	LearnIPv4PrefixLength int
+	LearnIPv6PrefixLength int
+	MaxLearnedSources     int
+	// MaxRules, when set, is the maximum number of paths with a rule or a deny
+	// list. Adding or loading rules beyond it fails with ErrTooManyRules and
+	// leaves the existing rules untouched. It is deliberately not part of the
+	// exported Config, so that a config can't lift the cap guarding its import
+	MaxRules int
+	// DecisionCacheSize, when set, caches up to that many lookups of source IPs
+	// in deny lists and rules' trusted netblocks, see WarmCache. Cached lookups
+	// are invalidated when rules are added, removed or replaced; rules modified
+	// directly through the Rules field are not noticed
+	DecisionCacheSize int
+	// MaxRuleAge, when set, makes Healthy report rules which were not reloaded
+	// within it as stale
+	MaxRuleAge time.Duration
+	// Now returns the current time, it defaults to time.Now when nil
+	Now func() time.Time
+
+	mu             sync.RWMutex
+	lastReload     time.Time
+	reloadErr      error
+	version        uint64
+	cacheOnce      sync.Once
+	cache          *ResolverCache
+	denyTreeMu     sync.Mutex
+	globalDenyTree atomic.Pointer[denyTree]
+	rateMeter      rateMeter
+	requestCounts  requestCounts
+	learnedMu      sync.Mutex
+	learned        learnedSources
+	layers         map[int]RulesConfig
+	groups         map[string][]net.IPNet
+	groupRefs      map[string]groupRef
+	bypasses       map[string]time.Time
+	semaphoresMu   sync.Mutex
+	semaphores     map[string]chan struct{}
+	storesOnce     sync.Once
+	memoryLimiter  *MemoryLimiter
+	memoryBanStore *MemoryBanStore
 }
 
 /*Rules represents the rules that the software defined firewall will
-* accept or accept traffic
+* accept or accept traffic. Rules are evaluated with the following precedence:
+* - deny: sources in DeniedNetblocks or the path's denied netblocks are blocked
+* - allow: sources in the path's trusted netblocks are allowed
+* - default: paths without a rule use DefaultNetblocks and DefaultOptions, when there are any
+* - fail-open: paths without any rule are allowed only when failing open, which
+*   is decided by MethodFailOpen for the request's method when it lists it, then
+*   by the firewall's FailOpenWhen when set, and by FailOpen otherwise. Requests
+*   to paths with a rule never fail open
+* DeniedNetblocks is indexed for lookups when it is assigned: changes made in
+* place to a firewall's list only take effect once its rules are replaced, e.g.
+* with ReplaceRules
  */
 type Rules struct {
-	PathToNetblocks map[string][]net.IPNet
-	FailOpen        bool
+	PathToNetblocks       map[string][]net.IPNet
+	PathToDeniedNetblocks map[string][]net.IPNet
+	PathToOptions         map[string]PathOptions
+	PathToGrants          map[string][]Grant
+	DisabledPaths         map[string]bool
+	DeniedNetblocks       []net.IPNet
+	DefaultNetblocks      []net.IPNet
+	DefaultOptions        PathOptions
+	FailOpen              bool
+	// MethodFailOpen sets whether requests with a given method (e.g. "POST")
+	// to paths without a rule fail open, e.g. to let reads fail open while
+	// writes always fail closed. Methods are matched case-insensitively
+	MethodFailOpen map[string]bool
 }
 
 var (
@@ -28,70 +213,368 @@ var (
 	ErrPathHasRule = errors.New("path already has an associated list of trusted netblocks")
 	// ErrCouldNotParseCIDR will be returned when the developer attempts to use an invalid CIDR for a rule
 	ErrCouldNotParseCIDR = fmt.Errorf("could not parse CIDR")
+	// ErrInvalidNetblock will be returned when the developer attempts to use an empty, malformed or duplicate net.IPNet for a rule
+	ErrInvalidNetblock = errors.New("invalid netblock")
 	// ErrCouldNotReadSrc will be returned when the IP can't be determined from the http.Request
 	ErrCouldNotReadSrc = errors.New("could not get source IP from http request")
+	// ErrPathHasNoRule will be returned when the developer attempts to modify the rule of a path without one
+	ErrPathHasNoRule = errors.New("path does not have an associated list of trusted netblocks")
+	// ErrTooManyRules will be returned when adding or loading rules would exceed the firewall's MaxRules
+	ErrTooManyRules = errors.New("too many rules")
+	// ErrCouldNotParseUserAgent will be returned when the developer attempts to use an invalid User-Agent pattern for a rule
+	ErrCouldNotParseUserAgent = errors.New("could not parse User-Agent pattern")
 )
 
 // New is the no-argument constructor for the firewall object
 func New() *Firewall {
 	return &Firewall{
 		Rules: Rules{
-			FailOpen: false,
+			PathToNetblocks:       make(map[string][]net.IPNet),
+			PathToDeniedNetblocks: make(map[string][]net.IPNet),
+			PathToOptions:         make(map[string]PathOptions),
+			PathToGrants:          make(map[string][]Grant),
+			FailOpen:              false,
 		},
+		FailClosedOnResolverError: true,
+		lastReload:                time.Now(),
 	}
 }
 
 /*NewFirewall is the constructor for the firewall object given a rule map and two boleans:
 * failOpen: - false (default) to drop all requests for paths with an undefined trusted netblock
-*           - true to allow all traffic to such paths
+*           - true to allow all traffic to such paths, requests to paths with a
+*             rule are still only allowed from its trusted netblocks
 * log: true to log all dropped requests
  */
 func NewFirewall(rules map[string][]net.IPNet, failOpen, log bool) *Firewall {
 	return &Firewall{
 		Rules: Rules{
-			PathToNetblocks: rules,
-			FailOpen:        failOpen,
+			PathToNetblocks:       rules,
+			PathToDeniedNetblocks: make(map[string][]net.IPNet),
+			PathToOptions:         make(map[string]PathOptions),
+			PathToGrants:          make(map[string][]Grant),
+			FailOpen:              failOpen,
 		},
-		Log: log,
+		Log:                       log,
+		FailClosedOnResolverError: true,
+		lastReload:                time.Now(),
 	}
 }
 
-// AddPathRule maps a list of trusted netblocks to a given path
+// AddPathRule maps a list of trusted netblocks to a given path, networks may reference groups, see DefineGroup
 func (fw *Firewall) AddPathRule(path string, networks []string) error {
+	return fw.AddPathRuleWithOptions(path, networks, PathOptions{})
+}
+
+// AddPathRuleWithOptions maps a list of trusted netblocks to a given path along
+// with additional conditions which must also hold for a request to be allowed
+func (fw *Firewall) AddPathRuleWithOptions(path string, networks []string, opts PathOptions) error {
+	// parse network CIDRs
+	trusted, groups, err := parseNetworks(networks)
+	if err != nil {
+		return err
+	}
+	if err := opts.compile(); err != nil {
+		return err
+	}
+	if err := fw.addPathRule(path, trusted, groups, opts); err != nil {
+		return err
+	}
+	fw.ruleChanged(RuleChangeEvent{Action: RuleAdded, Path: path})
+	return nil
+}
+
+func (fw *Firewall) addPathRule(path string, trusted []net.IPNet, groups []string, opts PathOptions) error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
 	if _, exists := fw.Rules.PathToNetblocks[path]; exists {
 		return ErrPathHasRule
 	}
-	// parse network CIDRs
-	var trusted []net.IPNet
-	for _, network := range networks {
-		_, trustedNetblock, err := net.ParseCIDR(network)
-		if err != nil {
-			return fmt.Errorf("could not parse CIDR: %s", err)
+	if _, denied := fw.Rules.PathToDeniedNetblocks[path]; !denied {
+		if err := fw.checkRuleCount(ruleCount(fw.Rules) + 1); err != nil {
+			return err
+		}
+	}
+	expanded, err := fw.expandGroups(trusted, groups)
+	if err != nil {
+		return err
+	}
+	// add trusted netblocks and options to path
+	if fw.Rules.PathToNetblocks == nil {
+		fw.Rules.PathToNetblocks = make(map[string][]net.IPNet)
+	}
+	if fw.Rules.PathToOptions == nil {
+		fw.Rules.PathToOptions = make(map[string]PathOptions)
+	}
+	fw.Rules.PathToNetblocks[path] = expanded
+	fw.Rules.PathToOptions[path] = opts
+	fw.setGroupRefs(path, trusted, groups)
+	fw.version++
+	return nil
+}
+
+/*SetPathRule atomically sets the complete list of trusted netblocks of a path,
+* replacing any existing ones while keeping the path's options, or adds a rule
+* for the path when it has none. Setting the netblocks a path already has, in any
+* order, changes nothing and fires no OnRuleChange event. Networks may reference
+* groups, see DefineGroup
+ */
+func (fw *Firewall) SetPathRule(path string, networks []string) error {
+	netblocks, groups, err := parseNetworks(networks)
+	if err != nil {
+		return err
+	}
+
+	fw.mu.Lock()
+	trusted, err := fw.expandGroups(netblocks, groups)
+	if err != nil {
+		fw.mu.Unlock()
+		return err
+	}
+	current, exists := fw.Rules.PathToNetblocks[path]
+	if exists && NetblocksEqual(current, trusted) {
+		fw.setGroupRefs(path, netblocks, groups)
+		fw.mu.Unlock()
+		return nil
+	}
+	if !exists {
+		if _, denied := fw.Rules.PathToDeniedNetblocks[path]; !denied {
+			if err := fw.checkRuleCount(ruleCount(fw.Rules) + 1); err != nil {
+				fw.mu.Unlock()
+				return err
+			}
+		}
+		if fw.Rules.PathToNetblocks == nil {
+			fw.Rules.PathToNetblocks = make(map[string][]net.IPNet)
 		}
-		trusted = append(trusted, *trustedNetblock)
 	}
-	// add trusted netblocks to path
 	fw.Rules.PathToNetblocks[path] = trusted
+	fw.setGroupRefs(path, netblocks, groups)
+	fw.version++
+	fw.mu.Unlock()
+
+	if !exists {
+		fw.ruleChanged(RuleChangeEvent{Action: RuleAdded, Path: path})
+		return nil
+	}
+	fw.ruleChanged(RuleChangeEvent{Action: RuleUpdated, Path: path, Detail: fmt.Sprintf("set %d netblocks", len(trusted))})
+	return nil
+}
+
+/*AddRequestURIRule maps a list of trusted netblocks to a request URI, i.e. a path
+* and a query such as "/callback?sig=abc". The rule applies to requests whose
+* path, after the firewall's path normalization, equals the URI's decoded path
+* and whose raw query, still percent-encoded, equals the URI's exactly; the order
+* of query parameters is significant. Requests to the path with any other query
+* are evaluated by the path's own rule, if any
+ */
+func (fw *Firewall) AddRequestURIRule(requestURI string, networks []string, opts PathOptions) error {
+	u, err := url.ParseRequestURI(requestURI)
+	if err != nil {
+		return fmt.Errorf("could not parse request URI: %s", err)
+	}
+	if u.RawQuery == "" {
+		return fmt.Errorf("request URI %s has no query, use AddPathRule", requestURI)
+	}
+	opts.MatchRequestURI = true
+	return fw.AddPathRuleWithOptions(u.Path+"?"+u.RawQuery, networks, opts)
+}
+
+// RemovePathRule removes the trusted netblocks and options associated to a given path
+func (fw *Firewall) RemovePathRule(path string) error {
+	fw.mu.Lock()
+	if _, exists := fw.Rules.PathToNetblocks[path]; !exists {
+		fw.mu.Unlock()
+		return ErrPathHasNoRule
+	}
+	delete(fw.Rules.PathToNetblocks, path)
+	delete(fw.Rules.PathToOptions, path)
+	delete(fw.Rules.DisabledPaths, path)
+	delete(fw.groupRefs, path)
+	fw.version++
+	fw.mu.Unlock()
+
+	fw.ruleChanged(RuleChangeEvent{Action: RuleRemoved, Path: path})
 	return nil
 }
 
+// now returns the current time according to the firewall's clock
+func (fw *Firewall) now() time.Time {
+	if fw.Now != nil {
+		return fw.Now()
+	}
+	return time.Now()
+}
+
 // Wrap the firewall around an HTTP handler function
 func (fw *Firewall) Wrap(h func(http.ResponseWriter, *http.Request)) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// extract IP from http.Request
-		srcIP := net.ParseIP(strings.Split(r.RemoteAddr, ":")[0])
-		// get rule for path
-		rule, hasRule := fw.Rules.PathToNetblocks[r.URL.Path]
-		authorized := (hasRule && IPIsTrusted(rule, srcIP)) || (fw.Rules.FailOpen)
-		if !authorized {
-			log.Println(fmt.Sprintf("[FIREWALL] blocked request from %s for %s", srcIP.String(), r.URL.Path))
-			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		d := fw.decide(r, true)
+		fw.trace(r.Context(), d)
+		fw.learn(d)
+		w := newCountingWriter(rw)
+		// reported once the response is complete, even if the handler panics
+		defer func() { fw.responded(r, d, w) }()
+		if !d.Allowed && d.onUntrusted != nil {
+			fw.setDecisionHeader(r, d)
+			d.onUntrusted(w, r)
+			return
+		}
+		if !d.Allowed {
+			fw.block(w, r, d)
 			return
 		}
+		if d.preflight != nil {
+			d.preflight.ServeHTTP(w, r)
+			return
+		}
+		if d.maxConcurrent > 0 {
+			release, ok := fw.acquire(d.Rule, d.maxConcurrent)
+			if !ok {
+				fw.mu.RLock()
+				d = fw.decided(d, ReasonTooManyInFlight)
+				fw.mu.RUnlock()
+				fw.block(w, r, d)
+				return
+			}
+			// released even if the handler panics
+			defer release()
+		}
+		if d.recoverPanics {
+			// registered after release so that it runs before it
+			defer fw.recoverPanic(w, r, d)
+		}
+		fw.setDecisionHeader(r, d)
+		if d.maxBodyBytes > 0 {
+			// enforce the limit on bodies without a Content-Length, e.g. chunked ones
+			r.Body = http.MaxBytesReader(w, r.Body, d.maxBodyBytes)
+		}
 		h(w, r)
 	})
 }
 
+/*recoverPanic recovers from a panic in the wrapped handler, once the firewall's
+* deferred cleanup has been registered, and either responds with a 500 or, when
+* RePanic is set, panics again. http.ErrAbortHandler is always re-raised
+ */
+func (fw *Firewall) recoverPanic(w http.ResponseWriter, r *http.Request, d Decision) {
+	rec := recover()
+	if rec == nil {
+		return
+	}
+	if d.rePanic || rec == http.ErrAbortHandler {
+		panic(rec)
+	}
+	log.Printf("[FIREWALL] recovered from panic serving %s for %s: %v", d.SrcIP.String(), d.Path, rec)
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
+
+// block writes the response for a request the firewall did not allow
+func (fw *Firewall) block(w http.ResponseWriter, r *http.Request, d Decision) {
+	// copy the response settings so that the response is written without holding the lock
+	fw.mu.RLock()
+	headers := fw.BlockHeaders
+	reasonHeader := fw.BlockReasonHeader
+	problemJSON, includePath := fw.ProblemJSON, fw.ProblemDetailIncludesPath
+	body := http.StatusText(d.Status)
+	if fw.BlockBody != "" && d.Reason.accessDenied() {
+		body = fw.BlockBody
+	}
+	fw.mu.RUnlock()
+
+	for name, values := range headers {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+	if reasonHeader != "" {
+		w.Header().Set(reasonHeader, d.Reason.String())
+	}
+	if d.Status == http.StatusUpgradeRequired {
+		// RFC 9110 requires 426 responses to list the protocols to upgrade to
+		w.Header().Set("Upgrade", "TLS/1.2, HTTP/1.1")
+		w.Header().Set("Connection", "Upgrade")
+	}
+	if d.retryAfter > 0 {
+		// whole seconds, rounded up so that clients don't retry while still banned
+		w.Header().Set("Retry-After", strconv.FormatInt(int64((d.retryAfter+time.Second-1)/time.Second), 10))
+	}
+	if problemJSON {
+		writeProblem(w, d, includePath)
+	} else {
+		http.Error(w, body, d.Status)
+	}
+
+	fw.mu.RLock()
+	if fw.Log {
+		fw.logResponse(r, d, d.Status, bytesWritten(w))
+	}
+	fw.mu.RUnlock()
+}
+
+// logAllowed logs an allowed request, along with the bytes written in response, when it is sampled by AllowedLogSampleRate
+func (fw *Firewall) logAllowed(r *http.Request, d Decision, status int, bytes int64) {
+	fw.mu.RLock()
+	rate, sample := fw.AllowedLogSampleRate, fw.SampleRand
+	fw.mu.RUnlock()
+
+	if rate <= 0 {
+		return
+	}
+	if sample == nil {
+		sample = rand.Float64
+	}
+	if rate >= 1 || sample() < rate {
+		fw.mu.RLock()
+		fw.logResponse(r, d, status, bytes)
+		fw.mu.RUnlock()
+	}
+}
+
+// logResponse logs a response to a request in the firewall's LogFormat, regardless of Log. The firewall's lock must be held
+func (fw *Firewall) logResponse(r *http.Request, d Decision, status int, bytes int64) {
+	if fw.LogFormat == LogFormatCommon || fw.LogFormat == LogFormatCombined {
+		if status == 0 {
+			// nothing was written, net/http responds with a 200
+			status = http.StatusOK
+		}
+		log.Print(formatCLF(fw.LogFormat, r, d, status, bytes, fw.now()))
+		return
+	}
+	verb := "allowed"
+	if !d.Allowed {
+		verb = "blocked"
+	}
+	log.Printf("[FIREWALL] %s request from %s for %s: %s, wrote %d bytes", verb, d.SrcIP.String(), d.Path, d.Reason, bytes)
+}
+
+// logfUnlocked logs like logf, for callers not holding the firewall's lock
+func (fw *Firewall) logfUnlocked(format string, args ...interface{}) {
+	fw.mu.RLock()
+	defer fw.mu.RUnlock()
+
+	fw.logf(format, args...)
+}
+
+// logf logs a firewall message when logging is enabled, the firewall's lock must be held
+func (fw *Firewall) logf(format string, args ...interface{}) {
+	if fw.Log {
+		log.Printf("[FIREWALL] "+format, args...)
+	}
+}
+
+// statusFor returns the status code written for requests blocked for a reason
+func (fw *Firewall) statusFor(reason Reason) int {
+	if status, ok := fw.ReasonStatus[reason]; ok && status != 0 {
+		return status
+	}
+	if reason.accessDenied() && fw.BlockStatus != 0 {
+		return fw.BlockStatus
+	}
+	return reason.HTTPStatus()
+}
+
 // IPIsTrusted checks whether an IP address is part of a list of trusted netblocks
 func IPIsTrusted(trusted []net.IPNet, src net.IP) bool {
 	if src == nil {
@@ -104,3 +587,26 @@ func IPIsTrusted(trusted []net.IPNet, src net.IP) bool {
 	}
 	return false
 }
+
+// AnyIPTrusted checks whether at least one IP address is part of a list of trusted netblocks
+func AnyIPTrusted(trusted []net.IPNet, srcs []net.IP) bool {
+	for _, src := range srcs {
+		if IPIsTrusted(trusted, src) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllIPsTrusted checks whether every IP address is part of a list of trusted netblocks
+func AllIPsTrusted(trusted []net.IPNet, srcs []net.IP) bool {
+	if len(srcs) == 0 {
+		return false
+	}
+	for _, src := range srcs {
+		if !IPIsTrusted(trusted, src) {
+			return false
+		}
+	}
+	return true
+}
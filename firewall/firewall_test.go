@@ -0,0 +1,144 @@
+package firewall
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestRequest returns a request for a target which appears to come from a source IP
+func newTestRequest(method, target, src string) *http.Request {
+	r := httptest.NewRequest(method, target, nil)
+	r.RemoteAddr = net.JoinHostPort(src, "1234")
+	return r
+}
+
+func TestRequestURIRule(t *testing.T) {
+	fw := New()
+	if err := fw.AddPathRule("/callback", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.AddRequestURIRule("/callback?sig=abc", []string{"203.0.113.0/24"}, PathOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.AddRequestURIRule("/redirect?next=%2Fhome", []string{"203.0.113.0/24"}, PathOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		target, src string
+		allowed     bool
+		rule        string
+	}{
+		{"/callback?sig=abc", "203.0.113.9", true, "/callback?sig=abc"},
+		{"/callback?sig=abc", "10.1.2.3", false, "/callback?sig=abc"},
+		{"/callback?sig=abd", "203.0.113.9", false, "/callback"},
+		{"/callback?sig=abc&x=1", "203.0.113.9", false, "/callback"},
+		{"/callback?x=1&sig=abc", "203.0.113.9", false, "/callback"},
+		{"/callback", "203.0.113.9", false, "/callback"},
+		{"/callback?sig=abd", "10.1.2.3", true, "/callback"},
+		// the query is compared still percent-encoded
+		{"/redirect?next=%2Fhome", "203.0.113.9", true, "/redirect?next=%2Fhome"},
+		{"/redirect?next=/home", "203.0.113.9", false, ""},
+	}
+	for _, test := range tests {
+		d := fw.Decide(newTestRequest(http.MethodGet, test.target, test.src))
+		if d.Allowed != test.allowed || d.Rule != test.rule {
+			t.Errorf("%s from %s: got allowed=%t rule=%q, want allowed=%t rule=%q", test.target, test.src, d.Allowed, d.Rule, test.allowed, test.rule)
+		}
+	}
+}
+
+func TestAddRequestURIRuleRequiresQuery(t *testing.T) {
+	fw := New()
+	for _, uri := range []string{"/callback", "callback?sig=abc"} {
+		if err := fw.AddRequestURIRule(uri, []string{"10.0.0.0/8"}, PathOptions{}); err == nil {
+			t.Errorf("AddRequestURIRule(%q) succeeded", uri)
+		}
+	}
+}
+
+func TestSetPathRule(t *testing.T) {
+	fw := New()
+	if err := fw.SetPathRule("/admin", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	if !fw.HasRule("/admin") {
+		t.Fatal("SetPathRule did not add a rule for a path without one")
+	}
+	if err := fw.AddPathRuleWithOptions("/agents", []string{"10.0.0.0/8"}, PathOptions{UserAgent: "^agent$"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/admin", "/agents"} {
+		if err := fw.SetPathRule(path, []string{"192.168.0.0/16", "172.16.0.0/12"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		path, src, userAgent string
+		allowed              bool
+	}{
+		{"/admin", "10.1.2.3", "", false},
+		{"/admin", "192.168.1.1", "", true},
+		{"/admin", "172.16.0.1", "", true},
+		// options are kept
+		{"/agents", "192.168.1.1", "agent", true},
+		{"/agents", "192.168.1.1", "curl/8.0", false},
+	}
+	for _, test := range tests {
+		r := newTestRequest(http.MethodGet, test.path, test.src)
+		r.Header.Set("User-Agent", test.userAgent)
+		if d := fw.Decide(r); d.Allowed != test.allowed {
+			t.Errorf("%s from %s: got %s, want allowed=%t", test.path, test.src, d.Reason, test.allowed)
+		}
+	}
+
+	if err := fw.SetPathRule("/admin", []string{"10.0.0.0/8", "not a cidr"}); err == nil {
+		t.Fatal("set an invalid netblock")
+	}
+	if d := fw.Decide(newTestRequest(http.MethodGet, "/admin", "192.168.1.1")); !d.Allowed {
+		t.Errorf("got %s, want an invalid update to leave the rule untouched", d.Reason)
+	}
+}
+
+func TestSetPathRuleIsAtomic(t *testing.T) {
+	fw := New()
+	a, b := []string{"10.0.0.0/8"}, []string{"192.168.0.0/16"}
+	if err := fw.SetPathRule("/admin", a); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	errs := make(chan string, 1)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			// removing and re-adding the rule would let requests see the path without one
+			if d := fw.Decide(newTestRequest(http.MethodGet, "/admin", "10.1.2.3")); d.Reason == ReasonNoRule {
+				select {
+				case errs <- "observed the path without a rule":
+				default:
+				}
+			}
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		networks := a
+		if i%2 == 0 {
+			networks = b
+		}
+		if err := fw.SetPathRule("/admin", networks); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case err := <-errs:
+		t.Error(err)
+	default:
+	}
+}
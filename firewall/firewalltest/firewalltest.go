@@ -0,0 +1,59 @@
+/*Package firewalltest provides utilities for testing handlers wrapped by the firewall.
+* The test server it starts takes the source IP of each request from a header set by
+* its client, so that allowed and blocked flows can be exercised from a single host
+ */
+package firewalltest
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/adrianosela/GoFirewall/firewall"
+)
+
+// SourceIPHeader carries the source IP a request should appear to come from
+const SourceIPHeader = "X-Firewalltest-Source-IP"
+
+/*NewTestServer starts an httptest.Server serving a handler wrapped by the firewall.
+* Requests carrying the SourceIPHeader have their RemoteAddr set to its value, and
+* the header removed, before reaching the firewall. The caller should Close it
+ */
+func NewTestServer(fw *firewall.Firewall, handler http.HandlerFunc) *httptest.Server {
+	wrapped := fw.Wrap(handler)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip := r.Header.Get(SourceIPHeader); ip != "" {
+			_, port, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				port = "0"
+			}
+			r.RemoteAddr = net.JoinHostPort(ip, port)
+			r.Header.Del(SourceIPHeader)
+		}
+		wrapped.ServeHTTP(w, r)
+	}))
+}
+
+// NewClient returns a client for a test server whose requests appear to come from srcIP
+func NewClient(srv *httptest.Server, srcIP string) *http.Client {
+	client := *srv.Client()
+	client.Transport = &sourceIPTransport{srcIP: srcIP, base: client.Transport}
+	return &client
+}
+
+// sourceIPTransport sets the SourceIPHeader on every request it sends
+type sourceIPTransport struct {
+	srcIP string
+	base  http.RoundTripper
+}
+
+// RoundTrip sends a copy of the request carrying the SourceIPHeader
+func (t *sourceIPTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set(SourceIPHeader, t.srcIP)
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(r)
+}
@@ -0,0 +1,52 @@
+package firewalltest
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/adrianosela/GoFirewall/firewall"
+)
+
+func TestServerFlows(t *testing.T) {
+	fw := firewall.New()
+	if err := fw.AddPathRule("/admin", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	srv := NewTestServer(fw, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(SourceIPHeader) != "" {
+			t.Error("handler received the source IP header")
+		}
+		io.WriteString(w, r.RemoteAddr)
+	})
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		client *http.Client
+		status int
+	}{
+		{"trusted source", NewClient(srv, "10.1.2.3"), http.StatusOK},
+		{"untrusted source", NewClient(srv, "198.51.100.1"), http.StatusForbidden},
+		{"no source header", srv.Client(), http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := test.client.Get(srv.URL + "/admin")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != test.status {
+				t.Fatalf("got status %d, want %d", resp.StatusCode, test.status)
+			}
+			if test.status == http.StatusOK {
+				if host, _, _ := net.SplitHostPort(string(body)); host != "10.1.2.3" {
+					t.Errorf("handler saw RemoteAddr %q, want source 10.1.2.3", body)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package firewall
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// Grant represents a trusted netblock for a path which expires after a point in time
+type Grant struct {
+	Netblock net.IPNet
+	Expires  time.Time
+}
+
+/*GrantTemporaryAccess trusts a netblock for a given path for the duration of the ttl,
+* after which the grant no longer authorizes requests. Expired grants are ignored by
+* the trust check and removed by ReapExpiredGrants
+ */
+func (fw *Firewall) GrantTemporaryAccess(path, cidr string, ttl time.Duration) error {
+	_, netblock, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return fmt.Errorf("could not parse CIDR: %s", err)
+	}
+
+	grant := Grant{
+		Netblock: *netblock,
+		Expires:  fw.now().Add(ttl),
+	}
+
+	fw.mu.Lock()
+	if fw.Rules.PathToGrants == nil {
+		fw.Rules.PathToGrants = make(map[string][]Grant)
+	}
+	fw.Rules.PathToGrants[path] = append(fw.Rules.PathToGrants[path], grant)
+	fw.mu.Unlock()
+
+	fw.ruleChanged(RuleChangeEvent{
+		Action: RuleUpdated,
+		Path:   path,
+		Detail: fmt.Sprintf("granted temporary access to %s until %s", grant.Netblock.String(), grant.Expires.Format(time.RFC3339)),
+	})
+	return nil
+}
+
+// ReapExpiredGrants removes all expired grants and returns how many were removed
+func (fw *Firewall) ReapExpiredGrants() int {
+	fw.mu.Lock()
+	now := fw.now()
+	reaped := make(map[string]int)
+	for path, grants := range fw.Rules.PathToGrants {
+		var active []Grant
+		for _, grant := range grants {
+			if now.Before(grant.Expires) {
+				active = append(active, grant)
+			}
+		}
+		if len(active) < len(grants) {
+			reaped[path] = len(grants) - len(active)
+		}
+		if len(active) == 0 {
+			delete(fw.Rules.PathToGrants, path)
+			continue
+		}
+		fw.Rules.PathToGrants[path] = active
+	}
+	fw.mu.Unlock()
+
+	total := 0
+	for path, n := range reaped {
+		total += n
+		fw.ruleChanged(RuleChangeEvent{
+			Action: RuleUpdated,
+			Path:   path,
+			Detail: fmt.Sprintf("removed %d expired grant(s)", n),
+		})
+	}
+	return total
+}
+
+// grantIsActive checks whether an IP address is part of any unexpired grant
+func grantIsActive(grants []Grant, src net.IP, now time.Time) bool {
+	if src == nil {
+		return false
+	}
+	for _, grant := range grants {
+		if now.Before(grant.Expires) && grant.Netblock.Contains(src) {
+			return true
+		}
+	}
+	return false
+}
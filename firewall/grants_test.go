@@ -0,0 +1,55 @@
+package firewall
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestGrantTemporaryAccess(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	fw := New()
+	fw.Now = func() time.Time { return now }
+	if err := fw.AddPathRule("/admin", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.GrantTemporaryAccess("/admin", "198.51.100.0/24", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	allowed := func() bool {
+		return fw.Decide(newTestRequest(http.MethodGet, "/admin", "198.51.100.7")).Allowed
+	}
+	if !allowed() {
+		t.Error("granted source blocked")
+	}
+	if fw.Decide(newTestRequest(http.MethodGet, "/admin", "203.0.113.1")).Allowed {
+		t.Error("source outside the grant allowed")
+	}
+	if fw.Decide(newTestRequest(http.MethodGet, "/other", "198.51.100.7")).Allowed {
+		t.Error("grant applied to another path")
+	}
+
+	now = now.Add(59 * time.Minute)
+	if !allowed() {
+		t.Error("granted source blocked before the grant expired")
+	}
+	if n := fw.ReapExpiredGrants(); n != 0 {
+		t.Errorf("reaped %d grants before they expired", n)
+	}
+	now = now.Add(time.Minute)
+	if allowed() {
+		t.Error("granted source allowed once the grant expired")
+	}
+	if n := fw.ReapExpiredGrants(); n != 1 {
+		t.Errorf("reaped %d grants, want 1", n)
+	}
+	if grants := fw.GetRules().PathToGrants["/admin"]; len(grants) != 0 {
+		t.Errorf("got %d grants after reaping, want none", len(grants))
+	}
+}
+
+func TestGrantTemporaryAccessRejectsInvalidCIDR(t *testing.T) {
+	if err := New().GrantTemporaryAccess("/admin", "198.51.100.0/33", time.Hour); err == nil {
+		t.Error("granted access to an invalid CIDR")
+	}
+}
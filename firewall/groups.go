@@ -0,0 +1,110 @@
+package firewall
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// GroupPrefix marks references to named netblock groups in lists of networks, e.g. "@office"
+const GroupPrefix = "@"
+
+// ErrUnknownGroup will be returned when the developer references a netblock group which was not defined
+var ErrUnknownGroup = errors.New("unknown netblock group")
+
+// groupRef is how a path's rule was defined in terms of netblocks and groups
+type groupRef struct {
+	netblocks []net.IPNet
+	groups    []string
+}
+
+/*DefineGroup defines, or redefines, a named group of netblocks which rules can
+* reference as "@name" wherever a network CIDR is expected, e.g.
+*	fw.DefineGroup("office", []string{"198.51.100.0/24"})
+*	fw.AddPathRule("/admin", []string{"@office", "10.0.0.0/8"})
+* References are expanded when rules are added, and redefining a group updates the
+* netblocks of every rule added through AddPathRule or SetPathRule which references
+* it. Rule sets replaced as a whole, e.g. by LoadRules, contain no references
+ */
+func (fw *Firewall) DefineGroup(name string, networks []string) error {
+	if name == "" || strings.HasPrefix(name, GroupPrefix) {
+		return fmt.Errorf("invalid group name: %q", name)
+	}
+	netblocks, groups, err := parseNetworks(networks)
+	if err != nil {
+		return err
+	}
+	if len(groups) > 0 {
+		return fmt.Errorf("group %s can't reference other groups", name)
+	}
+
+	fw.mu.Lock()
+	if fw.groups == nil {
+		fw.groups = make(map[string][]net.IPNet)
+	}
+	fw.groups[name] = netblocks
+	var updated []string
+	for path, ref := range fw.groupRefs {
+		if !containsString(ref.groups, name) {
+			continue
+		}
+		// every group a rule references is defined, so this can't fail
+		expanded, _ := fw.expandGroups(ref.netblocks, ref.groups)
+		fw.Rules.PathToNetblocks[path] = expanded
+		updated = append(updated, path)
+	}
+	if len(updated) > 0 {
+		fw.version++
+	}
+	fw.mu.Unlock()
+
+	sort.Strings(updated)
+	for _, path := range updated {
+		fw.ruleChanged(RuleChangeEvent{Action: RuleUpdated, Path: path, Detail: fmt.Sprintf("group %s%s changed", GroupPrefix, name)})
+	}
+	return nil
+}
+
+// parseNetworks parses a list of network CIDRs and references to groups, returning the group names separately
+func parseNetworks(networks []string) ([]net.IPNet, []string, error) {
+	var cidrs, groups []string
+	for _, network := range networks {
+		if strings.HasPrefix(network, GroupPrefix) {
+			groups = append(groups, strings.TrimPrefix(network, GroupPrefix))
+			continue
+		}
+		cidrs = append(cidrs, network)
+	}
+	netblocks, err := parseCIDRs(cidrs)
+	return netblocks, groups, err
+}
+
+// expandGroups appends the netblocks of the given groups to a list of netblocks, the firewall's lock must be held
+func (fw *Firewall) expandGroups(netblocks []net.IPNet, groups []string) ([]net.IPNet, error) {
+	if len(groups) == 0 {
+		return netblocks, nil
+	}
+	expanded := append([]net.IPNet(nil), netblocks...)
+	for _, group := range groups {
+		members, ok := fw.groups[group]
+		if !ok {
+			return nil, fmt.Errorf("%s: %s%s", ErrUnknownGroup, GroupPrefix, group)
+		}
+		expanded = append(expanded, members...)
+	}
+	return expanded, nil
+}
+
+// setGroupRefs records the groups a path's rule references, the firewall's lock must be held
+func (fw *Firewall) setGroupRefs(path string, netblocks []net.IPNet, groups []string) {
+	if len(groups) == 0 {
+		delete(fw.groupRefs, path)
+		return
+	}
+	if fw.groupRefs == nil {
+		fw.groupRefs = make(map[string]groupRef)
+	}
+	fw.groupRefs[path] = groupRef{netblocks: netblocks, groups: groups}
+}
@@ -0,0 +1,91 @@
+package firewall
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGroups(t *testing.T) {
+	fw := New()
+	var events []RuleChangeEvent
+	fw.OnRuleChange = func(event RuleChangeEvent) { events = append(events, event) }
+	if err := fw.DefineGroup("office", []string{"198.51.100.0/24"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.AddPathRule("/admin", []string{"@office", "10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.SetPathRule("/reports", []string{"@office"}); err != nil {
+		t.Fatal(err)
+	}
+	trusted := func(path, src string) bool {
+		return fw.Decide(newTestRequest(http.MethodGet, path, src)).Reason == ReasonTrusted
+	}
+	for _, path := range []string{"/admin", "/reports"} {
+		if !trusted(path, "198.51.100.7") {
+			t.Errorf("%s: office address not trusted", path)
+		}
+		if trusted(path, "203.0.113.7") {
+			t.Errorf("%s: address outside the office trusted", path)
+		}
+	}
+	if !trusted("/admin", "10.1.2.3") {
+		t.Error("/admin: netblock listed next to the group not trusted")
+	}
+
+	events = nil
+	if err := fw.DefineGroup("office", []string{"203.0.113.0/24"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/admin", "/reports"} {
+		if trusted(path, "198.51.100.7") {
+			t.Errorf("%s: former office address still trusted", path)
+		}
+		if !trusted(path, "203.0.113.7") {
+			t.Errorf("%s: new office address not trusted", path)
+		}
+	}
+	if !trusted("/admin", "10.1.2.3") {
+		t.Error("/admin: redefining the group dropped the netblock listed next to it")
+	}
+	if len(events) != 2 || events[0].Path != "/admin" || events[1].Path != "/reports" || events[0].Detail != "group @office changed" {
+		t.Errorf("got events %+v, want updates to /admin and /reports", events)
+	}
+
+	// rules which no longer reference the group aren't updated
+	if err := fw.SetPathRule("/reports", []string{"192.0.2.0/24"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.DefineGroup("office", []string{"198.51.100.0/24"}); err != nil {
+		t.Fatal(err)
+	}
+	if trusted("/reports", "198.51.100.7") || !trusted("/reports", "192.0.2.1") {
+		t.Error("/reports: redefining a group updated a rule which no longer references it")
+	}
+}
+
+func TestGroupErrors(t *testing.T) {
+	fw := New()
+	err := fw.AddPathRule("/admin", []string{"@office"})
+	if err == nil || !strings.HasPrefix(err.Error(), ErrUnknownGroup.Error()) {
+		t.Errorf("got error %v referencing an undefined group, want %s", err, ErrUnknownGroup)
+	}
+	if fw.HasRule("/admin") {
+		t.Error("rule referencing an undefined group was added")
+	}
+	for _, name := range []string{"", "@office"} {
+		if err := fw.DefineGroup(name, []string{"10.0.0.0/8"}); err == nil {
+			t.Errorf("defined a group named %q", name)
+		}
+	}
+	if err := fw.DefineGroup("office", []string{"not a cidr"}); err == nil {
+		t.Error("defined a group with an invalid network")
+	}
+	if err := fw.DefineGroup("office", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.DefineGroup("campus", []string{"@office"}); err == nil {
+		t.Error("defined a group referencing another group")
+	}
+}
@@ -0,0 +1,19 @@
+package firewall
+
+// HasRule checks whether a path has a rule of its own, regardless of whether it is enabled
+func (fw *Firewall) HasRule(path string) bool {
+	fw.mu.RLock()
+	defer fw.mu.RUnlock()
+
+	_, hasRule := fw.Rules.PathToNetblocks[path]
+	return hasRule
+}
+
+// HasMethodRule checks whether a path has an enabled rule of its own which applies to requests with the given method
+func (fw *Firewall) HasMethodRule(method, path string) bool {
+	fw.mu.RLock()
+	defer fw.mu.RUnlock()
+
+	_, hasRule := fw.Rules.PathToNetblocks[path]
+	return hasRule && fw.ruleApplies(path, method)
+}
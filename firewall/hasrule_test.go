@@ -0,0 +1,68 @@
+package firewall
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestHasRule(t *testing.T) {
+	fw := New()
+	if err := fw.AddPathRule("/api", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.AddPathRule("/closed", nil); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path    string
+		hasRule bool
+	}{
+		{"/api", true},
+		// a rule with no trusted netblocks, which denies everyone, is still registered
+		{"/closed", true},
+		// rules are per path, subpaths and prefixes of a path with a rule don't have one
+		{"/api/users", false},
+		{"/ap", false},
+		{"/unregistered", false},
+	}
+	for _, test := range tests {
+		if got := fw.HasRule(test.path); got != test.hasRule {
+			t.Errorf("HasRule(%q): got %t, want %t", test.path, got, test.hasRule)
+		}
+	}
+}
+
+func TestHasMethodRule(t *testing.T) {
+	fw := New()
+	if err := fw.AddPathRuleWithOptions("/api", []string{"10.0.0.0/8"}, PathOptions{Methods: []string{"POST", "DELETE"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.AddPathRule("/any", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.AddPathRule("/disabled", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.DisablePathRule("/disabled"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		method, path string
+		hasRule      bool
+	}{
+		{http.MethodPost, "/api", true},
+		{"delete", "/api", true},
+		{http.MethodGet, "/api", false},
+		{http.MethodGet, "/any", true},
+		{http.MethodGet, "/disabled", false},
+		{http.MethodPost, "/api/users", false},
+	}
+	for _, test := range tests {
+		if got := fw.HasMethodRule(test.method, test.path); got != test.hasRule {
+			t.Errorf("HasMethodRule(%q, %q): got %t, want %t", test.method, test.path, got, test.hasRule)
+		}
+	}
+	if !fw.HasRule("/disabled") {
+		t.Error("HasRule ignored a disabled rule")
+	}
+}
@@ -0,0 +1,92 @@
+package firewall
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// HealthChecker is implemented by resolvers which can report whether their external source is reachable, see Healthy
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
+
+// healthCheckTimeout bounds how long Healthy waits for each resolver's health check
+const healthCheckTimeout = 5 * time.Second
+
+/*Healthy checks whether the firewall is in a sane state, e.g. for a readiness
+* probe, and returns the issues found: no rules being loaded (neither path rules,
+* deny lists, a default rule nor failing open), the last reload (LoadRules,
+* LoadRulesLayer, ReplaceRules or Import) having failed, rules older than
+* MaxRuleAge, and resolvers implementing HealthChecker failing their check
+ */
+func (fw *Firewall) Healthy() (bool, []string) {
+	fw.mu.RLock()
+	var issues []string
+	if !fw.rulesLoaded() {
+		issues = append(issues, "no rules are loaded")
+	}
+	if fw.reloadErr != nil {
+		issues = append(issues, fmt.Sprintf("last reload failed: %s", fw.reloadErr))
+	}
+	if fw.MaxRuleAge > 0 {
+		if fw.lastReload.IsZero() {
+			issues = append(issues, "rules were never reloaded")
+		} else if age := fw.now().Sub(fw.lastReload); age > fw.MaxRuleAge {
+			issues = append(issues, fmt.Sprintf("rules are stale, last reloaded %s ago", age.Round(time.Second)))
+		}
+	}
+	checkers := make(map[string]HealthChecker)
+	for path, opts := range fw.Rules.PathToOptions {
+		if checker, ok := opts.Resolver.(HealthChecker); ok {
+			checkers[path] = checker
+		}
+	}
+	if checker, ok := fw.Rules.DefaultOptions.Resolver.(HealthChecker); ok {
+		checkers[DefaultRule] = checker
+	}
+	fw.mu.RUnlock()
+
+	// resolvers are checked without holding the lock, as they may be slow
+	var paths []string
+	for path := range checkers {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+		err := checkers[path].HealthCheck(ctx)
+		cancel()
+		if err != nil {
+			issues = append(issues, fmt.Sprintf("resolver for %s is unhealthy: %s", path, err))
+		}
+	}
+	return len(issues) == 0, issues
+}
+
+// reloadDone records the outcome of a reload of the rules for Healthy
+func (fw *Firewall) reloadDone(err *error) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	fw.reloadErr = *err
+}
+
+// rulesLoaded checks whether the firewall has any rule which decides requests, the firewall's lock must be held
+func (fw *Firewall) rulesLoaded() bool {
+	rules := fw.Rules
+	if len(rules.PathToNetblocks) > 0 || len(rules.PathToDeniedNetblocks) > 0 || len(rules.DeniedNetblocks) > 0 || len(rules.DefaultNetblocks) > 0 {
+		return true
+	}
+	if rules.FailOpen || fw.FailOpenWhen != nil || !reflect.DeepEqual(rules.DefaultOptions, PathOptions{}) {
+		return true
+	}
+	for _, open := range rules.MethodFailOpen {
+		if open {
+			return true
+		}
+	}
+	return false
+}
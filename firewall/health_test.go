@@ -0,0 +1,112 @@
+package firewall
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// checkedResolver is a resolver whose health check returns err
+type checkedResolver struct {
+	err error
+}
+
+func (r checkedResolver) Match(ctx context.Context, ip net.IP) (bool, error) { return false, nil }
+
+func (r checkedResolver) HealthCheck(ctx context.Context) error { return r.err }
+
+func TestHealthy(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	fw := New()
+	fw.Now = func() time.Time { return now }
+	fw.MaxRuleAge = time.Hour
+	if ok, issues := fw.Healthy(); ok || len(issues) != 1 || issues[0] != "no rules are loaded" {
+		t.Errorf("got healthy=%t with issues %q for a new firewall", ok, issues)
+	}
+
+	config := `{"paths": {"/admin": {"allow": ["10.0.0.0/8"], "code_options": ["resolver"]}}}`
+	if err := fw.AddPathRuleWithOptions("/admin", []string{"10.0.0.0/8"}, PathOptions{Resolver: checkedResolver{}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.LoadRules(strings.NewReader(config)); err != nil {
+		t.Fatal(err)
+	}
+	if ok, issues := fw.Healthy(); !ok {
+		t.Errorf("got issues %q for a healthy firewall", issues)
+	}
+
+	if err := fw.LoadRules(strings.NewReader(`{"paths": {"/admin": {"allow": ["not a cidr"]}}}`)); err == nil {
+		t.Fatal("loaded an invalid config")
+	}
+	ok, issues := fw.Healthy()
+	if ok || len(issues) != 1 || !strings.HasPrefix(issues[0], "last reload failed: ") {
+		t.Errorf("got healthy=%t with issues %q after a failed reload", ok, issues)
+	}
+
+	now = now.Add(2 * time.Hour)
+	ok, issues = fw.Healthy()
+	if ok || len(issues) != 2 || issues[1] != "rules are stale, last reloaded 2h0m0s ago" {
+		t.Errorf("got healthy=%t with issues %q for stale rules", ok, issues)
+	}
+
+	// a successful reload clears both issues
+	if err := fw.LoadRules(strings.NewReader(config)); err != nil {
+		t.Fatal(err)
+	}
+	if ok, issues := fw.Healthy(); !ok {
+		t.Errorf("got issues %q once reloaded", issues)
+	}
+}
+
+func TestHealthyChecksResolvers(t *testing.T) {
+	fw := New()
+	unreachable := checkedResolver{err: errors.New("geo database unreachable")}
+	if err := fw.AddPathRuleWithOptions("/geo", []string{"10.0.0.0/8"}, PathOptions{Resolver: unreachable}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.AddPathRuleWithOptions("/ok", []string{"10.0.0.0/8"}, PathOptions{Resolver: checkedResolver{}}); err != nil {
+		t.Fatal(err)
+	}
+	ok, issues := fw.Healthy()
+	if want := "resolver for /geo is unhealthy: geo database unreachable"; ok || len(issues) != 1 || issues[0] != want {
+		t.Errorf("got healthy=%t with issues %q, want %q", ok, issues, want)
+	}
+}
+
+func TestHealthyWithoutPathRules(t *testing.T) {
+	configs := map[string]string{
+		"deny list":        `{"deny": ["203.0.113.0/24"]}`,
+		"path deny list":   `{"paths": {"/admin": {"deny": ["203.0.113.0/24"]}}}`,
+		"default rule":     `{"default": ["10.0.0.0/8"]}`,
+		"default options":  `{"default_options": {"max_body_bytes": 1024}}`,
+		"fail open":        `{"fail_open": true}`,
+		"method fail open": `{"method_fail_open": {"GET": true}}`,
+	}
+	for name, config := range configs {
+		fw := New()
+		if err := fw.LoadRules(strings.NewReader(config)); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if ok, issues := fw.Healthy(); !ok {
+			t.Errorf("%s: got issues %q", name, issues)
+		}
+	}
+
+	fw := New()
+	fw.FailOpenWhen = func() bool { return true }
+	if ok, issues := fw.Healthy(); !ok {
+		t.Errorf("got issues %q failing open with FailOpenWhen", issues)
+	}
+
+	// methods listed as failing closed don't let anything through
+	fw = New()
+	if err := fw.LoadRules(strings.NewReader(`{"method_fail_open": {"GET": false}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := fw.Healthy(); ok {
+		t.Error("got healthy with only methods failing closed")
+	}
+}
@@ -0,0 +1,137 @@
+package firewall
+
+import (
+	"math/big"
+	"net"
+	"sort"
+)
+
+/*ImpactOfSetPathRule previews SetPathRule: it compares the netblocks a path's
+* rule trusts with the ones it would trust with the given networks, and returns
+* the address space which would lose access and the one which would gain it, as
+* minimal lists of netblocks with IPv4 netblocks first, in ascending order. Only
+* the rule's netblocks are compared, a path without a rule trusts none, so that
+* deny lists, the default rule and options are not taken into account. Networks
+* may reference groups, see DefineGroup
+ */
+func (fw *Firewall) ImpactOfSetPathRule(path string, networks []string) (newlyDenied, newlyAllowed []net.IPNet, err error) {
+	netblocks, groups, err := parseNetworks(networks)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fw.mu.RLock()
+	proposed, err := fw.expandGroups(netblocks, groups)
+	current := append([]net.IPNet(nil), fw.Rules.PathToNetblocks[path]...)
+	fw.mu.RUnlock()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	before, after := addressRanges(current), addressRanges(proposed)
+	for _, bits := range []int{32, 128} {
+		newlyDenied = append(newlyDenied, rangesNetblocks(subtractRanges(before[bits], after[bits]), bits)...)
+		newlyAllowed = append(newlyAllowed, rangesNetblocks(subtractRanges(after[bits], before[bits]), bits)...)
+	}
+	return newlyDenied, newlyAllowed, nil
+}
+
+// addressRange is an inclusive range of addresses, as numbers
+type addressRange struct {
+	first, last *big.Int
+}
+
+// addressRanges returns the sorted, non-overlapping address ranges covered by netblocks, by address length in bits
+func addressRanges(netblocks []net.IPNet) map[int][]addressRange {
+	byBits := make(map[int][]addressRange)
+	for _, netblock := range netblocks {
+		ip, mask := netblockNumberAndMask(netblock)
+		if ip == nil {
+			continue
+		}
+		ones, bits := mask.Size()
+		if bits == 0 {
+			// non-canonical mask, not a prefix
+			continue
+		}
+		first := new(big.Int).SetBytes(ip.Mask(mask))
+		size := new(big.Int).Lsh(big.NewInt(1), uint(bits-ones))
+		last := new(big.Int).Sub(size.Add(size, first), big.NewInt(1))
+		byBits[bits] = append(byBits[bits], addressRange{first: first, last: last})
+	}
+	for bits, ranges := range byBits {
+		byBits[bits] = mergeRanges(ranges)
+	}
+	return byBits
+}
+
+// mergeRanges sorts address ranges and merges the overlapping and adjacent ones
+func mergeRanges(ranges []addressRange) []addressRange {
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].first.Cmp(ranges[j].first) < 0 })
+	var merged []addressRange
+	for _, r := range ranges {
+		if n := len(merged); n > 0 {
+			next := new(big.Int).Add(merged[n-1].last, big.NewInt(1))
+			if r.first.Cmp(next) <= 0 {
+				if r.last.Cmp(merged[n-1].last) > 0 {
+					merged[n-1].last = r.last
+				}
+				continue
+			}
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// subtractRanges returns the parts of sorted, non-overlapping ranges a which are not covered by ranges b
+func subtractRanges(a, b []addressRange) []addressRange {
+	var remaining []addressRange
+	for _, r := range a {
+		first := r.first
+		for _, cut := range b {
+			if cut.last.Cmp(first) < 0 || cut.first.Cmp(r.last) > 0 {
+				continue
+			}
+			if cut.first.Cmp(first) > 0 {
+				remaining = append(remaining, addressRange{first: first, last: new(big.Int).Sub(cut.first, big.NewInt(1))})
+			}
+			first = new(big.Int).Add(cut.last, big.NewInt(1))
+			if first.Cmp(r.last) > 0 {
+				break
+			}
+		}
+		if first.Cmp(r.last) <= 0 {
+			remaining = append(remaining, addressRange{first: first, last: r.last})
+		}
+	}
+	return remaining
+}
+
+// rangesNetblocks returns the fewest netblocks covering address ranges of addresses of a length in bits
+func rangesNetblocks(ranges []addressRange, bits int) []net.IPNet {
+	var netblocks []net.IPNet
+	for _, r := range ranges {
+		first := new(big.Int).Set(r.first)
+		for first.Cmp(r.last) <= 0 {
+			// the largest block aligned on first which doesn't go past the end of the range
+			hostBits := int(first.TrailingZeroBits())
+			if first.Sign() == 0 || hostBits > bits {
+				hostBits = bits
+			}
+			for {
+				last := new(big.Int).Lsh(big.NewInt(1), uint(hostBits))
+				last.Add(last, first).Sub(last, big.NewInt(1))
+				if last.Cmp(r.last) <= 0 {
+					break
+				}
+				hostBits--
+			}
+			ip := make(net.IP, bits/8)
+			first.FillBytes(ip)
+			netblocks = append(netblocks, net.IPNet{IP: ip, Mask: net.CIDRMask(bits-hostBits, bits)})
+			first.Add(first, new(big.Int).Lsh(big.NewInt(1), uint(hostBits)))
+		}
+	}
+	return netblocks
+}
@@ -0,0 +1,64 @@
+package firewall
+
+import "testing"
+
+func TestImpactOfSetPathRule(t *testing.T) {
+	fw := New()
+	if err := fw.AddPathRule("/admin", []string{"10.0.0.0/24", "10.0.2.0/24", "2001:db8::/32"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.DefineGroup("office", []string{"198.51.100.0/24"}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path            string
+		networks        []string
+		denied, allowed string
+	}{
+		// overlapping: the lower half of 10.0.0.0/24 is lost, 10.0.1.0/24 is gained
+		{"/admin", []string{"10.0.0.128/25", "10.0.1.0/24", "10.0.2.0/24", "2001:db8::/32"},
+			"10.0.0.0/25", "10.0.1.0/24"},
+		// widening covers the existing netblocks, so nothing is lost
+		{"/admin", []string{"10.0.0.0/22", "2001:db8::/31"},
+			"", "10.0.1.0/24 10.0.3.0/24 2001:db9::/32"},
+		// a hole punched into the middle of a netblock
+		{"/admin", []string{"10.0.0.0/24", "10.0.2.0/25", "10.0.2.192/26", "2001:db8::/32"},
+			"10.0.2.128/26", ""},
+		// the same address space, spelt differently
+		{"/admin", []string{"10.0.0.0/25", "10.0.0.128/25", "10.0.2.0/24", "2001:db8::/32"},
+			"", ""},
+		{"/admin", nil,
+			"10.0.0.0/24 10.0.2.0/24 2001:db8::/32", ""},
+		{"/admin", []string{"@office", "10.0.0.0/24", "10.0.2.0/24", "2001:db8::/32"},
+			"", "198.51.100.0/24"},
+		// a path without a rule trusts nothing yet
+		{"/new", []string{"192.0.2.0/24"},
+			"", "192.0.2.0/24"},
+	}
+	for _, test := range tests {
+		denied, allowed, err := fw.ImpactOfSetPathRule(test.path, test.networks)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := formatNetblocks(denied); got != test.denied {
+			t.Errorf("%s to %v: newly denied %q, want %q", test.path, test.networks, got, test.denied)
+		}
+		if got := formatNetblocks(allowed); got != test.allowed {
+			t.Errorf("%s to %v: newly allowed %q, want %q", test.path, test.networks, got, test.allowed)
+		}
+	}
+
+	// previews leave the rules alone
+	if got := formatNetblocks(fw.GetRules().PathToNetblocks["/admin"]); got != "10.0.0.0/24 10.0.2.0/24 2001:db8::/32" {
+		t.Errorf("previewing changed /admin to %s", got)
+	}
+	if fw.HasRule("/new") {
+		t.Error("previewing added a rule")
+	}
+	if _, _, err := fw.ImpactOfSetPathRule("/admin", []string{"not a cidr"}); err == nil {
+		t.Error("previewed an invalid network")
+	}
+	if _, _, err := fw.ImpactOfSetPathRule("/admin", []string{"@unknown"}); err == nil {
+		t.Error("previewed an unknown group")
+	}
+}
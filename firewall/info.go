@@ -0,0 +1,37 @@
+package firewall
+
+import (
+	"sort"
+	"time"
+)
+
+// RuleSetInfo summarizes the rule set currently loaded into a firewall
+type RuleSetInfo struct {
+	// Paths is the number of paths with an associated rule
+	Paths int
+	// Netblocks is the total number of trusted netblocks across all paths
+	Netblocks int
+	// DisabledPaths are the paths whose rule is disabled, in lexical order
+	DisabledPaths []string
+	// LastReload is when the rule set was last loaded or replaced
+	LastReload time.Time
+}
+
+// Info returns a summary of the firewall's current rule set
+func (fw *Firewall) Info() RuleSetInfo {
+	fw.mu.RLock()
+	defer fw.mu.RUnlock()
+
+	info := RuleSetInfo{
+		Paths:      len(fw.Rules.PathToNetblocks),
+		LastReload: fw.lastReload,
+	}
+	for path, netblocks := range fw.Rules.PathToNetblocks {
+		info.Netblocks += len(netblocks)
+		if fw.Rules.DisabledPaths[path] {
+			info.DisabledPaths = append(info.DisabledPaths, path)
+		}
+	}
+	sort.Strings(info.DisabledPaths)
+	return info
+}
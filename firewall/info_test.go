@@ -0,0 +1,59 @@
+package firewall
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInfo(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	fw := New()
+	fw.Now = func() time.Time { return now }
+	if err := fw.AddPathRule("/a", []string{"10.0.0.0/8", "192.168.0.0/16"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.AddPathRule("/b", []string{"172.16.0.0/12"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.AddPathRule("/c", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.DisablePathRule("/b"); err != nil {
+		t.Fatal(err)
+	}
+	info := fw.Info()
+	if info.Paths != 3 || info.Netblocks != 3 {
+		t.Errorf("got %d paths and %d netblocks, want 3 and 3", info.Paths, info.Netblocks)
+	}
+	if len(info.DisabledPaths) != 1 || info.DisabledPaths[0] != "/b" {
+		t.Errorf("got disabled paths %v, want [/b]", info.DisabledPaths)
+	}
+
+	reloaded := now.Add(time.Hour)
+	now = reloaded
+	if err := fw.LoadRules(strings.NewReader(`{"paths": {"/a": {"allow": ["10.0.0.0/8"]}}}`)); err != nil {
+		t.Fatal(err)
+	}
+	info = fw.Info()
+	if !info.LastReload.Equal(reloaded) {
+		t.Errorf("got last reload %s, want %s", info.LastReload, reloaded)
+	}
+	if info.Paths != 1 || info.Netblocks != 1 {
+		t.Errorf("got %d paths and %d netblocks after reloading, want 1 and 1", info.Paths, info.Netblocks)
+	}
+
+	now = now.Add(time.Hour)
+	if err := fw.LoadRules(strings.NewReader(`{"paths": {"/a": {"allow": ["not a cidr"]}}}`)); err == nil {
+		t.Fatal("loaded an invalid rule set")
+	}
+	if !fw.Info().LastReload.Equal(reloaded) {
+		t.Error("failed reload advanced the last reload time")
+	}
+	if err := fw.ReplaceRules(fw.GetRules()); err != nil {
+		t.Fatal(err)
+	}
+	if !fw.Info().LastReload.Equal(now) {
+		t.Error("replacing the rules did not advance the last reload time")
+	}
+}
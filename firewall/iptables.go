@@ -0,0 +1,123 @@
+package firewall
+
+import (
+	"fmt"
+	"net"
+)
+
+// IptablesChain is the chain the rules returned by ExportIptables are added to
+const IptablesChain = "GOFIREWALL"
+
+var (
+	loopbackNetblocks = mustParseCIDRs("127.0.0.0/8", "::1/128")
+	privateNetblocks  = mustParseCIDRs("10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7")
+)
+
+/*ExportIptables translates the firewall's source IP policy into iptables and
+* ip6tables commands which add rules to IptablesChain, e.g. to be jumped to for
+* the server's port with
+*	iptables -A INPUT -p tcp --dport 443 -j GOFIREWALL
+* Sources in the global deny list are dropped. When the firewall only ever lets
+* through sources trusted by some rule, those (along with TrustedProxies, whose
+* clients can't be told apart by the kernel, the StrictNetblocks of circuit
+* breakers, and the local ranges trusted by TrustLocalhost and TrustPrivateRanges)
+* return to the calling chain and any other
+* source is dropped. Per-path rules, deny lists, options and grants have no kernel
+* equivalent: the kernel can only drop sources which no path trusts. When anything
+* can let other sources through (failing open, bypasses, preflights, resolvers,
+* conditions, staged rules, OnUntrusted handlers or grants) no catch-all drop is
+* generated
+ */
+func (fw *Firewall) ExportIptables() []string {
+	// the netblocks are collected under the lock, and only aggregated once it is released
+	fw.mu.RLock()
+	denied := append([]net.IPNet(nil), fw.Rules.DeniedNetblocks...)
+	exhaustive := fw.exhaustiveAllowList()
+	var allowed []net.IPNet
+	if exhaustive {
+		allowed = append(allowed, fw.TrustedProxies...)
+		allowed = append(allowed, fw.Rules.DefaultNetblocks...)
+		for _, netblocks := range fw.Rules.PathToNetblocks {
+			allowed = append(allowed, netblocks...)
+		}
+		// open circuit breakers trust their strict netblocks instead of the rule's
+		if breaker := fw.Rules.DefaultOptions.Breaker; breaker != nil {
+			allowed = append(allowed, breaker.StrictNetblocks...)
+		}
+		for _, opts := range fw.Rules.PathToOptions {
+			if opts.Breaker != nil {
+				allowed = append(allowed, opts.Breaker.StrictNetblocks...)
+			}
+		}
+		if fw.TrustLocalhost {
+			allowed = append(allowed, loopbackNetblocks...)
+		}
+		if fw.TrustPrivateRanges {
+			allowed = append(allowed, privateNetblocks...)
+		}
+	}
+	fw.mu.RUnlock()
+
+	commands := []string{
+		fmt.Sprintf("iptables -N %s", IptablesChain),
+		fmt.Sprintf("ip6tables -N %s", IptablesChain),
+	}
+	for _, netblock := range AggregateNetblocks(denied) {
+		commands = append(commands, iptablesRule(netblock, "DROP"))
+	}
+	if !exhaustive {
+		return commands
+	}
+	for _, netblock := range AggregateNetblocks(allowed) {
+		commands = append(commands, iptablesRule(netblock, "RETURN"))
+	}
+	return append(commands,
+		fmt.Sprintf("iptables -A %s -j DROP", IptablesChain),
+		fmt.Sprintf("ip6tables -A %s -j DROP", IptablesChain),
+	)
+}
+
+// exhaustiveAllowList checks whether only sources in some rule's netblocks can ever be allowed, the firewall's lock must be held
+func (fw *Firewall) exhaustiveAllowList() bool {
+	if fw.Rules.FailOpen || fw.FailOpenWhen != nil || fw.AllowPreflight || len(fw.bypasses) > 0 {
+		return false
+	}
+	for _, open := range fw.Rules.MethodFailOpen {
+		if open {
+			return false
+		}
+	}
+	for _, grants := range fw.Rules.PathToGrants {
+		if len(grants) > 0 {
+			return false
+		}
+	}
+	opts := []PathOptions{fw.Rules.DefaultOptions}
+	for _, o := range fw.Rules.PathToOptions {
+		opts = append(opts, o)
+	}
+	for _, o := range opts {
+		if o.Resolver != nil || o.Condition != nil || o.Staged || o.OnUntrusted != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// iptablesRule returns the command appending a rule for a source netblock to IptablesChain
+func iptablesRule(netblock net.IPNet, target string) string {
+	command := "ip6tables"
+	if netblock.IP.To4() != nil {
+		command = "iptables"
+	}
+	return fmt.Sprintf("%s -A %s -s %s -j %s", command, IptablesChain, netblock.String(), target)
+}
+
+// mustParseCIDRs parses a list of network CIDRs known to be valid
+func mustParseCIDRs(networks ...string) []net.IPNet {
+	netblocks, err := parseCIDRs(networks)
+	if err != nil {
+		panic(err)
+	}
+	return netblocks
+}
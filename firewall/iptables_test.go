@@ -0,0 +1,65 @@
+package firewall
+
+import (
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestExportIptables(t *testing.T) {
+	fw := New()
+	if err := fw.AddPathRule("/", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	breaker := &CircuitBreaker{StrictNetblocks: []net.IPNet{mustParseCIDR(t, "192.168.1.0/24")}}
+	if err := fw.AddPathRuleWithOptions("/api", []string{"10.0.0.0/8", "172.16.0.0/12"}, PathOptions{Breaker: breaker}); err != nil {
+		t.Fatal(err)
+	}
+	fw.Rules.DeniedNetblocks = []net.IPNet{mustParseCIDR(t, "203.0.113.0/24")}
+	want := []string{
+		"iptables -N GOFIREWALL",
+		"ip6tables -N GOFIREWALL",
+		"iptables -A GOFIREWALL -s 203.0.113.0/24 -j DROP",
+		"iptables -A GOFIREWALL -s 10.0.0.0/8 -j RETURN",
+		"iptables -A GOFIREWALL -s 172.16.0.0/12 -j RETURN",
+		"iptables -A GOFIREWALL -s 192.168.1.0/24 -j RETURN",
+		"iptables -A GOFIREWALL -j DROP",
+		"ip6tables -A GOFIREWALL -j DROP",
+	}
+	got := fw.ExportIptables()
+	if len(got) != len(want) {
+		t.Fatalf("got commands %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("command %d: got %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestExportIptablesWithoutCatchAllDrop(t *testing.T) {
+	stepUp := func(w http.ResponseWriter, r *http.Request) {}
+	tests := map[string]func(fw *Firewall) error{
+		"staged rule": func(fw *Firewall) error {
+			return fw.AddPathRuleWithOptions("/", []string{"10.0.0.0/8"}, PathOptions{Staged: true})
+		},
+		"OnUntrusted handler": func(fw *Firewall) error {
+			return fw.AddPathRuleWithOptions("/", []string{"10.0.0.0/8"}, PathOptions{OnUntrusted: stepUp})
+		},
+		"default OnUntrusted handler": func(fw *Firewall) error {
+			fw.Rules.DefaultOptions.OnUntrusted = stepUp
+			return fw.AddPathRule("/", []string{"10.0.0.0/8"})
+		},
+	}
+	for name, configure := range tests {
+		fw := New()
+		if err := configure(fw); err != nil {
+			t.Fatal(err)
+		}
+		for _, command := range fw.ExportIptables() {
+			if command == "iptables -A GOFIREWALL -j DROP" {
+				t.Errorf("%s: catch-all drop generated while it can let other sources through", name)
+			}
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package firewall
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// LayerConflict describes a rule defined by more than one tier, see LoadRulesLayer
+type LayerConflict struct {
+	// Path is the path of the conflicting rule, DefaultRule for the default rule
+	Path string
+	// Tier is the tier whose rule is in effect
+	Tier int
+	// Overridden are the lower tiers whose rules for the path are ignored, in ascending order
+	Overridden []int
+}
+
+/*LoadRulesLayer loads a JSON RulesConfig as the rules of a tier, replacing any
+* rules previously loaded for that tier, and replaces the firewall's rule set with
+* the merge of every tier loaded so far. Higher tiers take precedence: a path's
+* rule (allow list, deny list and options) and the default rule come from the
+* highest tier defining them, as do FailOpen and each method's MethodFailOpen,
+* while global deny lists of every tier apply. It returns the rules overridden by
+* higher tiers. Rules changed without LoadRulesLayer are discarded when a layer is
+* loaded, other than the options which can't be part of a config, see PathConfig
+ */
+func (fw *Firewall) LoadRulesLayer(r io.Reader, tier int) (conflicts []LayerConflict, err error) {
+	defer fw.reloadDone(&err)
+
+	var config RulesConfig
+	if err := json.NewDecoder(r).Decode(&config); err != nil {
+		return nil, fmt.Errorf("could not decode rules for tier %d: %s", tier, err)
+	}
+	if _, err := config.Rules(); err != nil {
+		return nil, fmt.Errorf("invalid rules for tier %d: %s", tier, err)
+	}
+
+	fw.mu.Lock()
+	layers := make(map[int]RulesConfig, len(fw.layers)+1)
+	for t, layer := range fw.layers {
+		layers[t] = layer
+	}
+	layers[tier] = config
+	merged, conflicts := mergeLayers(layers)
+	// checked before parsing, the number of paths bounds the number of rules
+	err = fw.checkRuleCount(len(merged.Paths))
+	var rules Rules
+	if err == nil {
+		rules, err = merged.Rules()
+	}
+	if err == nil {
+		rules, err = prepareRules(rules)
+	}
+	if err == nil {
+		rules, err = keepCodeOptions(merged, rules, fw.Rules)
+	}
+	if err != nil {
+		fw.mu.Unlock()
+		return nil, err
+	}
+	fw.layers = layers
+	fw.Rules = rules
+	fw.globalDenyTree.Store(newDenyTree(rules.DeniedNetblocks))
+	fw.groupRefs = nil
+	fw.lastReload = fw.now()
+	fw.version++
+	fw.mu.Unlock()
+
+	fw.ruleChanged(RuleChangeEvent{Action: RulesReloaded, Detail: fmt.Sprintf("loaded tier %d", tier)})
+	return conflicts, nil
+}
+
+// mergeLayers merges the rules of every tier, higher tiers overriding lower ones, reporting the overridden rules
+func mergeLayers(layers map[int]RulesConfig) (RulesConfig, []LayerConflict) {
+	var tiers []int
+	for tier := range layers {
+		tiers = append(tiers, tier)
+	}
+	sort.Ints(tiers)
+
+	merged := RulesConfig{Paths: make(map[string]PathConfig)}
+	definedBy := make(map[string][]int)
+	for _, tier := range tiers {
+		layer := layers[tier]
+		merged.FailOpen = layer.FailOpen
+		for method, open := range layer.MethodFailOpen {
+			if merged.MethodFailOpen == nil {
+				merged.MethodFailOpen = make(map[string]bool)
+			}
+			merged.MethodFailOpen[method] = open
+		}
+		merged.Deny = append(merged.Deny, layer.Deny...)
+		if layer.Default != nil || layer.DefaultOptions != nil {
+			merged.Default, merged.DefaultOptions = layer.Default, layer.DefaultOptions
+			definedBy[DefaultRule] = append(definedBy[DefaultRule], tier)
+		}
+		for path, pathConfig := range layer.Paths {
+			merged.Paths[path] = pathConfig
+			definedBy[path] = append(definedBy[path], tier)
+		}
+	}
+
+	var conflicts []LayerConflict
+	for path, definers := range definedBy {
+		if len(definers) < 2 {
+			continue
+		}
+		conflicts = append(conflicts, LayerConflict{
+			Path:       path,
+			Tier:       definers[len(definers)-1],
+			Overridden: definers[:len(definers)-1],
+		})
+	}
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].Path < conflicts[j].Path })
+	return merged, conflicts
+}
@@ -0,0 +1,89 @@
+package firewall
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestLoadRulesLayer(t *testing.T) {
+	fw := New()
+	tiers := map[int]string{
+		0: `{"deny": ["203.0.113.0/24"], "default": ["10.0.0.0/8"], "paths": {
+			"/shared": {"allow": ["10.0.0.0/8"]},
+			"/org": {"allow": ["10.0.0.0/8"]}
+		}}`,
+		1: `{"default": ["172.16.0.0/12"], "paths": {
+			"/shared": {"allow": ["172.16.0.0/12"]},
+			"/team": {"allow": ["172.16.0.0/12"]}
+		}}`,
+		2: `{"deny": ["198.51.100.0/24"], "paths": {
+			"/shared": {"allow": ["192.168.0.0/16"]},
+			"/team": {"allow": ["192.168.0.0/16"]}
+		}}`,
+	}
+	// tiers take precedence by number, not by the order they are loaded in
+	var conflicts []LayerConflict
+	for _, tier := range []int{2, 0, 1} {
+		var err error
+		if conflicts, err = fw.LoadRulesLayer(strings.NewReader(tiers[tier]), tier); err != nil {
+			t.Fatalf("tier %d: %s", tier, err)
+		}
+	}
+
+	var report []string
+	for _, conflict := range conflicts {
+		report = append(report, fmt.Sprintf("%s:%d%v", conflict.Path, conflict.Tier, conflict.Overridden))
+	}
+	if got, want := strings.Join(report, " "), DefaultRule+":1[0] /shared:2[0 1] /team:2[1]"; got != want {
+		t.Errorf("got conflicts %q, want %q", got, want)
+	}
+
+	tests := []struct {
+		path, src string
+		reason    Reason
+	}{
+		{"/shared", "192.168.1.1", ReasonTrusted},
+		{"/shared", "172.16.0.1", ReasonUntrusted},
+		{"/shared", "10.1.2.3", ReasonUntrusted},
+		{"/team", "192.168.1.1", ReasonTrusted},
+		{"/team", "172.16.0.1", ReasonUntrusted},
+		{"/org", "10.1.2.3", ReasonTrusted},
+		{"/other", "172.16.0.1", ReasonTrusted},
+		{"/other", "10.1.2.3", ReasonUntrusted},
+		// the deny lists of every tier apply
+		{"/org", "203.0.113.1", ReasonDenied},
+		{"/shared", "198.51.100.1", ReasonDenied},
+	}
+	for _, test := range tests {
+		if d := fw.Decide(newTestRequest(http.MethodGet, test.path, test.src)); d.Reason != test.reason {
+			t.Errorf("%s from %s: got %s, want %s", test.path, test.src, d.Reason, test.reason)
+		}
+	}
+
+	// reloading a tier replaces its rules
+	conflicts, err := fw.LoadRulesLayer(strings.NewReader(`{"paths": {}}`), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conflicts) != 1 || conflicts[0].Path != "/shared" || conflicts[0].Tier != 2 || len(conflicts[0].Overridden) != 1 {
+		t.Errorf("got conflicts %+v, want only tier 2 overriding tier 0 for /shared", conflicts)
+	}
+	if d := fw.Decide(newTestRequest(http.MethodGet, "/other", "10.1.2.3")); d.Reason != ReasonTrusted {
+		t.Errorf("got %s, want the tier 0 default rule once tier 1 no longer defines one", d.Reason)
+	}
+}
+
+func TestLoadRulesLayerRejectsInvalidTier(t *testing.T) {
+	fw := New()
+	if _, err := fw.LoadRulesLayer(strings.NewReader(`{"paths": {"/a": {"allow": ["10.0.0.0/8"]}}}`), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fw.LoadRulesLayer(strings.NewReader(`{"paths": {"/a": {"allow": ["not a cidr"]}}}`), 1); err == nil {
+		t.Fatal("loaded a tier with an invalid netblock")
+	}
+	if d := fw.Decide(newTestRequest(http.MethodGet, "/a", "10.1.2.3")); d.Reason != ReasonTrusted {
+		t.Errorf("got %s, want the loaded tiers to still apply", d.Reason)
+	}
+}
@@ -0,0 +1,92 @@
+package firewall
+
+import "net"
+
+// DefaultMaxLearnedSources is the number of sources learned when MaxLearnedSources is not set
+const DefaultMaxLearnedSources = 10000
+
+// learnedSources are the source netblocks observed per path in learning mode
+type learnedSources struct {
+	paths   map[string]map[string]net.IPNet
+	count   int
+	dropped int
+}
+
+/*learn records a request's source for its path when Learn is set, summarized to
+* LearnIPv4PrefixLength or LearnIPv6PrefixLength. Once MaxLearnedSources distinct
+* path and netblock pairs are recorded, further ones are dropped
+ */
+func (fw *Firewall) learn(d Decision) {
+	fw.mu.RLock()
+	learn, v4, v6, limit := fw.Learn, fw.LearnIPv4PrefixLength, fw.LearnIPv6PrefixLength, fw.MaxLearnedSources
+	fw.mu.RUnlock()
+
+	if !learn || d.SrcIP == nil {
+		return
+	}
+	netblock := HostNetblock(d.SrcIP)
+	if ip4 := d.SrcIP.To4(); ip4 != nil && v4 > 0 {
+		netblock = net.IPNet{IP: TruncateIP(ip4, v4), Mask: net.CIDRMask(v4, 8*net.IPv4len)}
+	} else if ip4 == nil && v6 > 0 {
+		netblock = net.IPNet{IP: TruncateIP(d.SrcIP, v6), Mask: net.CIDRMask(v6, 8*net.IPv6len)}
+	}
+	if limit <= 0 {
+		limit = DefaultMaxLearnedSources
+	}
+
+	fw.learnedMu.Lock()
+	defer fw.learnedMu.Unlock()
+
+	if fw.learned.paths == nil {
+		fw.learned.paths = make(map[string]map[string]net.IPNet)
+	}
+	sources := fw.learned.paths[d.Path]
+	if _, seen := sources[netblock.String()]; seen {
+		return
+	}
+	if fw.learned.count >= limit {
+		fw.learned.dropped++
+		return
+	}
+	if sources == nil {
+		sources = make(map[string]net.IPNet)
+		fw.learned.paths[d.Path] = sources
+	}
+	sources[netblock.String()] = netblock
+	fw.learned.count++
+}
+
+/*SuggestRules returns, for every path observed in learning mode, the aggregated
+* netblocks of the sources seen requesting it, as sorted network CIDRs ready to be
+* passed to AddPathRule or SetPathRule
+ */
+func (fw *Firewall) SuggestRules() map[string][]string {
+	fw.learnedMu.Lock()
+	defer fw.learnedMu.Unlock()
+
+	suggestions := make(map[string][]string, len(fw.learned.paths))
+	for path, sources := range fw.learned.paths {
+		var netblocks []net.IPNet
+		for _, netblock := range sources {
+			netblocks = append(netblocks, netblock)
+		}
+		suggestions[path] = formatCIDRs(AggregateNetblocks(netblocks))
+	}
+	return suggestions
+}
+
+// LearnedSourcesDropped returns how many sources were not learned since the last reset because MaxLearnedSources was reached
+func (fw *Firewall) LearnedSourcesDropped() int {
+	fw.learnedMu.Lock()
+	defer fw.learnedMu.Unlock()
+
+	return fw.learned.dropped
+}
+
+// ResetLearning forgets every source observed in learning mode
+func (fw *Firewall) ResetLearning() {
+	fw.learnedMu.Lock()
+	defer fw.learnedMu.Unlock()
+
+	fw.learned = learnedSources{}
+}
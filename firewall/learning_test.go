@@ -0,0 +1,88 @@
+package firewall
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSuggestRules(t *testing.T) {
+	fw := New()
+	fw.Learn = true
+	fw.LearnIPv4PrefixLength = 24
+	// observed in fail-open mode, so that requests aren't blocked while learning
+	fw.Rules.FailOpen = true
+	h := fw.Wrap(func(w http.ResponseWriter, r *http.Request) {})
+	traffic := map[string][]string{
+		// two adjacent /24s, aggregated into a /23
+		"/api": {"10.1.2.3", "10.1.2.200", "10.1.3.7", "10.1.3.7"},
+		// privacy addresses within a /64
+		"/app": {"2001:db8:1:2::a", "2001:db8:1:2::b", "192.0.2.55"},
+	}
+	for path, sources := range traffic {
+		for _, src := range sources {
+			h.ServeHTTP(httptest.NewRecorder(), newTestRequest(http.MethodGet, path, src))
+		}
+	}
+
+	suggestions := fw.SuggestRules()
+	want := map[string]string{
+		"/api": "10.1.2.0/23",
+		"/app": "192.0.2.0/24 2001:db8:1:2::/64",
+	}
+	if len(suggestions) != len(want) {
+		t.Errorf("got suggestions %v, want %v", suggestions, want)
+	}
+	for path, networks := range want {
+		if got := strings.Join(suggestions[path], " "); got != networks {
+			t.Errorf("%s: got %q, want %q", path, got, networks)
+		}
+	}
+
+	// suggestions are ready to be applied
+	for path, networks := range suggestions {
+		if err := fw.SetPathRule(path, networks); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := fw.Decide(newTestRequest(http.MethodGet, "/api", "10.1.3.250")); d.Reason != ReasonTrusted {
+		t.Errorf("got %s once the suggestions were applied, want trusted", d.Reason)
+	}
+
+	fw.ResetLearning()
+	if suggestions := fw.SuggestRules(); len(suggestions) != 0 {
+		t.Errorf("got suggestions %v after a reset, want none", suggestions)
+	}
+}
+
+func TestLearningIsBounded(t *testing.T) {
+	fw := New()
+	fw.Learn = true
+	fw.MaxLearnedSources = 10
+	h := fw.Wrap(func(w http.ResponseWriter, r *http.Request) {})
+	for i := 0; i < 25; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), newTestRequest(http.MethodGet, "/api", fmt.Sprintf("198.51.100.%d", 2*i)))
+	}
+	// sources already learned don't count against the cap
+	h.ServeHTTP(httptest.NewRecorder(), newTestRequest(http.MethodGet, "/api", "198.51.100.0"))
+	if dropped := fw.LearnedSourcesDropped(); dropped != 15 {
+		t.Errorf("dropped %d sources, want 15", dropped)
+	}
+	if got := len(fw.SuggestRules()["/api"]); got != 10 {
+		t.Errorf("got %d suggested netblocks, want 10", got)
+	}
+	fw.ResetLearning()
+	if dropped := fw.LearnedSourcesDropped(); dropped != 0 {
+		t.Errorf("dropped %d sources after a reset, want 0", dropped)
+	}
+}
+
+func TestLearningOff(t *testing.T) {
+	fw := New()
+	fw.Wrap(func(w http.ResponseWriter, r *http.Request) {}).ServeHTTP(httptest.NewRecorder(), newTestRequest(http.MethodGet, "/api", "10.1.2.3"))
+	if suggestions := fw.SuggestRules(); len(suggestions) != 0 {
+		t.Errorf("got suggestions %v without learning mode", suggestions)
+	}
+}
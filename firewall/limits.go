@@ -0,0 +1,246 @@
+package firewall
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+/*Limiter counts requests per key within fixed windows of time. The default
+* implementation is in-memory, a shared implementation (e.g. Redis backed)
+* lets multiple replicas enforce the same rate limits. It is called without the
+* firewall's lock held, so it may block on the network
+ */
+type Limiter interface {
+	// Increment records a hit for a key and returns the number of hits
+	// recorded for it within the current window
+	Increment(key string, window time.Duration) (int, error)
+}
+
+/*BanStore keeps track of banned keys. The default implementation is in-memory,
+* a shared implementation (e.g. Redis backed) lets multiple replicas enforce
+* the same bans. It is called without the firewall's lock held
+ */
+type BanStore interface {
+	// IsBanned checks whether a key is currently banned
+	IsBanned(key string) (bool, error)
+	// Ban bans a key for the given duration
+	Ban(key string, duration time.Duration) error
+}
+
+/*BanExpiryStore is a BanStore which also reports when bans expire, letting the
+* firewall tell banned clients when to retry with a Retry-After header
+ */
+type BanExpiryStore interface {
+	BanStore
+	// BannedUntil returns when a key's ban expires, the zero time when it is not banned
+	BannedUntil(key string) (time.Time, error)
+}
+
+type window struct {
+	start time.Time
+	hits  int
+}
+
+// MemoryLimiter is an in-memory, fixed window implementation of Limiter
+type MemoryLimiter struct {
+	now func() time.Time
+
+	mu        sync.Mutex
+	windows   map[string]*window
+	lastSweep time.Time
+}
+
+// NewMemoryLimiter is the constructor for an in-memory Limiter, now defaults to time.Now when nil
+func NewMemoryLimiter(now func() time.Time) *MemoryLimiter {
+	if now == nil {
+		now = time.Now
+	}
+	return &MemoryLimiter{
+		now:     now,
+		windows: make(map[string]*window),
+	}
+}
+
+// Increment records a hit for a key and returns the number of hits within the current window
+func (l *MemoryLimiter) Increment(key string, d time.Duration) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	// drop windows which have ended so idle keys don't accumulate
+	if now.Sub(l.lastSweep) >= d {
+		for k, w := range l.windows {
+			if now.Sub(w.start) >= d {
+				delete(l.windows, k)
+			}
+		}
+		l.lastSweep = now
+	}
+	w, ok := l.windows[key]
+	if !ok || now.Sub(w.start) >= d {
+		w = &window{start: now}
+		l.windows[key] = w
+	}
+	w.hits++
+	return w.hits, nil
+}
+
+// MemoryBanStore is an in-memory implementation of BanStore
+type MemoryBanStore struct {
+	now func() time.Time
+
+	mu   sync.Mutex
+	bans map[string]time.Time
+}
+
+// NewMemoryBanStore is the constructor for an in-memory BanStore, now defaults to time.Now when nil
+func NewMemoryBanStore(now func() time.Time) *MemoryBanStore {
+	if now == nil {
+		now = time.Now
+	}
+	return &MemoryBanStore{
+		now:  now,
+		bans: make(map[string]time.Time),
+	}
+}
+
+// IsBanned checks whether a key is currently banned
+func (b *MemoryBanStore) IsBanned(key string) (bool, error) {
+	until, err := b.BannedUntil(key)
+	return !until.IsZero(), err
+}
+
+// BannedUntil returns when a key's ban expires, the zero time when it is not banned
+func (b *MemoryBanStore) BannedUntil(key string) (time.Time, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	until, ok := b.bans[key]
+	if !ok {
+		return time.Time{}, nil
+	}
+	if !b.now().Before(until) {
+		delete(b.bans, key)
+		return time.Time{}, nil
+	}
+	return until, nil
+}
+
+// Ban bans a key for the given duration
+func (b *MemoryBanStore) Ban(key string, duration time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.bans[key] = b.now().Add(duration)
+	return nil
+}
+
+// limiter returns the firewall's Limiter, defaulting to an in-memory one
+func (fw *Firewall) limiter() Limiter {
+	if fw.Limiter != nil {
+		return fw.Limiter
+	}
+	fw.storesOnce.Do(fw.initStores)
+	return fw.memoryLimiter
+}
+
+// banStore returns the firewall's BanStore, defaulting to an in-memory one
+func (fw *Firewall) banStore() BanStore {
+	if fw.BanStore != nil {
+		return fw.BanStore
+	}
+	fw.storesOnce.Do(fw.initStores)
+	return fw.memoryBanStore
+}
+
+func (fw *Firewall) initStores() {
+	fw.memoryLimiter = NewMemoryLimiter(fw.now)
+	fw.memoryBanStore = NewMemoryBanStore(fw.now)
+}
+
+/*limitSettings are the rate limit and ban settings of a firewall, copied under its
+* lock so that the stores, which may be remote, are consulted without holding it
+ */
+type limitSettings struct {
+	enabled     bool
+	rateLimit   int
+	window      time.Duration
+	banDuration time.Duration
+	limiter     Limiter
+	banStore    BanStore
+}
+
+// limitSettings copies the firewall's rate limit and ban settings, the firewall's lock must be held
+func (fw *Firewall) limitSettings() limitSettings {
+	if fw.RateLimit <= 0 && fw.BanStore == nil {
+		return limitSettings{}
+	}
+	return limitSettings{
+		enabled:     true,
+		rateLimit:   fw.RateLimit,
+		window:      fw.rateWindow(),
+		banDuration: fw.BanDuration,
+		limiter:     fw.limiter(),
+		banStore:    fw.banStore(),
+	}
+}
+
+/*checkLimits consults the ban list and rate limit for a source IP, returning
+* false along with the reason, and how long until the source may retry when it
+* is known, when the request must be dropped. Errors from the stores are logged
+* and do not cause requests to be dropped. It must be called without the
+* firewall's lock held
+ */
+func (fw *Firewall) checkLimits(limits limitSettings, src net.IP) (Reason, time.Duration, bool) {
+	if src == nil || !limits.enabled {
+		return 0, 0, true
+	}
+	key := src.String()
+	banned, retryAfter, err := fw.isBanned(limits.banStore, key)
+	if err != nil {
+		fw.logfUnlocked("could not check ban for %s: %s", key, err)
+	}
+	if banned {
+		return ReasonBanned, retryAfter, false
+	}
+	if limits.rateLimit <= 0 {
+		return 0, 0, true
+	}
+	hits, err := limits.limiter.Increment(key, limits.window)
+	if err != nil {
+		fw.logfUnlocked("could not check rate limit for %s: %s", key, err)
+		return 0, 0, true
+	}
+	if hits <= limits.rateLimit {
+		return 0, 0, true
+	}
+	if limits.banDuration > 0 {
+		if err := limits.banStore.Ban(key, limits.banDuration); err != nil {
+			fw.logfUnlocked("could not ban %s: %s", key, err)
+		}
+		return ReasonRateLimited, limits.banDuration, false
+	}
+	return ReasonRateLimited, 0, false
+}
+
+// isBanned checks whether a key is banned in a store and, when the store reports it, how long until the ban expires
+func (fw *Firewall) isBanned(store BanStore, key string) (bool, time.Duration, error) {
+	if expiring, ok := store.(BanExpiryStore); ok {
+		until, err := expiring.BannedUntil(key)
+		if err != nil || until.IsZero() {
+			return false, 0, err
+		}
+		return true, until.Sub(fw.now()), nil
+	}
+	banned, err := store.IsBanned(key)
+	return banned, 0, err
+}
+
+// rateWindow returns the window rate limits are enforced over
+func (fw *Firewall) rateWindow() time.Duration {
+	if fw.RateWindow > 0 {
+		return fw.RateWindow
+	}
+	return time.Minute
+}
@@ -0,0 +1,201 @@
+package firewall
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimitBans(t *testing.T) {
+	fw := New()
+	fw.RateLimit = 2
+	fw.BanDuration = time.Minute
+	if err := fw.AddPathRule("/", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	want := []Reason{ReasonTrusted, ReasonTrusted, ReasonRateLimited, ReasonBanned}
+	for i, reason := range want {
+		if d := fw.decide(newTestRequest(http.MethodGet, "/", "10.1.2.3"), true); d.Reason != reason {
+			t.Errorf("request %d: got %s, want %s", i, d.Reason, reason)
+		}
+	}
+	if d := fw.decide(newTestRequest(http.MethodGet, "/", "10.1.2.4"), true); d.Reason != ReasonTrusted {
+		t.Errorf("got %s for another source, want trusted", d.Reason)
+	}
+	if !fw.rejectsConn(net.ParseIP("10.1.2.3")) {
+		t.Error("connection from a banned source was not rejected")
+	}
+	if fw.rejectsConn(net.ParseIP("10.1.2.4")) {
+		t.Error("connection from a source which is not banned was rejected")
+	}
+}
+
+// blockingBanStore is a BanStore whose lookups block until released
+type blockingBanStore struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s blockingBanStore) IsBanned(key string) (bool, error) {
+	s.started <- struct{}{}
+	<-s.release
+	return false, nil
+}
+
+func (s blockingBanStore) Ban(key string, duration time.Duration) error { return nil }
+
+func TestSlowBanStoreDoesNotHoldLock(t *testing.T) {
+	store := blockingBanStore{started: make(chan struct{}, 2), release: make(chan struct{})}
+	fw := New()
+	fw.BanStore = store
+	if err := fw.AddPathRule("/", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	decided := make(chan Decision)
+	go func() { decided <- fw.decide(newTestRequest(http.MethodGet, "/", "10.1.2.3"), true) }()
+	rejected := make(chan bool)
+	go func() { rejected <- fw.rejectsConn(net.ParseIP("10.1.2.3")) }()
+	<-store.started
+	<-store.started
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := fw.AddPathRule("/new", []string{"10.0.0.0/8"}); err != nil {
+			t.Error(err)
+		}
+		fw.Explain(newTestRequest(http.MethodGet, "/new", "10.1.2.3"))
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a slow ban store blocked rule changes and other requests")
+	}
+	close(store.release)
+	if d := <-decided; d.Reason != ReasonTrusted {
+		t.Errorf("got %s once the ban store answered, want trusted", d.Reason)
+	}
+	if <-rejected {
+		t.Error("connection rejected although the source is not banned")
+	}
+}
+
+// fakeStore is an in-memory Limiter and BanStore, shared by firewalls as a Redis backed store would be
+type fakeStore struct {
+	mu   sync.Mutex
+	hits map[string]int
+	bans map[string]bool
+	err  error
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{hits: make(map[string]int), bans: make(map[string]bool)}
+}
+
+func (s *fakeStore) Increment(key string, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return 0, s.err
+	}
+	s.hits[key]++
+	return s.hits[key], nil
+}
+
+func (s *fakeStore) IsBanned(key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.bans[key], s.err
+}
+
+func (s *fakeStore) Ban(key string, duration time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.bans[key] = true
+	return s.err
+}
+
+func TestSharedStores(t *testing.T) {
+	store := newFakeStore()
+	replicas := make([]*Firewall, 2)
+	for i := range replicas {
+		fw := New()
+		fw.RateLimit = 2
+		fw.BanDuration = time.Minute
+		fw.Limiter, fw.BanStore = store, store
+		if err := fw.AddPathRule("/", []string{"10.0.0.0/8"}); err != nil {
+			t.Fatal(err)
+		}
+		replicas[i] = fw
+	}
+	want := []Reason{ReasonTrusted, ReasonTrusted, ReasonRateLimited, ReasonBanned}
+	for i, reason := range want {
+		fw := replicas[i%len(replicas)]
+		if d := fw.decide(newTestRequest(http.MethodGet, "/", "10.1.2.3"), true); d.Reason != reason {
+			t.Errorf("request %d: got %s, want %s", i, d.Reason, reason)
+		}
+	}
+	if !store.bans["10.1.2.3"] {
+		t.Error("source exceeding the rate limit not banned in the shared store")
+	}
+}
+
+func TestStoreErrorsDoNotDropRequests(t *testing.T) {
+	store := newFakeStore()
+	store.err = errors.New("store unavailable")
+	fw := New()
+	fw.RateLimit = 1
+	fw.Limiter, fw.BanStore = store, store
+	if err := fw.AddPathRule("/", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if d := fw.decide(newTestRequest(http.MethodGet, "/", "10.1.2.3"), true); d.Reason != ReasonTrusted {
+			t.Errorf("request %d: got %s while the store fails, want trusted", i, d.Reason)
+		}
+	}
+}
+
+func TestMemoryLimiterWindows(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := NewMemoryLimiter(func() time.Time { return now })
+	for want := 1; want <= 3; want++ {
+		if hits, _ := l.Increment("a", time.Minute); hits != want {
+			t.Errorf("got %d hits, want %d", hits, want)
+		}
+	}
+	if hits, _ := l.Increment("b", time.Minute); hits != 1 {
+		t.Errorf("got %d hits for another key, want 1", hits)
+	}
+	now = now.Add(time.Minute)
+	if hits, _ := l.Increment("a", time.Minute); hits != 1 {
+		t.Errorf("got %d hits in a new window, want 1", hits)
+	}
+}
+
+func TestMemoryBanStoreExpiry(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	b := NewMemoryBanStore(func() time.Time { return now })
+	if err := b.Ban("a", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if banned, _ := b.IsBanned("a"); !banned {
+		t.Error("key not banned")
+	}
+	if until, _ := b.BannedUntil("a"); !until.Equal(now.Add(time.Minute)) {
+		t.Errorf("got ban until %s, want %s", until, now.Add(time.Minute))
+	}
+	if banned, _ := b.IsBanned("b"); banned {
+		t.Error("key which was never banned is banned")
+	}
+	now = now.Add(time.Minute)
+	if banned, _ := b.IsBanned("a"); banned {
+		t.Error("key still banned once the ban expired")
+	}
+}
@@ -0,0 +1,58 @@
+package firewall
+
+import "net"
+
+/*WrapListener wraps a net.Listener so that connections from sources in the global
+* deny list, or which are banned, are closed as soon as they are accepted, before
+* any HTTP parsing. Path rules are still evaluated by Wrap. Source IPs are the
+* peers' addresses, so wrap the listener accepting connections from clients: a
+* ProxyProtocolListener must not be wrapped, as reading its connections' addresses
+* blocks on the PROXY protocol header
+ */
+func (fw *Firewall) WrapListener(l net.Listener) net.Listener {
+	return &denyListener{Listener: l, fw: fw}
+}
+
+type denyListener struct {
+	net.Listener
+	fw *Firewall
+}
+
+// Accept waits for and returns the next connection from a source which is not denied
+func (l *denyListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if !l.fw.rejectsConn(addrIP(conn.RemoteAddr())) {
+			return conn, nil
+		}
+		conn.Close()
+	}
+}
+
+// rejectsConn checks whether connections from a source must be closed on accept
+func (fw *Firewall) rejectsConn(src net.IP) bool {
+	fw.mu.RLock()
+	if fw.globalDenied(src) {
+		fw.logf("closed connection from denied source %s", src)
+		fw.mu.RUnlock()
+		return true
+	}
+	limits := fw.limitSettings()
+	fw.mu.RUnlock()
+
+	if src == nil || !limits.enabled {
+		return false
+	}
+	// the store may be remote, it is consulted without holding the lock
+	banned, err := limits.banStore.IsBanned(src.String())
+	if err != nil {
+		fw.logfUnlocked("could not check ban for %s: %s", src, err)
+	}
+	if banned {
+		fw.logfUnlocked("closed connection from banned source %s", src)
+	}
+	return banned
+}
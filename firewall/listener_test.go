@@ -0,0 +1,83 @@
+package firewall
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// fakeConn is a connection from a given remote address, recording whether it was closed
+type fakeConn struct {
+	net.Conn
+	remote net.Addr
+	closed bool
+}
+
+func (c *fakeConn) RemoteAddr() net.Addr { return c.remote }
+
+func (c *fakeConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+// fakeListener accepts the given connections in order, then fails
+type fakeListener struct {
+	net.Listener
+	conns []*fakeConn
+}
+
+var errListenerClosed = errors.New("listener closed")
+
+func (l *fakeListener) Accept() (net.Conn, error) {
+	if len(l.conns) == 0 {
+		return nil, errListenerClosed
+	}
+	conn := l.conns[0]
+	l.conns = l.conns[1:]
+	return conn, nil
+}
+
+func newFakeConn(ip string) *fakeConn {
+	return &fakeConn{remote: &net.TCPAddr{IP: net.ParseIP(ip), Port: 1234}}
+}
+
+func TestWrapListener(t *testing.T) {
+	fw := New()
+	fw.RateLimit = 1
+	fw.BanDuration = time.Minute
+	fw.Rules.DeniedNetblocks = []net.IPNet{mustParseCIDR(t, "203.0.113.0/24")}
+	if err := fw.AddPathRule("/", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	// ban 10.9.9.9 by exceeding the rate limit
+	for i := 0; i < 2; i++ {
+		fw.decide(newTestRequest(http.MethodGet, "/", "10.9.9.9"), true)
+	}
+
+	denied, banned := newFakeConn("203.0.113.7"), newFakeConn("10.9.9.9")
+	allowed, untrusted := newFakeConn("10.1.2.3"), newFakeConn("198.51.100.1")
+	l := fw.WrapListener(&fakeListener{conns: []*fakeConn{denied, banned, allowed, untrusted}})
+
+	// rejected connections are skipped over
+	for _, want := range []*fakeConn{allowed, untrusted} {
+		conn, err := l.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conn != want {
+			t.Errorf("accepted the connection from %s, want %s", conn.RemoteAddr(), want.RemoteAddr())
+		}
+	}
+	if _, err := l.Accept(); err != errListenerClosed {
+		t.Errorf("got error %v, want the listener's", err)
+	}
+	if !denied.closed || !banned.closed {
+		t.Errorf("got denied closed=%t and banned closed=%t, want both closed", denied.closed, banned.closed)
+	}
+	// path rules are left to Wrap
+	if allowed.closed || untrusted.closed {
+		t.Error("closed a connection from a source which is not denied")
+	}
+}
@@ -0,0 +1,62 @@
+package firewall
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+)
+
+// onPort returns a request as if it arrived on a server listening on a given port
+func onPort(r *http.Request, port int) *http.Request {
+	addr := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: port}
+	return r.WithContext(context.WithValue(r.Context(), http.LocalAddrContextKey, addr))
+}
+
+func TestListenerPorts(t *testing.T) {
+	fw := New()
+	if err := fw.AddPathRuleWithOptions("/admin", []string{"10.0.0.0/8"}, PathOptions{Listeners: []string{"8443"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.AddPathRule("/public", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path   string
+		port   int
+		reason Reason
+	}{
+		{"/admin", 8443, ReasonTrusted},
+		{"/admin", 443, ReasonWrongListener},
+		{"/public", 8443, ReasonTrusted},
+		{"/public", 443, ReasonTrusted},
+	}
+	for _, test := range tests {
+		r := onPort(newTestRequest(http.MethodGet, test.path, "10.1.2.3"), test.port)
+		if d := fw.Decide(r); d.Reason != test.reason {
+			t.Errorf("%s on port %d: got %s, want %s", test.path, test.port, d.Reason, test.reason)
+		}
+	}
+	// requests which didn't arrive through a server have no listener
+	if d := fw.Decide(newTestRequest(http.MethodGet, "/admin", "10.1.2.3")); d.Reason != ReasonWrongListener {
+		t.Errorf("got %s without a local address, want wrong_listener", d.Reason)
+	}
+}
+
+func TestListenerLabel(t *testing.T) {
+	for listener, reason := range map[string]Reason{"internal": ReasonTrusted, "external": ReasonWrongListener} {
+		fw := New()
+		fw.Listener = listener
+		if err := fw.AddPathRuleWithOptions("/admin", []string{"10.0.0.0/8"}, PathOptions{Listeners: []string{"internal"}}); err != nil {
+			t.Fatal(err)
+		}
+		// the label takes precedence over the port
+		r := onPort(newTestRequest(http.MethodGet, "/admin", "10.1.2.3"), 8443)
+		if name := fw.ListenerName(r); name != listener {
+			t.Errorf("got listener name %q, want %q", name, listener)
+		}
+		if d := fw.Decide(r); d.Reason != reason {
+			t.Errorf("%s listener: got %s, want %s", listener, d.Reason, reason)
+		}
+	}
+}
@@ -0,0 +1,375 @@
+package firewall
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+)
+
+/*RulesConfig is the JSON schema for loading a rule set, e.g.
+*	{
+*		"fail_open": false,
+*		"deny": ["203.0.113.0/24"],
+*		"default": ["10.0.0.0/8"],
+*		"paths": {
+*			"/hello_world": {
+*				"allow": ["192.168.0.0/16"],
+*				"deny": ["192.168.1.0/24"]
+*			}
+*		}
+*	}
+* See Rules for the precedence in which allow and deny lists are evaluated
+ */
+type RulesConfig struct {
+	FailOpen       bool            `json:"fail_open"`
+	MethodFailOpen map[string]bool `json:"method_fail_open,omitempty"`
+	Deny           []string        `json:"deny,omitempty"`
+	Default        []string        `json:"default,omitempty"`
+	// DefaultOptions are the options of the default rule, its allow and deny lists are ignored
+	DefaultOptions *PathConfig           `json:"default_options,omitempty"`
+	Paths          map[string]PathConfig `json:"paths"`
+}
+
+/*PathConfig is the JSON schema for the rule of a single path. A path with no
+* allow list (as opposed to an empty one) only contributes its deny list, and
+* is otherwise evaluated by the default rule. The remaining members correspond
+* to the fields of PathOptions, TLS versions are written as e.g. "1.2" and cipher
+* suites by name, e.g. "TLS_RSA_WITH_AES_128_CBC_SHA". Options which are code,
+* or secrets, are listed by name in CodeOptions (e.g. "resolver"): loading a config
+* keeps them from the firewall's current rule for the path, and fails when it
+* doesn't have them
+ */
+type PathConfig struct {
+	Allow                  []string `json:"allow"`
+	Deny                   []string `json:"deny,omitempty"`
+	MatchRequestURI        bool     `json:"match_request_uri,omitempty"`
+	UserAgent              string   `json:"user_agent,omitempty"`
+	RequireTrustedChain    bool     `json:"require_trusted_chain,omitempty"`
+	RequireTLS             bool     `json:"require_tls,omitempty"`
+	MinTLSVersion          string   `json:"min_tls_version,omitempty"`
+	DisallowedCipherSuites []string `json:"disallowed_cipher_suites,omitempty"`
+	Methods                []string `json:"methods,omitempty"`
+	Listeners              []string `json:"listeners,omitempty"`
+	MaxBodyBytes           int64    `json:"max_body_bytes,omitempty"`
+	MaxConcurrent          int      `json:"max_concurrent,omitempty"`
+	ShedAbove              float64  `json:"shed_above,omitempty"`
+	SignatureHeader        string   `json:"signature_header,omitempty"`
+	RequiredClaim          string   `json:"required_claim,omitempty"`
+	RequiredClaimValue     string   `json:"required_claim_value,omitempty"`
+	CodeOptions            []string `json:"code_options,omitempty"`
+	Staged                 bool     `json:"staged,omitempty"`
+	EnforcePercentage      float64  `json:"enforce_percentage,omitempty"`
+	Disabled               bool     `json:"disabled,omitempty"`
+}
+
+// options returns the PathOptions described by a PathConfig
+func (pathConfig PathConfig) options() (PathOptions, error) {
+	opts := PathOptions{
+		MatchRequestURI:     pathConfig.MatchRequestURI,
+		UserAgent:           pathConfig.UserAgent,
+		RequireTrustedChain: pathConfig.RequireTrustedChain,
+		RequireTLS:          pathConfig.RequireTLS,
+		Methods:             pathConfig.Methods,
+		Listeners:           pathConfig.Listeners,
+		MaxBodyBytes:        pathConfig.MaxBodyBytes,
+		MaxConcurrent:       pathConfig.MaxConcurrent,
+		ShedAbove:           pathConfig.ShedAbove,
+		SignatureHeader:     pathConfig.SignatureHeader,
+		RequiredClaim:       pathConfig.RequiredClaim,
+		RequiredClaimValue:  pathConfig.RequiredClaimValue,
+		Staged:              pathConfig.Staged,
+		EnforcePercentage:   pathConfig.EnforcePercentage,
+	}
+	if pathConfig.MinTLSVersion != "" {
+		version, ok := tlsVersions[pathConfig.MinTLSVersion]
+		if !ok {
+			return PathOptions{}, fmt.Errorf("unknown TLS version: %s", pathConfig.MinTLSVersion)
+		}
+		opts.MinTLSVersion = version
+	}
+	for _, name := range pathConfig.DisallowedCipherSuites {
+		suite, ok := cipherSuiteID(name)
+		if !ok {
+			return PathOptions{}, fmt.Errorf("unknown cipher suite: %s", name)
+		}
+		opts.DisallowedCipherSuites = append(opts.DisallowedCipherSuites, suite)
+	}
+	return opts, nil
+}
+
+// codeOptions names the options which are set and can't be part of a PathConfig, see PathConfig.CodeOptions
+func (opts PathOptions) codeOptions() []string {
+	var names []string
+	for _, option := range []struct {
+		name string
+		set  bool
+	}{
+		{"condition", opts.Condition != nil},
+		{"resolver", opts.Resolver != nil},
+		{"extra_condition", opts.ExtraCondition != nil},
+		{"on_untrusted", opts.OnUntrusted != nil},
+		{"signature_secret", opts.SignatureSecret != nil},
+		{"token_verifier", opts.TokenVerifier != nil},
+		{"breaker", opts.Breaker != nil},
+	} {
+		if option.set {
+			names = append(names, option.name)
+		}
+	}
+	return names
+}
+
+// withCodeOptions sets the options which can't be part of a PathConfig to those of another rule's options
+func (opts PathOptions) withCodeOptions(from PathOptions) PathOptions {
+	opts.Condition = from.Condition
+	opts.Resolver = from.Resolver
+	opts.ExtraCondition = from.ExtraCondition
+	opts.OnUntrusted = from.OnUntrusted
+	opts.SignatureSecret = from.SignatureSecret
+	opts.TokenVerifier = from.TokenVerifier
+	opts.Breaker = from.Breaker
+	return opts
+}
+
+/*keepCodeOptions carries the options which can't be part of a config, such as a
+* Resolver or a SignatureSecret, over from the current rule for each path (and the
+* default rule) to the rules loaded from the config. As dropping one of them could
+* turn a rule which blocks requests into one which allows them, loading fails when
+* a rule's CodeOptions names one which the current rule doesn't have, or when its
+* SignatureHeader or RequiredClaim is set without a secret or verifier to check it
+ */
+func keepCodeOptions(config RulesConfig, rules, current Rules) (Rules, error) {
+	rules.DefaultOptions = rules.DefaultOptions.withCodeOptions(current.DefaultOptions)
+	if config.DefaultOptions != nil {
+		if err := checkCodeOptions(*config.DefaultOptions, rules.DefaultOptions); err != nil {
+			return Rules{}, fmt.Errorf("invalid default options: %s", err)
+		}
+	}
+	for path, opts := range rules.PathToOptions {
+		opts = opts.withCodeOptions(current.PathToOptions[path])
+		if err := checkCodeOptions(config.Paths[path], opts); err != nil {
+			return Rules{}, fmt.Errorf("invalid options for path %s: %s", path, err)
+		}
+		rules.PathToOptions[path] = opts
+	}
+	return rules, nil
+}
+
+// checkCodeOptions checks that options have the code options a PathConfig requires
+func checkCodeOptions(pathConfig PathConfig, opts PathOptions) error {
+	have := opts.codeOptions()
+	for _, name := range pathConfig.CodeOptions {
+		if !containsString(have, name) {
+			return fmt.Errorf("%s can't be loaded from a config and is not set on the current rule", name)
+		}
+	}
+	if opts.SignatureHeader != "" && opts.SignatureSecret == nil {
+		return errors.New("signature_header is set without a signature secret")
+	}
+	if (opts.RequiredClaim != "" || opts.RequiredClaimValue != "") && opts.TokenVerifier == nil {
+		return errors.New("required_claim is set without a token verifier")
+	}
+	return nil
+}
+
+// tlsVersions are the TLS versions accepted by PathConfig.MinTLSVersion
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// cipherSuiteID returns the ID of a cipher suite, secure or not, by name
+func cipherSuiteID(name string) (uint16, bool) {
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		if suite.Name == name {
+			return suite.ID, true
+		}
+	}
+	return 0, false
+}
+
+/*LoadRules replaces the firewall's rule set with one decoded from a JSON RulesConfig.
+* Options which can't be part of the config are kept from the current rules, see
+* PathConfig
+ */
+func (fw *Firewall) LoadRules(r io.Reader) (err error) {
+	defer fw.reloadDone(&err)
+
+	var config RulesConfig
+	if err := json.NewDecoder(r).Decode(&config); err != nil {
+		return fmt.Errorf("could not decode rules: %s", err)
+	}
+	rules, err := config.Rules()
+	if err != nil {
+		return err
+	}
+	if rules, err = prepareRules(rules); err != nil {
+		return err
+	}
+	denyTree := newDenyTree(rules.DeniedNetblocks)
+
+	fw.mu.Lock()
+	err = fw.checkRuleCount(ruleCount(rules))
+	if err == nil {
+		rules, err = keepCodeOptions(config, rules, fw.Rules)
+	}
+	if err != nil {
+		fw.mu.Unlock()
+		return err
+	}
+	fw.Rules = rules
+	fw.globalDenyTree.Store(denyTree)
+	fw.groupRefs = nil
+	fw.lastReload = fw.now()
+	fw.version++
+	fw.mu.Unlock()
+
+	fw.ruleChanged(RuleChangeEvent{Action: RulesReloaded})
+	return nil
+}
+
+// Rules parses the netblocks in a RulesConfig into a rule set
+func (config RulesConfig) Rules() (Rules, error) {
+	rules := Rules{
+		PathToNetblocks:       make(map[string][]net.IPNet),
+		PathToDeniedNetblocks: make(map[string][]net.IPNet),
+		PathToOptions:         make(map[string]PathOptions),
+		PathToGrants:          make(map[string][]Grant),
+		DisabledPaths:         make(map[string]bool),
+		FailOpen:              config.FailOpen,
+	}
+	if len(config.MethodFailOpen) > 0 {
+		rules.MethodFailOpen = make(map[string]bool, len(config.MethodFailOpen))
+		for method, open := range config.MethodFailOpen {
+			rules.MethodFailOpen[method] = open
+		}
+	}
+	var err error
+	if rules.DeniedNetblocks, err = parseCIDRs(config.Deny); err != nil {
+		return Rules{}, err
+	}
+	if rules.DefaultNetblocks, err = parseCIDRs(config.Default); err != nil {
+		return Rules{}, err
+	}
+	if config.DefaultOptions != nil {
+		if rules.DefaultOptions, err = config.DefaultOptions.options(); err != nil {
+			return Rules{}, fmt.Errorf("invalid default options: %s", err)
+		}
+	}
+	for path, pathConfig := range config.Paths {
+		allow, err := parseCIDRs(pathConfig.Allow)
+		if err != nil {
+			return Rules{}, fmt.Errorf("invalid allow list for path %s: %s", path, err)
+		}
+		deny, err := parseCIDRs(pathConfig.Deny)
+		if err != nil {
+			return Rules{}, fmt.Errorf("invalid deny list for path %s: %s", path, err)
+		}
+		// paths with only a deny list fall back to the default rule
+		if pathConfig.Allow != nil {
+			rules.PathToNetblocks[path] = allow
+			opts, err := pathConfig.options()
+			if err != nil {
+				return Rules{}, fmt.Errorf("invalid options for path %s: %s", path, err)
+			}
+			rules.PathToOptions[path] = opts
+			if pathConfig.Disabled {
+				rules.DisabledPaths[path] = true
+			}
+		}
+		if len(deny) > 0 {
+			rules.PathToDeniedNetblocks[path] = deny
+		}
+	}
+	return rules, nil
+}
+
+// rulesConfig describes a rule set as a RulesConfig, grants are not part of it
+func rulesConfig(rules Rules) RulesConfig {
+	config := RulesConfig{
+		FailOpen: rules.FailOpen,
+		Deny:     formatCIDRs(rules.DeniedNetblocks),
+		Default:  formatCIDRs(rules.DefaultNetblocks),
+		Paths:    make(map[string]PathConfig),
+	}
+	for method, open := range rules.MethodFailOpen {
+		if config.MethodFailOpen == nil {
+			config.MethodFailOpen = make(map[string]bool)
+		}
+		config.MethodFailOpen[method] = open
+	}
+	if defaults := optionsConfig(rules.DefaultOptions); !reflect.DeepEqual(defaults, PathConfig{}) {
+		config.DefaultOptions = &defaults
+	}
+	for path, netblocks := range rules.PathToNetblocks {
+		pathConfig := optionsConfig(rules.PathToOptions[path])
+		// an empty, rather than nil, allow list keeps the path's rule
+		pathConfig.Allow = append(make([]string, 0, len(netblocks)), formatCIDRs(netblocks)...)
+		pathConfig.Disabled = rules.DisabledPaths[path]
+		config.Paths[path] = pathConfig
+	}
+	for path, denied := range rules.PathToDeniedNetblocks {
+		pathConfig := config.Paths[path]
+		pathConfig.Deny = formatCIDRs(denied)
+		config.Paths[path] = pathConfig
+	}
+	return config
+}
+
+// optionsConfig describes a rule's options as a PathConfig without allow and deny lists
+func optionsConfig(opts PathOptions) PathConfig {
+	config := PathConfig{
+		MatchRequestURI:     opts.MatchRequestURI,
+		UserAgent:           opts.UserAgent,
+		RequireTrustedChain: opts.RequireTrustedChain,
+		RequireTLS:          opts.RequireTLS,
+		Methods:             opts.Methods,
+		Listeners:           opts.Listeners,
+		MaxBodyBytes:        opts.MaxBodyBytes,
+		MaxConcurrent:       opts.MaxConcurrent,
+		ShedAbove:           opts.ShedAbove,
+		SignatureHeader:     opts.SignatureHeader,
+		RequiredClaim:       opts.RequiredClaim,
+		RequiredClaimValue:  opts.RequiredClaimValue,
+		CodeOptions:         opts.codeOptions(),
+		Staged:              opts.Staged,
+		EnforcePercentage:   opts.EnforcePercentage,
+	}
+	for name, version := range tlsVersions {
+		if version == opts.MinTLSVersion {
+			config.MinTLSVersion = name
+		}
+	}
+	for _, suite := range opts.DisallowedCipherSuites {
+		config.DisallowedCipherSuites = append(config.DisallowedCipherSuites, tls.CipherSuiteName(suite))
+	}
+	return config
+}
+
+// formatCIDRs formats a list of netblocks as network CIDRs
+func formatCIDRs(netblocks []net.IPNet) []string {
+	var networks []string
+	for _, netblock := range netblocks {
+		networks = append(networks, netblock.String())
+	}
+	return networks
+}
+
+// parseCIDRs parses a list of network CIDRs
+func parseCIDRs(networks []string) ([]net.IPNet, error) {
+	var netblocks []net.IPNet
+	for _, network := range networks {
+		_, netblock, err := net.ParseCIDR(network)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse CIDR: %s", err)
+		}
+		netblocks = append(netblocks, *netblock)
+	}
+	return netblocks, nil
+}
@@ -0,0 +1,90 @@
+package firewall
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestLoadRulesDenyOverridesAllow(t *testing.T) {
+	fw := New()
+	err := fw.LoadRules(strings.NewReader(`{
+		"fail_open": true,
+		"deny": ["203.0.113.0/24"],
+		"default": ["10.0.0.0/8"],
+		"paths": {
+			"/hello_world": {
+				"allow": ["192.168.0.0/16", "203.0.113.0/24"],
+				"deny": ["192.168.1.0/24"]
+			},
+			"/deny_only": {
+				"deny": ["10.9.0.0/16"]
+			}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path, src string
+		reason    Reason
+	}{
+		{"/hello_world", "192.168.2.1", ReasonTrusted},
+		{"/hello_world", "192.168.1.5", ReasonDenied},
+		{"/hello_world", "203.0.113.5", ReasonDenied},
+		{"/hello_world", "10.1.2.3", ReasonUntrusted},
+		{"/deny_only", "10.9.1.1", ReasonDenied},
+		{"/deny_only", "10.1.2.3", ReasonTrusted},
+		{"/other", "10.1.2.3", ReasonTrusted},
+		{"/other", "203.0.113.5", ReasonDenied},
+		{"/other", "198.51.100.1", ReasonUntrusted},
+	}
+	for _, test := range tests {
+		if d := fw.Decide(newTestRequest(http.MethodGet, test.path, test.src)); d.Reason != test.reason {
+			t.Errorf("%s from %s: got %s, want %s", test.path, test.src, d.Reason, test.reason)
+		}
+	}
+}
+
+func TestLoadRulesFailsOpenLast(t *testing.T) {
+	fw := New()
+	err := fw.LoadRules(strings.NewReader(`{
+		"fail_open": true,
+		"deny": ["203.0.113.0/24"],
+		"paths": {
+			"/hello_world": {"allow": ["192.168.0.0/16"]},
+			"/deny_only": {"deny": ["10.9.0.0/16"]}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path, src string
+		reason    Reason
+	}{
+		{"/hello_world", "198.51.100.1", ReasonUntrusted},
+		{"/deny_only", "10.9.1.1", ReasonDenied},
+		{"/deny_only", "10.1.2.3", ReasonFailOpen},
+		{"/other", "203.0.113.5", ReasonDenied},
+		{"/other", "198.51.100.1", ReasonFailOpen},
+	}
+	for _, test := range tests {
+		if d := fw.Decide(newTestRequest(http.MethodGet, test.path, test.src)); d.Reason != test.reason {
+			t.Errorf("%s from %s: got %s, want %s", test.path, test.src, d.Reason, test.reason)
+		}
+	}
+}
+
+func TestLoadRulesRejectsInvalidDenyList(t *testing.T) {
+	fw := New()
+	if err := fw.AddPathRule("/hello_world", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.LoadRules(strings.NewReader(`{"paths": {"/hello_world": {"allow": ["10.0.0.0/8"], "deny": ["not a cidr"]}}}`)); err == nil {
+		t.Fatal("loaded a config with an invalid deny list")
+	}
+	if d := fw.Decide(newTestRequest(http.MethodGet, "/hello_world", "10.1.2.3")); !d.Allowed {
+		t.Errorf("got %s, want the previous rule set to still apply", d.Reason)
+	}
+}
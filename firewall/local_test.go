@@ -0,0 +1,60 @@
+package firewall
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestTrustLocalSources(t *testing.T) {
+	tests := []struct {
+		name                     string
+		localhost, privateRanges bool
+		src                      string
+		allowed                  bool
+	}{
+		{"loopback, disabled", false, false, "127.0.0.1", false},
+		{"loopback", true, false, "127.0.0.1", true},
+		{"IPv6 loopback", true, false, "::1", true},
+		{"private range with only localhost", true, false, "192.168.1.1", false},
+		{"private range, disabled", false, false, "192.168.1.1", false},
+		{"RFC 1918", false, true, "172.16.0.1", true},
+		{"ULA", false, true, "fd00::1", true},
+		{"loopback with only private ranges", false, true, "127.0.0.1", false},
+		{"public", true, true, "198.51.100.1", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fw := New()
+			fw.TrustLocalhost = test.localhost
+			fw.TrustPrivateRanges = test.privateRanges
+			if err := fw.AddPathRule("/admin", []string{"10.0.0.0/8"}); err != nil {
+				t.Fatal(err)
+			}
+			if d := fw.Decide(newTestRequest(http.MethodGet, "/admin", test.src)); d.Allowed != test.allowed {
+				t.Errorf("got %s, want allowed=%t", d.Reason, test.allowed)
+			}
+			if d := fw.Decide(newTestRequest(http.MethodGet, "/admin", "10.1.2.3")); !d.Allowed {
+				t.Errorf("got %s for a source trusted by the rule, want trusted", d.Reason)
+			}
+		})
+	}
+}
+
+func TestTrustLocalSourcesDenied(t *testing.T) {
+	fw := New()
+	fw.TrustLocalhost = true
+	fw.TrustPrivateRanges = true
+	err := fw.LoadRules(strings.NewReader(`{"deny": ["127.0.0.0/8"], "paths": {"/admin": {"allow": ["10.0.0.0/8"], "deny": ["192.168.1.0/24"]}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, src := range []string{"127.0.0.1", "192.168.1.1"} {
+		if d := fw.Decide(newTestRequest(http.MethodGet, "/admin", src)); d.Reason != ReasonDenied {
+			t.Errorf("got %s for denied source %s, want denied", d.Reason, src)
+		}
+	}
+	if d := fw.Decide(newTestRequest(http.MethodGet, "/admin", "192.168.2.1")); !d.Allowed {
+		t.Errorf("got %s for a private source which is not denied, want allowed", d.Reason)
+	}
+}
@@ -0,0 +1,61 @@
+package firewall
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// LogFormat is the format of the lines logged for allowed and blocked requests
+type LogFormat string
+
+const (
+	// LogFormatDefault logs requests as "[FIREWALL] allowed request from ..." lines
+	LogFormatDefault LogFormat = ""
+	// LogFormatCommon logs requests in Apache's Common Log Format
+	LogFormatCommon LogFormat = "common"
+	// LogFormatCombined logs requests in Apache's Combined Log Format, i.e. CLF followed by the Referer and User-Agent
+	LogFormatCombined LogFormat = "combined"
+)
+
+// clfTimeFormat is the layout of CLF timestamps, e.g. 10/Oct/2000:13:55:36 -0700
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// valid checks whether a log format is one of the known ones
+func (f LogFormat) valid() bool {
+	return f == LogFormatDefault || f == LogFormatCommon || f == LogFormatCombined
+}
+
+/*formatCLF formats a request as a Common or Combined Log Format line, e.g.
+*	203.0.113.7 - - [10/Oct/2000:13:55:36 -0700] "GET /admin HTTP/1.1" 403 10 "-" "curl/8.0"
+* The host is the decision's source IP and the request line carries the path the
+* decision was made for, without the query. Missing values are logged as "-"
+ */
+func formatCLF(format LogFormat, r *http.Request, d Decision, status int, bytes int64, now time.Time) string {
+	size := "-"
+	if bytes > 0 {
+		size = strconv.FormatInt(bytes, 10)
+	}
+	line := fmt.Sprintf("%s - - [%s] \"%s %s %s\" %d %s",
+		clfField(d.SrcIP.String()), now.Format(clfTimeFormat),
+		clfEscape(r.Method), clfEscape(d.Path), clfEscape(r.Proto), status, size)
+	if format == LogFormatCombined {
+		line += fmt.Sprintf(" \"%s\" \"%s\"", clfEscape(clfField(r.Referer())), clfEscape(clfField(r.UserAgent())))
+	}
+	return line
+}
+
+// clfField returns a value, or "-" for missing ones
+func clfField(value string) string {
+	if value == "" || value == "<nil>" {
+		return "-"
+	}
+	return value
+}
+
+// clfEscape escapes quotes, backslashes and non-printable characters so that a value can't break out of its quoted field
+func clfEscape(value string) string {
+	quoted := strconv.Quote(value)
+	return quoted[1 : len(quoted)-1]
+}
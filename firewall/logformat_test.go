@@ -0,0 +1,78 @@
+package firewall
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clfLine matches Combined Log Format lines, capturing each field
+var clfLine = regexp.MustCompile(`^(\S+) - - \[([^\]]+)\] "((?:[^"\\]|\\.)*)" (\d{3}) (\d+|-)(?: "((?:[^"\\]|\\.)*)" "((?:[^"\\]|\\.)*)")?$`)
+
+func TestFormatCLF(t *testing.T) {
+	now := time.Date(2000, time.October, 10, 13, 55, 36, 0, time.FixedZone("", -7*3600))
+	r := httptest.NewRequest(http.MethodGet, "/admin?token=secret", nil)
+	r.Header.Set("User-Agent", `evil" 200 1 "agent`)
+	d := Decision{Path: "/admin", SrcIP: net.ParseIP("203.0.113.7")}
+
+	common := formatCLF(LogFormatCommon, r, d, http.StatusForbidden, 10, now)
+	if want := `203.0.113.7 - - [10/Oct/2000:13:55:36 -0700] "GET /admin HTTP/1.1" 403 10`; common != want {
+		t.Errorf("got %q, want %q", common, want)
+	}
+	combined := formatCLF(LogFormatCombined, r, Decision{Path: "/admin"}, http.StatusOK, 0, now)
+	fields := clfLine.FindStringSubmatch(combined)
+	if fields == nil {
+		t.Fatalf("could not parse %q", combined)
+	}
+	want := []string{"-", "10/Oct/2000:13:55:36 -0700", "GET /admin HTTP/1.1", "200", "-", "-", `evil\" 200 1 \"agent`}
+	for i, field := range want {
+		if fields[i+1] != field {
+			t.Errorf("field %d of %q: got %q, want %q", i, combined, fields[i+1], field)
+		}
+	}
+}
+
+func TestLogFormat(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	flags := log.Flags()
+	log.SetFlags(0)
+	defer log.SetFlags(flags)
+
+	fw := New()
+	fw.Log = true
+	fw.AllowedLogSampleRate = 1
+	fw.LogFormat = LogFormatCombined
+	if err := fw.AddPathRule("/", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	h := fw.Wrap(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("hello")) })
+	h.ServeHTTP(httptest.NewRecorder(), newTestRequest(http.MethodGet, "/", "10.1.2.3"))
+	h.ServeHTTP(httptest.NewRecorder(), newTestRequest(http.MethodGet, "/", "198.51.100.1"))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d log lines, want 2: %q", len(lines), lines)
+	}
+	for i, want := range []struct{ host, status, size string }{
+		{"10.1.2.3", "200", "5"},
+		{"198.51.100.1", "403", ""},
+	} {
+		fields := clfLine.FindStringSubmatch(lines[i])
+		if fields == nil {
+			t.Errorf("could not parse %q", lines[i])
+			continue
+		}
+		if fields[1] != want.host || fields[4] != want.status || (want.size != "" && fields[5] != want.size) {
+			t.Errorf("got %q, want host %s and status %s", lines[i], want.host, want.status)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package firewall
+
+import (
+	"bytes"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestAllowedLogSampleRate(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	const requests = 1000
+	for _, test := range []struct {
+		rate     float64
+		min, max int
+	}{
+		{0, 0, 0},
+		{1, requests, requests},
+		{0.25, 200, 300},
+	} {
+		buf.Reset()
+		fw := New()
+		fw.Log = true
+		fw.AllowedLogSampleRate = test.rate
+		fw.SampleRand = rand.New(rand.NewSource(1)).Float64
+		if err := fw.AddPathRule("/", []string{"10.0.0.0/8"}); err != nil {
+			t.Fatal(err)
+		}
+		h := fw.Wrap(func(w http.ResponseWriter, r *http.Request) {})
+		for i := 0; i < requests; i++ {
+			h.ServeHTTP(httptest.NewRecorder(), newTestRequest(http.MethodGet, "/", "10.1.2.3"))
+		}
+		for i := 0; i < 10; i++ {
+			h.ServeHTTP(httptest.NewRecorder(), newTestRequest(http.MethodGet, "/", "198.51.100.1"))
+		}
+		allowed := strings.Count(buf.String(), "[FIREWALL] allowed request")
+		if allowed < test.min || allowed > test.max {
+			t.Errorf("rate %v: logged %d of %d allowed requests, want %d to %d", test.rate, allowed, requests, test.min, test.max)
+		}
+		if blocked := strings.Count(buf.String(), "[FIREWALL] blocked request"); blocked != 10 {
+			t.Errorf("rate %v: logged %d of 10 blocked requests", test.rate, blocked)
+		}
+	}
+}
+
+func TestAllowedLogSampleRateWithoutLog(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	fw := New()
+	fw.AllowedLogSampleRate = 1
+	if err := fw.AddPathRule("/", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	h := fw.Wrap(func(w http.ResponseWriter, r *http.Request) {})
+	h.ServeHTTP(httptest.NewRecorder(), newTestRequest(http.MethodGet, "/", "10.1.2.3"))
+	h.ServeHTTP(httptest.NewRecorder(), newTestRequest(http.MethodGet, "/", "198.51.100.1"))
+	// sampled allowed requests are logged regardless of Log, blocked ones follow it
+	if got := buf.String(); !strings.Contains(got, "allowed request from 10.1.2.3") || strings.Contains(got, "blocked request") {
+		t.Errorf("got log %q, want only the allowed request", got)
+	}
+}
@@ -0,0 +1,22 @@
+package firewall
+
+import "fmt"
+
+// ruleCount returns the number of paths with a rule or a deny list in a rule set
+func ruleCount(rules Rules) int {
+	count := len(rules.PathToNetblocks)
+	for path := range rules.PathToDeniedNetblocks {
+		if _, ok := rules.PathToNetblocks[path]; !ok {
+			count++
+		}
+	}
+	return count
+}
+
+// checkRuleCount checks a number of rules against MaxRules, the firewall's lock must be held
+func (fw *Firewall) checkRuleCount(count int) error {
+	if fw.MaxRules > 0 && count > fw.MaxRules {
+		return fmt.Errorf("%s: %d rules exceed the maximum of %d", ErrTooManyRules, count, fw.MaxRules)
+	}
+	return nil
+}
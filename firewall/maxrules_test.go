@@ -0,0 +1,85 @@
+package firewall
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// isTooManyRules checks whether an error is an ErrTooManyRules
+func isTooManyRules(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), ErrTooManyRules.Error())
+}
+
+func TestMaxRules(t *testing.T) {
+	fw := New()
+	fw.MaxRules = 2
+	if err := fw.AddPathRule("/a", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.LoadRules(strings.NewReader(`{"paths": {"/a": {"allow": ["10.0.0.0/8"]}, "/denied": {"deny": ["203.0.113.0/24"]}}}`)); err != nil {
+		t.Fatal(err)
+	}
+	// the deny only path counts towards the cap, adding a rule to it doesn't
+	if err := fw.AddPathRule("/denied", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	before := fw.Export()
+
+	for name, add := range map[string]func() error{
+		"AddPathRule":      func() error { return fw.AddPathRule("/c", []string{"10.0.0.0/8"}) },
+		"SetPathRule":      func() error { return fw.SetPathRule("/c", []string{"10.0.0.0/8"}) },
+		"AddPathNetblocks": func() error { return fw.AddPathNetblocks("/c", []net.IPNet{mustParseCIDR(t, "10.0.0.0/8")}) },
+		"LoadRules": func() error {
+			return fw.LoadRules(strings.NewReader(`{"paths": {"/a": {"allow": []}, "/b": {"allow": []}, "/c": {"allow": []}}}`))
+		},
+		"LoadRulesLayer": func() error {
+			_, err := fw.LoadRulesLayer(strings.NewReader(`{"paths": {"/a": {"allow": []}, "/b": {"allow": []}, "/c": {"allow": []}}}`), 0)
+			return err
+		},
+		"ReplaceRules": func() error {
+			rules := fw.GetRules()
+			rules.PathToNetblocks["/c"] = nil
+			return fw.ReplaceRules(rules)
+		},
+		"Import": func() error {
+			config := fw.Export()
+			config.Paths["/c"] = PathConfig{Allow: []string{}}
+			return fw.Import(config)
+		},
+	} {
+		if err := add(); !isTooManyRules(err) {
+			t.Errorf("%s: got error %v beyond the cap, want ErrTooManyRules", name, err)
+		}
+		if fw.HasRule("/c") {
+			t.Errorf("%s: added a rule beyond the cap", name)
+		}
+	}
+	if got := fw.Export(); len(got.Paths) != len(before.Paths) {
+		t.Errorf("got paths %v, want the existing rules %v untouched", got.Paths, before.Paths)
+	}
+	for _, path := range []string{"/a", "/denied"} {
+		if d := fw.Decide(newTestRequest(http.MethodGet, path, "10.1.2.3")); d.Reason != ReasonTrusted {
+			t.Errorf("%s: got %s, want the existing rule to still apply", path, d.Reason)
+		}
+	}
+
+	// removing a rule makes room for another
+	if err := fw.RemovePathRule("/a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.AddPathRule("/c", []string{"10.0.0.0/8"}); err != nil {
+		t.Errorf("got error %v within the cap", err)
+	}
+}
+
+func TestMaxRulesUnlimitedByDefault(t *testing.T) {
+	fw := New()
+	for i := 0; i < 1000; i++ {
+		if err := fw.AddPathRule(fmt.Sprintf("/path%d", i), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
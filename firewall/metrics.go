@@ -0,0 +1,125 @@
+package firewall
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// metricsContentType is the content type of the Prometheus text exposition format
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// requestCounts counts the requests served through Wrap by the reason of their decision
+type requestCounts struct {
+	mu       sync.Mutex
+	byReason map[Reason]uint64
+}
+
+// add counts a request decided for a reason
+func (c *requestCounts) add(reason Reason) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.byReason == nil {
+		c.byReason = make(map[Reason]uint64)
+	}
+	c.byReason[reason]++
+}
+
+// snapshot returns a copy of the counts
+func (c *requestCounts) snapshot() map[Reason]uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts := make(map[Reason]uint64, len(c.byReason))
+	for reason, count := range c.byReason {
+		counts[reason] = count
+	}
+	return counts
+}
+
+/*MetricsHandler returns a handler serving the firewall's metrics in the Prometheus
+* text exposition format, without depending on the Prometheus client:
+*	gofirewall_requests_total{decision,reason}     requests served through Wrap, by decision and reason
+*	gofirewall_rules                               paths with a rule or a deny list
+*	gofirewall_netblocks                           trusted netblocks across all paths
+*	gofirewall_request_rate                        requests per second, see RequestRate
+*	gofirewall_last_reload_timestamp_seconds       when the rules were last reloaded, 0 if never
+*	gofirewall_last_reload_success                 1 unless the last reload failed
+*	gofirewall_decision_cache_{hits,misses}_total  decision cache lookups, see DecisionCacheSize
+* Every known reason is reported, with a zero count until a request is decided for
+* it. Like RulesHandler, it should be wrapped with the firewall to restrict it
+ */
+func (fw *Firewall) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", metricsContentType)
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(fw.metrics())
+	})
+}
+
+// metrics serializes the firewall's metrics in the Prometheus text exposition format
+func (fw *Firewall) metrics() []byte {
+	counts := fw.requestCounts.snapshot()
+	rate := fw.RequestRate()
+	cache := fw.DecisionCacheStats()
+
+	fw.mu.RLock()
+	rules := ruleCount(fw.Rules)
+	netblocks := 0
+	for _, trusted := range fw.Rules.PathToNetblocks {
+		netblocks += len(trusted)
+	}
+	var lastReload float64
+	if !fw.lastReload.IsZero() {
+		lastReload = float64(fw.lastReload.UnixNano()) / 1e9
+	}
+	reloadSuccess := 1
+	if fw.reloadErr != nil {
+		reloadSuccess = 0
+	}
+	fw.mu.RUnlock()
+
+	var reasons []Reason
+	for reason := range reasonNames {
+		reasons = append(reasons, reason)
+	}
+	sort.Slice(reasons, func(i, j int) bool { return reasons[i] < reasons[j] })
+
+	var buf bytes.Buffer
+	metricHeader(&buf, "gofirewall_requests_total", "counter", "Requests served through the firewall, by decision and reason.")
+	for _, reason := range reasons {
+		decision := "blocked"
+		if reason.Allowed() {
+			decision = "allowed"
+		}
+		fmt.Fprintf(&buf, "gofirewall_requests_total{decision=%q,reason=%q} %d\n", decision, reason, counts[reason])
+	}
+	metricHeader(&buf, "gofirewall_rules", "gauge", "Paths with a rule or a deny list.")
+	fmt.Fprintf(&buf, "gofirewall_rules %d\n", rules)
+	metricHeader(&buf, "gofirewall_netblocks", "gauge", "Trusted netblocks across all paths.")
+	fmt.Fprintf(&buf, "gofirewall_netblocks %d\n", netblocks)
+	metricHeader(&buf, "gofirewall_request_rate", "gauge", "Requests per second over the last second.")
+	fmt.Fprintf(&buf, "gofirewall_request_rate %g\n", rate)
+	metricHeader(&buf, "gofirewall_last_reload_timestamp_seconds", "gauge", "Unix time the rules were last reloaded, 0 if never.")
+	fmt.Fprintf(&buf, "gofirewall_last_reload_timestamp_seconds %g\n", lastReload)
+	metricHeader(&buf, "gofirewall_last_reload_success", "gauge", "Whether the last reload of the rules succeeded.")
+	fmt.Fprintf(&buf, "gofirewall_last_reload_success %d\n", reloadSuccess)
+	metricHeader(&buf, "gofirewall_decision_cache_hits_total", "counter", "Decision cache hits.")
+	fmt.Fprintf(&buf, "gofirewall_decision_cache_hits_total %d\n", cache.Hits)
+	metricHeader(&buf, "gofirewall_decision_cache_misses_total", "counter", "Decision cache misses.")
+	fmt.Fprintf(&buf, "gofirewall_decision_cache_misses_total %d\n", cache.Misses)
+	return buf.Bytes()
+}
+
+// metricHeader writes the HELP and TYPE lines of a metric
+func metricHeader(buf *bytes.Buffer, name, kind, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
@@ -0,0 +1,113 @@
+package firewall
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scrapeMetrics serves a metrics request and returns its samples by series, checking every series is preceded by its HELP and TYPE
+func scrapeMetrics(t *testing.T, h http.Handler) map[string]string {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200", w.Code)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("got content type %q", contentType)
+	}
+	samples := make(map[string]string)
+	described := make(map[string]bool)
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "# HELP ") || strings.HasPrefix(line, "# TYPE ") {
+			fields := strings.Fields(line)
+			if len(fields) < 4 {
+				t.Errorf("malformed line %q", line)
+				continue
+			}
+			if fields[1] == "TYPE" {
+				if fields[3] != "counter" && fields[3] != "gauge" {
+					t.Errorf("unexpected type in %q", line)
+				}
+				described[fields[2]] = true
+			}
+			continue
+		}
+		i := strings.LastIndex(line, " ")
+		if i < 0 {
+			t.Errorf("malformed sample %q", line)
+			continue
+		}
+		series, value := line[:i], line[i+1:]
+		name := series
+		if j := strings.Index(series, "{"); j >= 0 {
+			name = series[:j]
+		}
+		if !described[name] {
+			t.Errorf("sample %q precedes the TYPE of %s", line, name)
+		}
+		samples[series] = value
+	}
+	return samples
+}
+
+func TestMetricsHandler(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	fw := New()
+	fw.Now = func() time.Time { return now }
+	if err := fw.LoadRules(strings.NewReader(`{"paths": {"/admin": {"allow": ["10.0.0.0/8", "192.168.0.0/16"]}, "/reports": {"allow": ["10.0.0.0/8"]}}}`)); err != nil {
+		t.Fatal(err)
+	}
+	h := fw.Wrap(func(w http.ResponseWriter, r *http.Request) {})
+	for _, src := range []string{"10.1.2.3", "10.1.2.4", "198.51.100.1"} {
+		h.ServeHTTP(httptest.NewRecorder(), newTestRequest(http.MethodGet, "/admin", src))
+	}
+	h.ServeHTTP(httptest.NewRecorder(), newTestRequest(http.MethodGet, "/unregistered", "10.1.2.3"))
+	// decisions made outside Wrap aren't served, so they count towards neither the requests nor the rate
+	fw.Decide(newTestRequest(http.MethodGet, "/admin", "10.1.2.3"))
+
+	samples := scrapeMetrics(t, fw.MetricsHandler())
+	want := map[string]string{
+		`gofirewall_requests_total{decision="allowed",reason="trusted"}`:   "2",
+		`gofirewall_requests_total{decision="blocked",reason="untrusted"}`: "1",
+		`gofirewall_requests_total{decision="blocked",reason="no_rule"}`:   "1",
+		`gofirewall_requests_total{decision="allowed",reason="fail_open"}`: "0",
+		`gofirewall_rules`:                         "2",
+		`gofirewall_netblocks`:                     "3",
+		`gofirewall_request_rate`:                  "4",
+		`gofirewall_last_reload_timestamp_seconds`: "1.7e+09",
+		`gofirewall_last_reload_success`:           "1",
+		`gofirewall_decision_cache_hits_total`:     "0",
+	}
+	for series, value := range want {
+		if got, ok := samples[series]; !ok || got != value {
+			t.Errorf("%s: got %q, want %q", series, got, value)
+		}
+	}
+	for reason := range reasonNames {
+		if _, ok := samples[`gofirewall_requests_total{decision="blocked",reason="`+reason.String()+`"}`]; ok {
+			continue
+		}
+		if _, ok := samples[`gofirewall_requests_total{decision="allowed",reason="`+reason.String()+`"}`]; !ok {
+			t.Errorf("no requests_total series for %s", reason)
+		}
+	}
+
+	if err := fw.LoadRules(strings.NewReader(`{"paths": {"/admin": {"allow": ["not a cidr"]}}}`)); err == nil {
+		t.Fatal("loaded an invalid rule set")
+	}
+	if got := scrapeMetrics(t, fw.MetricsHandler())["gofirewall_last_reload_success"]; got != "0" {
+		t.Errorf("got last_reload_success %q after a failed reload, want 0", got)
+	}
+
+	w := httptest.NewRecorder()
+	fw.MetricsHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/metrics", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("got status %d for a POST, want 405", w.Code)
+	}
+}
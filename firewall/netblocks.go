@@ -0,0 +1,192 @@
+package firewall
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+)
+
+// AllTrustedNetblocks returns the deduplicated union of the netblocks trusted across all paths
+func (fw *Firewall) AllTrustedNetblocks() []net.IPNet {
+	fw.mu.RLock()
+	var all []net.IPNet
+	for _, netblocks := range fw.Rules.PathToNetblocks {
+		all = append(all, netblocks...)
+	}
+	fw.mu.RUnlock()
+
+	return DedupNetblocks(all)
+}
+
+/*AddPathNetblocks maps a list of already parsed trusted netblocks to a given path,
+* like AddPathRule does for CIDR strings. Netblocks are copied in canonical form,
+* e.g. with their host bits cleared; empty or malformed ones, such as zero values
+* or ones with non-contiguous masks, and duplicates are rejected
+ */
+func (fw *Firewall) AddPathNetblocks(path string, networks []net.IPNet) error {
+	trusted := make([]net.IPNet, 0, len(networks))
+	seen := make(map[string]bool, len(networks))
+	for _, network := range networks {
+		if ip, mask := netblockNumberAndMask(network); ip == nil {
+			return fmt.Errorf("%s: %q", ErrInvalidNetblock, network.String())
+		} else if _, bits := mask.Size(); bits == 0 {
+			return fmt.Errorf("%s: %s has a non-contiguous mask", ErrInvalidNetblock, network.String())
+		}
+		netblock := canonicalNetblock(network)
+		if seen[netblock.String()] {
+			return fmt.Errorf("%s: duplicate netblock %s", ErrInvalidNetblock, netblock.String())
+		}
+		seen[netblock.String()] = true
+		trusted = append(trusted, netblock)
+	}
+	if err := fw.addPathRule(path, trusted, nil, PathOptions{}); err != nil {
+		return err
+	}
+	fw.ruleChanged(RuleChangeEvent{Action: RuleAdded, Path: path})
+	return nil
+}
+
+// DedupNetblocks returns a sorted copy of a list of netblocks without duplicates
+func DedupNetblocks(netblocks []net.IPNet) []net.IPNet {
+	seen := make(map[string]bool)
+	var deduped []net.IPNet
+	for _, netblock := range netblocks {
+		netblock = canonicalNetblock(netblock)
+		if seen[netblock.String()] {
+			continue
+		}
+		seen[netblock.String()] = true
+		deduped = append(deduped, netblock)
+	}
+	sortNetblocks(deduped)
+	return deduped
+}
+
+/*AggregateNetblocks returns the smallest sorted list of netblocks covering exactly
+* the same addresses as the given list: netblocks contained in others are dropped
+* and adjacent netblocks of the same size are merged into their parent
+ */
+func AggregateNetblocks(netblocks []net.IPNet) []net.IPNet {
+	aggregated := DedupNetblocks(netblocks)
+	for {
+		var next []net.IPNet
+		changed := false
+		for _, netblock := range aggregated {
+			if len(next) == 0 {
+				next = append(next, netblock)
+				continue
+			}
+			last := next[len(next)-1]
+			if netblockContains(last, netblock) {
+				changed = true
+				continue
+			}
+			if parent, ok := siblingParent(last, netblock); ok {
+				next[len(next)-1] = parent
+				changed = true
+				continue
+			}
+			next = append(next, netblock)
+		}
+		aggregated = next
+		if !changed {
+			return aggregated
+		}
+	}
+}
+
+// canonicalNetblock masks a netblock's IP and uses the 4-byte form for IPv4
+func canonicalNetblock(netblock net.IPNet) net.IPNet {
+	ones, bits := netblock.Mask.Size()
+	ip := netblock.IP.Mask(netblock.Mask)
+	if ip4 := ip.To4(); ip4 != nil && bits == 8*net.IPv4len {
+		ip = ip4
+	}
+	return net.IPNet{IP: ip, Mask: net.CIDRMask(ones, bits)}
+}
+
+// sortNetblocks sorts canonical netblocks by family, address and then prefix length
+func sortNetblocks(netblocks []net.IPNet) {
+	sort.Slice(netblocks, func(i, j int) bool {
+		a, b := netblocks[i], netblocks[j]
+		if len(a.IP) != len(b.IP) {
+			return len(a.IP) < len(b.IP)
+		}
+		if c := bytes.Compare(a.IP, b.IP); c != 0 {
+			return c < 0
+		}
+		onesA, _ := a.Mask.Size()
+		onesB, _ := b.Mask.Size()
+		return onesA < onesB
+	})
+}
+
+// netblockContains checks whether canonical netblock a covers all of canonical netblock b
+func netblockContains(a, b net.IPNet) bool {
+	onesA, bitsA := a.Mask.Size()
+	onesB, bitsB := b.Mask.Size()
+	return bitsA == bitsB && onesA <= onesB && a.Contains(b.IP)
+}
+
+// siblingParent returns the parent of two canonical netblocks when they are its two halves
+func siblingParent(a, b net.IPNet) (net.IPNet, bool) {
+	onesA, bitsA := a.Mask.Size()
+	onesB, bitsB := b.Mask.Size()
+	if bitsA != bitsB || onesA != onesB || onesA == 0 || a.IP.Equal(b.IP) {
+		return net.IPNet{}, false
+	}
+	mask := net.CIDRMask(onesA-1, bitsA)
+	if !a.IP.Mask(mask).Equal(b.IP.Mask(mask)) {
+		return net.IPNet{}, false
+	}
+	return canonicalNetblock(net.IPNet{IP: a.IP, Mask: mask}), true
+}
+
+/*IPv6 clients using privacy extensions (RFC 4941) rotate the lower 64 bits of their
+* address, so rules for individual IPv6 hosts should trust their whole /64 rather
+* than a /128. Recommended IPv6 prefix lengths are:
+* - /64 for a single host or LAN
+* - /56 or /48 for a whole customer site, as commonly delegated by ISPs
+ */
+const (
+	// IPv6HostPrefixLength is the recommended prefix length for trusting a single IPv6 host
+	IPv6HostPrefixLength = 64
+	// IPv4HostPrefixLength is the prefix length for trusting a single IPv4 host
+	IPv4HostPrefixLength = 32
+)
+
+// TruncateIP zeroes all but the first prefixLen bits of an IP address, IPv4 addresses are truncated in their 32-bit form
+func TruncateIP(ip net.IP, prefixLen int) net.IP {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(prefixLen, 8*net.IPv4len))
+	}
+	return ip.Mask(net.CIDRMask(prefixLen, 8*net.IPv6len))
+}
+
+/*HostNetblock returns the netblock trusting a host's IP address: the address itself
+* for IPv4 and its /64 for IPv6, so that rotating privacy addresses keep matching
+ */
+func HostNetblock(ip net.IP) net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return net.IPNet{IP: ip4, Mask: net.CIDRMask(IPv4HostPrefixLength, 8*net.IPv4len)}
+	}
+	return net.IPNet{
+		IP:   TruncateIP(ip, IPv6HostPrefixLength),
+		Mask: net.CIDRMask(IPv6HostPrefixLength, 8*net.IPv6len),
+	}
+}
+
+// NetblocksEqual checks whether two lists of netblocks contain the same netblocks, ignoring order and duplicates
+func NetblocksEqual(a, b []net.IPNet) bool {
+	setA, setB := netblockSet(a), netblockSet(b)
+	if len(setA) != len(setB) {
+		return false
+	}
+	for netblock := range setA {
+		if !setB[netblock] {
+			return false
+		}
+	}
+	return true
+}
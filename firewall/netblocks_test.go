@@ -0,0 +1,190 @@
+package firewall
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// formatNetblocks formats netblocks as space separated CIDRs for comparisons
+func formatNetblocks(netblocks []net.IPNet) string {
+	return strings.Join(formatCIDRs(netblocks), " ")
+}
+
+func TestAllTrustedNetblocks(t *testing.T) {
+	fw := New()
+	if err := fw.AddPathRule("/a", []string{"10.0.0.0/8", "192.168.1.0/24", "2001:db8::/32"}); err != nil {
+		t.Fatal(err)
+	}
+	// 10.1.2.3/8 is 10.0.0.0/8 once canonicalized
+	if err := fw.AddPathRule("/b", []string{"10.1.2.3/8", "192.168.1.0/24", "172.16.0.0/12"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.AddPathRule("/c", nil); err != nil {
+		t.Fatal(err)
+	}
+	want := "10.0.0.0/8 172.16.0.0/12 192.168.1.0/24 2001:db8::/32"
+	if got := formatNetblocks(fw.AllTrustedNetblocks()); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestAggregateNetblocks(t *testing.T) {
+	var netblocks []net.IPNet
+	for _, network := range []string{"10.0.0.0/25", "10.0.0.128/25", "10.0.1.0/24", "10.0.0.7/32", "192.168.0.0/24", "192.168.2.0/24", "2001:db8::/33", "2001:db8:8000::/33"} {
+		netblocks = append(netblocks, mustParseCIDR(t, network))
+	}
+	want := "10.0.0.0/23 192.168.0.0/24 192.168.2.0/24 2001:db8::/32"
+	if got := formatNetblocks(AggregateNetblocks(netblocks)); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestTruncateIP(t *testing.T) {
+	tests := []struct {
+		ip        string
+		prefixLen int
+		want      string
+	}{
+		{"2001:db8:1:2:a1b2:c3d4:e5f6:789", 64, "2001:db8:1:2::"},
+		{"2001:db8:1:2:a1b2:c3d4:e5f6:789", 48, "2001:db8:1::"},
+		{"2001:db8:1:2:a1b2:c3d4:e5f6:789", 128, "2001:db8:1:2:a1b2:c3d4:e5f6:789"},
+		{"192.168.1.77", 24, "192.168.1.0"},
+		{"192.168.1.77", 32, "192.168.1.77"},
+		{"::ffff:192.168.1.77", 24, "192.168.1.0"},
+	}
+	for _, test := range tests {
+		if got := TruncateIP(net.ParseIP(test.ip), test.prefixLen).String(); got != test.want {
+			t.Errorf("%s/%d: got %s, want %s", test.ip, test.prefixLen, got, test.want)
+		}
+	}
+}
+
+func TestHostNetblockMatchesPrivacyAddresses(t *testing.T) {
+	if got := HostNetblock(net.ParseIP("192.168.1.77")); got.String() != "192.168.1.77/32" {
+		t.Errorf("got %s for an IPv4 host, want 192.168.1.77/32", got.String())
+	}
+	host := HostNetblock(net.ParseIP("2001:db8:1:2:a1b2:c3d4:e5f6:789"))
+	if host.String() != "2001:db8:1:2::/64" {
+		t.Fatalf("got %s for an IPv6 host, want 2001:db8:1:2::/64", host.String())
+	}
+
+	fw := New()
+	if err := fw.AddPathRule("/admin", []string{host.String()}); err != nil {
+		t.Fatal(err)
+	}
+	for src, allowed := range map[string]bool{
+		"2001:db8:1:2:a1b2:c3d4:e5f6:789":  true,
+		"2001:db8:1:2:1234:5678:9abc:def0": true,
+		"2001:db8:1:3:a1b2:c3d4:e5f6:789":  false,
+	} {
+		if d := fw.Decide(newTestRequest(http.MethodGet, "/admin", src)); d.Allowed != allowed {
+			t.Errorf("%s: got %s, want allowed=%t", src, d.Reason, allowed)
+		}
+	}
+}
+
+func TestNetblocksEqual(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  []string
+		equal bool
+	}{
+		{"same", []string{"10.0.0.0/8", "192.168.0.0/16"}, []string{"10.0.0.0/8", "192.168.0.0/16"}, true},
+		{"reordered", []string{"10.0.0.0/8", "192.168.0.0/16"}, []string{"192.168.0.0/16", "10.0.0.0/8"}, true},
+		{"duplicated", []string{"10.0.0.0/8", "10.0.0.0/8", "192.168.0.0/16"}, []string{"192.168.0.0/16", "10.0.0.0/8"}, true},
+		{"not canonical", []string{"10.1.2.3/8"}, []string{"10.0.0.0/8"}, true},
+		{"both empty", nil, []string{}, true},
+		{"different prefix length", []string{"10.0.0.0/8"}, []string{"10.0.0.0/16"}, false},
+		{"extra netblock", []string{"10.0.0.0/8"}, []string{"10.0.0.0/8", "192.168.0.0/16"}, false},
+		{"different netblock", []string{"10.0.0.0/8", "192.168.0.0/16"}, []string{"10.0.0.0/8", "172.16.0.0/12"}, false},
+		{"one empty", []string{"10.0.0.0/8"}, nil, false},
+	}
+	for _, test := range tests {
+		a, err := parseCIDRs(test.a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := parseCIDRs(test.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := NetblocksEqual(a, b); got != test.equal {
+			t.Errorf("%s: got %t, want %t", test.name, got, test.equal)
+		}
+		if got := NetblocksEqual(b, a); got != test.equal {
+			t.Errorf("%s, swapped: got %t, want %t", test.name, got, test.equal)
+		}
+	}
+}
+
+func TestSetPathRuleSkipsEquivalentNetblocks(t *testing.T) {
+	fw := New()
+	if err := fw.AddPathRule("/admin", []string{"10.0.0.0/8", "192.168.0.0/16"}); err != nil {
+		t.Fatal(err)
+	}
+	changes := 0
+	fw.OnRuleChange = func(event RuleChangeEvent) { changes++ }
+	if err := fw.SetPathRule("/admin", []string{"192.168.0.0/16", "10.1.2.3/8", "10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	if changes != 0 {
+		t.Errorf("equivalent netblocks fired %d rule changes, want none", changes)
+	}
+	if err := fw.SetPathRule("/admin", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	if changes != 1 {
+		t.Errorf("different netblocks fired %d rule changes, want 1", changes)
+	}
+}
+
+func TestAddPathNetblocks(t *testing.T) {
+	fw := New()
+	networks := []net.IPNet{
+		// a 16 byte IPv4 address with a 32 bit mask, as net.IPv4 returns
+		{IP: net.IPv4(10, 1, 2, 3), Mask: net.CIDRMask(16, 32)},
+		mustParseCIDR(t, "192.168.0.0/24"),
+		mustParseCIDR(t, "2001:db8:1::/48"),
+	}
+	if err := fw.AddPathNetblocks("/admin", networks); err != nil {
+		t.Fatal(err)
+	}
+	// netblocks are copied, so the caller may reuse them
+	networks[1].IP[2] = 9
+	if got := formatNetblocks(fw.GetRules().PathToNetblocks["/admin"]); got != "10.1.0.0/16 192.168.0.0/24 2001:db8:1::/48" {
+		t.Errorf("got netblocks %s", got)
+	}
+	for src, trusted := range map[string]bool{
+		"10.1.200.1":      true,
+		"10.2.0.1":        false,
+		"192.168.0.7":     true,
+		"192.168.9.7":     false,
+		"2001:db8:1:2::3": true,
+		"2001:db8:2::3":   false,
+	} {
+		if d := fw.Decide(newTestRequest(http.MethodGet, "/admin", src)); (d.Reason == ReasonTrusted) != trusted {
+			t.Errorf("%s: got %s, want trusted=%t", src, d.Reason, trusted)
+		}
+	}
+	if err := fw.AddPathNetblocks("/admin", nil); err == nil {
+		t.Error("added a second rule for a path")
+	}
+
+	for name, networks := range map[string][]net.IPNet{
+		"zero value":               {{}},
+		"nil mask":                 {{IP: net.ParseIP("10.0.0.0")}},
+		"non-contiguous mask":      {{IP: net.ParseIP("10.0.0.0").To4(), Mask: net.IPv4Mask(255, 0, 255, 0)}},
+		"duplicate":                {mustParseCIDR(t, "10.0.0.0/8"), mustParseCIDR(t, "10.0.0.0/8")},
+		"duplicate once canonical": {mustParseCIDR(t, "10.0.0.0/8"), {IP: net.IPv4(10, 1, 2, 3), Mask: net.CIDRMask(8, 32)}},
+	} {
+		err := fw.AddPathNetblocks("/"+name, networks)
+		if err == nil || !strings.HasPrefix(err.Error(), ErrInvalidNetblock.Error()) {
+			t.Errorf("%s: got error %v, want %s", name, err, ErrInvalidNetblock)
+		}
+		if fw.HasRule("/" + name) {
+			t.Errorf("%s: rule added", name)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package firewall
+
+import (
+	"crypto/tls"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+/*PathOptions represents additional conditions attached to a path rule.
+* Every condition that is set must hold, in addition to the source IP being
+* part of the path's trusted netblocks, for a request to be allowed
+ */
+type PathOptions struct {
+	// MatchRequestURI marks a rule whose key is a request URI (path and query)
+	// rather than a path, see AddRequestURIRule
+	MatchRequestURI bool
+	// UserAgent is a regular expression which the request's User-Agent header
+	// must match. Use regexp.QuoteMeta to match a plain substring
+	UserAgent string
+	// Condition, when set, decides which sources the rule trusts instead of the
+	// path's netblocks, see AddPathCondition
+	Condition Condition
+	// Resolver, when set, trusts sources which are not part of the path's
+	// netblocks but match it, e.g. by geolocation. See Resolver
+	Resolver Resolver
+	// ExtraCondition, when set, must also return true for a request to be
+	// allowed. It is evaluated last, only for requests from trusted sources
+	// which satisfy every other condition, returning false blocks the request.
+	// It is called without the firewall's lock held, so it may block
+	ExtraCondition func(r *http.Request) bool
+	// RequireTrustedChain requires every IP in the X-Forwarded-For chain, as
+	// well as the direct peer, to be part of the path's trusted netblocks
+	RequireTrustedChain bool
+	// RequireTLS rejects plaintext requests to the path with a 426
+	RequireTLS bool
+	// MinTLSVersion (e.g. tls.VersionTLS12) and DisallowedCipherSuites reject
+	// requests to the path negotiated with an older version or one of the given
+	// cipher suites with a 426. Setting either rejects plaintext requests too,
+	// including ones forwarded by TrustedProxies, whose TLS parameters are unknown
+	MinTLSVersion          uint16
+	DisallowedCipherSuites []uint16
+	// Methods, when set, scopes the rule to requests with one of the given
+	// methods. Requests with other methods are evaluated as if the path had
+	// no rule, i.e. by the default rule or fail-open
+	Methods []string
+	// Listeners restricts the path to requests arriving on the given listeners,
+	// see Firewall.ListenerName. Requests on other listeners are blocked
+	Listeners []string
+	// MaxBodyBytes rejects requests with a larger Content-Length with a 413.
+	// Bodies without a Content-Length are limited with an http.MaxBytesReader,
+	// so reads past the limit fail in the wrapped handler
+	MaxBodyBytes int64
+	// MaxConcurrent is the maximum number of requests matching the rule the
+	// wrapped handler may serve at once, further requests are rejected with a
+	// 503. On DefaultOptions it bounds the requests to every path without a rule
+	// together
+	MaxConcurrent int
+	// OnUntrusted, when set, handles requests to the path which are not allowed
+	// by its rule instead of the default block response, e.g. to redirect to a
+	// step-up authentication flow. Requests blocked for any other reason, such
+	// as deny lists, still get the default block response
+	OnUntrusted func(w http.ResponseWriter, r *http.Request)
+	// SignatureHeader, when set, names a header which must carry the hex encoded
+	// HMAC-SHA256 of the request body keyed with SignatureSecret, optionally
+	// prefixed with "sha256=", e.g. for webhooks. The body is buffered in memory
+	// to verify it, up to MaxBodyBytes when set and DefaultSignatureMaxBodyBytes
+	// otherwise, after the firewall's lock is released
+	SignatureHeader string
+	SignatureSecret []byte
+	// ShedAbove, when set, sheds requests to the path with a 503, whatever their
+	// source, while the firewall's global request rate (see RequestRate) is above
+	// that many requests per second, so that low priority paths give way first
+	ShedAbove float64
+	// TokenVerifier, when set, requires a bearer token it verifies, and which
+	// carries RequiredClaim with RequiredClaimValue when RequiredClaim is set
+	// (e.g. "scope" and "admin:write"), see TokenVerifier
+	TokenVerifier      TokenVerifier
+	RequiredClaim      string
+	RequiredClaimValue string
+	// Breaker, when set, restricts the path to stricter netblocks while its
+	// backend responds with too many 5xx, see CircuitBreaker
+	Breaker *CircuitBreaker
+	// Staged rolls the rule out gradually: it is only enforced on EnforcePercentage
+	// percent of source IPs, requests from the others which the rule would block are
+	// allowed and logged instead. Selection is deterministic, so a source IP is
+	// either always or never enforced on for a given percentage
+	Staged bool
+	// EnforcePercentage is the percentage, from 0 to 100, of source IPs a Staged rule is enforced on
+	EnforcePercentage float64
+
+	userAgent *regexp.Regexp
+}
+
+// compile pre-builds the matchers for any patterns set on the options
+func (opts *PathOptions) compile() error {
+	if opts.UserAgent != "" {
+		re, err := regexp.Compile(opts.UserAgent)
+		if err != nil {
+			return fmt.Errorf("%s: %s", ErrCouldNotParseUserAgent, err)
+		}
+		opts.userAgent = re
+	}
+	return nil
+}
+
+// appliesTo checks whether a rule with the options applies to requests with the given method
+func (opts PathOptions) appliesTo(method string) bool {
+	if len(opts.Methods) == 0 {
+		return true
+	}
+	for _, m := range opts.Methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+/*Compile eagerly builds the matchers for every rule, such as User-Agent regular
+* expressions, and the index of the global deny list, so that the first requests
+* don't pay for it. It reports the first pattern which fails to compile, e.g. from
+* options set directly on Rules
+ */
+func (fw *Firewall) Compile() error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	for path, opts := range fw.Rules.PathToOptions {
+		if err := opts.compile(); err != nil {
+			return fmt.Errorf("invalid options for path %s: %s", path, err)
+		}
+		fw.Rules.PathToOptions[path] = opts
+	}
+	if err := fw.Rules.DefaultOptions.compile(); err != nil {
+		return fmt.Errorf("invalid default options: %s", err)
+	}
+	if !fw.globalDenyTree.Load().builtFrom(fw.Rules.DeniedNetblocks) {
+		fw.globalDenyTree.Store(newDenyTree(fw.Rules.DeniedNetblocks))
+	}
+	return nil
+}
+
+// tlsAcceptable checks whether a request's TLS connection satisfies the version and cipher suite requirements of the options
+func (opts PathOptions) tlsAcceptable(state *tls.ConnectionState) bool {
+	if opts.MinTLSVersion == 0 && len(opts.DisallowedCipherSuites) == 0 {
+		return true
+	}
+	if state == nil || state.Version < opts.MinTLSVersion {
+		return false
+	}
+	for _, suite := range opts.DisallowedCipherSuites {
+		if state.CipherSuite == suite {
+			return false
+		}
+	}
+	return true
+}
+
+// Matches checks whether a request satisfies all the conditions set on the options
+func (opts PathOptions) Matches(r *http.Request) bool {
+	if !opts.matchesUserAgent(r.UserAgent()) || !opts.matchesSignature(r) || !opts.matchesToken(r) {
+		return false
+	}
+	return opts.ExtraCondition == nil || opts.ExtraCondition(r)
+}
+
+/*enforcedOn checks whether a rule with the options is enforced on a source IP. Source
+* IPs are hashed into one of 10000 buckets so that partial percentages are sticky
+ */
+func (opts PathOptions) enforcedOn(src net.IP) bool {
+	if !opts.Staged {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write(src.To16())
+	return float64(h.Sum32()%10000) < opts.EnforcePercentage*100
+}
+
+func (opts PathOptions) matchesUserAgent(ua string) bool {
+	if opts.UserAgent == "" {
+		return true
+	}
+	if opts.userAgent != nil {
+		return opts.userAgent.MatchString(ua)
+	}
+	// options populated without going through AddPathRuleWithOptions
+	matched, err := regexp.MatchString(opts.UserAgent, ua)
+	return err == nil && matched
+}
@@ -0,0 +1,93 @@
+package firewall
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestUserAgentAndIP(t *testing.T) {
+	fw := New()
+	opts := PathOptions{UserAgent: `^monitoring-agent/\d+`}
+	if err := fw.AddPathRuleWithOptions("/metrics", []string{"10.0.0.0/8"}, opts); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		src, userAgent string
+		allowed        bool
+	}{
+		{"10.1.2.3", "monitoring-agent/2", true},
+		{"10.1.2.3", "curl/8.0", false},
+		{"10.1.2.3", "", false},
+		{"10.1.2.3", "x monitoring-agent/2", false},
+		{"198.51.100.1", "monitoring-agent/2", false},
+		{"198.51.100.1", "curl/8.0", false},
+	}
+	for _, test := range tests {
+		r := newTestRequest(http.MethodGet, "/metrics", test.src)
+		r.Header.Set("User-Agent", test.userAgent)
+		if d := fw.Decide(r); d.Allowed != test.allowed {
+			t.Errorf("%s with User-Agent %q: got %s, want allowed=%t", test.src, test.userAgent, d.Reason, test.allowed)
+		}
+	}
+}
+
+func TestInvalidUserAgentPattern(t *testing.T) {
+	fw := New()
+	if err := fw.AddPathRuleWithOptions("/metrics", []string{"10.0.0.0/8"}, PathOptions{UserAgent: "("}); err == nil {
+		t.Error("added a rule with an invalid User-Agent pattern")
+	}
+	if fw.HasRule("/metrics") {
+		t.Error("rule with an invalid User-Agent pattern was added")
+	}
+}
+
+func TestUserAgentSetDirectlyOnRules(t *testing.T) {
+	fw := New()
+	if err := fw.AddPathRule("/metrics", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	fw.Rules.PathToOptions["/metrics"] = PathOptions{UserAgent: "^agent$"}
+	r := newTestRequest(http.MethodGet, "/metrics", "10.1.2.3")
+	r.Header.Set("User-Agent", "agent")
+	if d := fw.Decide(r); !d.Allowed {
+		t.Errorf("got %s for a pattern which was not compiled, want allowed", d.Reason)
+	}
+}
+
+func TestCompile(t *testing.T) {
+	fw := New()
+	if err := fw.AddPathRule("/metrics", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	fw.Rules.PathToOptions["/metrics"] = PathOptions{UserAgent: "^agent$"}
+	if err := fw.Compile(); err != nil {
+		t.Fatal(err)
+	}
+	for userAgent, allowed := range map[string]bool{"agent": true, "curl/8.0": false} {
+		r := newTestRequest(http.MethodGet, "/metrics", "10.1.2.3")
+		r.Header.Set("User-Agent", userAgent)
+		if d := fw.Decide(r); d.Allowed != allowed {
+			t.Errorf("User-Agent %q: got %s, want allowed=%t", userAgent, d.Reason, allowed)
+		}
+	}
+}
+
+func TestCompileReportsInvalidPatterns(t *testing.T) {
+	fw := New()
+	if err := fw.AddPathRule("/metrics", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	fw.Rules.PathToOptions["/metrics"] = PathOptions{UserAgent: "("}
+	if err := fw.Compile(); err == nil || !strings.Contains(err.Error(), "/metrics") {
+		t.Errorf("got error %v, want one naming /metrics", err)
+	}
+
+	fw = New()
+	fw.Rules.DefaultNetblocks = []net.IPNet{mustParseCIDR(t, "10.0.0.0/8")}
+	fw.Rules.DefaultOptions = PathOptions{UserAgent: "["}
+	if err := fw.Compile(); err == nil || !strings.Contains(err.Error(), "default options") {
+		t.Errorf("got error %v, want one for the default options", err)
+	}
+}
@@ -0,0 +1,135 @@
+package firewall
+
+import "net"
+
+/*prefixTree is a binary trie of netblocks answering membership in time bounded
+* by the address length, rather than the number of netblocks. It gives the same
+* answers as IPIsTrusted over the netblocks it was built from: netblocks whose
+* masks aren't contiguous, which a trie can't represent, are scanned linearly
+ */
+type prefixTree struct {
+	v4, v6 *prefixNode
+	other  []net.IPNet
+}
+
+type prefixNode struct {
+	children [2]*prefixNode
+	terminal bool
+}
+
+// newPrefixTree builds the prefix tree of a list of netblocks
+func newPrefixTree(netblocks []net.IPNet) *prefixTree {
+	t := &prefixTree{v4: &prefixNode{}, v6: &prefixNode{}}
+	for _, netblock := range netblocks {
+		ip, mask := netblockNumberAndMask(netblock)
+		ones, bits := mask.Size()
+		if ip == nil || bits == 0 {
+			// invalid addresses never match, non-contiguous masks are scanned
+			if ip != nil {
+				t.other = append(t.other, netblock)
+			}
+			continue
+		}
+		node := t.v6
+		if len(ip) == net.IPv4len {
+			node = t.v4
+		}
+		for i := 0; i < ones && !node.terminal; i++ {
+			bit := ip[i/8] >> (7 - uint(i%8)) & 1
+			if node.children[bit] == nil {
+				node.children[bit] = &prefixNode{}
+			}
+			node = node.children[bit]
+		}
+		// a shorter prefix already covers every address below it
+		node.terminal, node.children = true, [2]*prefixNode{}
+	}
+	return t
+}
+
+// contains checks whether an IP address is part of any of the tree's netblocks
+func (t *prefixTree) contains(ip net.IP) bool {
+	node := t.v6
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, node = ip4, t.v4
+	} else if len(ip) != net.IPv6len {
+		return false
+	}
+	for i := 0; node != nil; i++ {
+		if node.terminal {
+			return true
+		}
+		if i == len(ip)*8 {
+			break
+		}
+		node = node.children[ip[i/8]>>(7-uint(i%8))&1]
+	}
+	return IPIsTrusted(t.other, ip)
+}
+
+// netblockNumberAndMask returns a netblock's address and mask with the same length, as net.IPNet.Contains compares them
+func netblockNumberAndMask(n net.IPNet) (net.IP, net.IPMask) {
+	ip := n.IP.To4()
+	if ip == nil {
+		ip = n.IP
+		if len(ip) != net.IPv6len {
+			return nil, nil
+		}
+	}
+	mask := n.Mask
+	switch len(mask) {
+	case net.IPv4len:
+		if len(ip) != net.IPv4len {
+			return nil, nil
+		}
+	case net.IPv6len:
+		if len(ip) == net.IPv4len {
+			mask = mask[12:]
+		}
+	default:
+		return nil, nil
+	}
+	return ip, mask
+}
+
+// denyTree is the prefix tree of the global deny list along with the list it was built from
+type denyTree struct {
+	source []net.IPNet
+	tree   *prefixTree
+}
+
+// newDenyTree builds the prefix tree of a global deny list, nil for an empty one
+func newDenyTree(denied []net.IPNet) *denyTree {
+	if len(denied) == 0 {
+		return nil
+	}
+	return &denyTree{source: denied, tree: newPrefixTree(denied)}
+}
+
+// builtFrom checks whether a deny tree was built from a deny list, as opposed to a list which replaced it
+func (t *denyTree) builtFrom(denied []net.IPNet) bool {
+	return t != nil && len(t.source) == len(denied) && &t.source[0] == &denied[0]
+}
+
+/*globalDenied checks whether an IP address is part of the global deny list. The
+* list's prefix tree is built when rules are loaded or replaced, or by Compile,
+* and otherwise by the first request after Rules.DeniedNetblocks is assigned,
+* while concurrent requests wait for it. The firewall's lock must be held
+ */
+func (fw *Firewall) globalDenied(src net.IP) bool {
+	denied := fw.Rules.DeniedNetblocks
+	if src == nil || len(denied) == 0 {
+		return false
+	}
+	cached := fw.globalDenyTree.Load()
+	if !cached.builtFrom(denied) {
+		// only one request builds the tree, which may hold a large number of netblocks
+		fw.denyTreeMu.Lock()
+		if cached = fw.globalDenyTree.Load(); !cached.builtFrom(denied) {
+			cached = newDenyTree(denied)
+			fw.globalDenyTree.Store(cached)
+		}
+		fw.denyTreeMu.Unlock()
+	}
+	return cached.tree.contains(src)
+}
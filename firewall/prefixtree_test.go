@@ -0,0 +1,211 @@
+package firewall
+
+import (
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func mustParseCIDR(t testing.TB, network string) net.IPNet {
+	t.Helper()
+	_, netblock, err := net.ParseCIDR(network)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *netblock
+}
+
+func TestPrefixTreeMatchesIPIsTrusted(t *testing.T) {
+	netblocks := []net.IPNet{
+		mustParseCIDR(t, "10.0.0.0/8"),
+		mustParseCIDR(t, "10.1.0.0/16"),
+		mustParseCIDR(t, "192.168.1.128/25"),
+		mustParseCIDR(t, "2001:db8::/32"),
+		mustParseCIDR(t, "2001:db8:1::1/128"),
+		// an IPv4 netblock with 16 byte address and mask
+		{IP: net.ParseIP("172.16.0.0"), Mask: net.CIDRMask(108, 128)},
+		// IPv4-mapped IPv6 prefix, which net.IPNet matches IPv4 addresses against
+		mustParseCIDR(t, "::ffff:198.51.100.0/120"),
+		// non-contiguous masks
+		{IP: net.IPv4(203, 0, 0, 7).To4(), Mask: net.IPv4Mask(255, 0, 0, 255)},
+		{IP: net.ParseIP("2001:db8:ff::"), Mask: net.IPMask{0xff, 0xff, 0xff, 0xff, 0, 0xff, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}},
+		// invalid netblocks
+		{IP: net.IP{1, 2, 3}, Mask: net.CIDRMask(8, 32)},
+		{IP: net.ParseIP("2001:db8::"), Mask: net.IPMask{0xff}},
+	}
+	ips := []string{
+		"10.2.3.4", "11.0.0.1", "10.1.255.255",
+		"192.168.1.127", "192.168.1.128", "192.168.1.255",
+		"::ffff:10.2.3.4", "::ffff:11.0.0.1", "::ffff:192.168.1.200",
+		"172.16.5.5", "::ffff:172.16.5.5", "172.32.0.0",
+		"198.51.100.5", "::ffff:198.51.100.5", "198.51.101.5",
+		"203.9.9.7", "203.9.9.8", "::ffff:203.1.2.7", "204.9.9.7",
+		"2001:db8::1", "2001:db9::1", "2001:db8:1::1", "2001:db8:1::2",
+		"2001:db8:ff:0:cc::", "2001:db8:ff:0:cc:1::",
+		"::1", "::",
+	}
+	tree := newPrefixTree(netblocks)
+	for _, s := range ips {
+		ip := net.ParseIP(s)
+		if got, want := tree.contains(ip), IPIsTrusted(netblocks, ip); got != want {
+			t.Errorf("%s: got %t from the prefix tree, %t from IPIsTrusted", s, got, want)
+		}
+	}
+	if tree.contains(nil) {
+		t.Error("nil IP contained in the prefix tree")
+	}
+	if newPrefixTree(nil).contains(net.ParseIP("10.0.0.1")) {
+		t.Error("IP contained in an empty prefix tree")
+	}
+}
+
+// randomNetblock returns a random IPv4 or IPv6 netblock, with a non-contiguous mask one time out of ten
+func randomNetblock(rnd *rand.Rand) net.IPNet {
+	size := net.IPv4len
+	if rnd.Intn(2) == 0 {
+		size = net.IPv6len
+	}
+	ip := make(net.IP, size)
+	rnd.Read(ip)
+	if size == net.IPv6len && rnd.Intn(4) == 0 {
+		// IPv4-mapped
+		copy(ip, net.IPv4(0, 0, 0, 0)[:12])
+	}
+	mask := net.CIDRMask(rnd.Intn(size*8/2+1), size*8)
+	if rnd.Intn(10) == 0 {
+		mask = make(net.IPMask, size)
+		rnd.Read(mask)
+	}
+	return net.IPNet{IP: ip.Mask(mask), Mask: mask}
+}
+
+// randomIPNear returns a random IP address sharing a random prefix with a netblock
+func randomIPNear(rnd *rand.Rand, netblock net.IPNet) net.IP {
+	ip := make(net.IP, len(netblock.IP))
+	rnd.Read(ip)
+	copy(ip, netblock.IP[:rnd.Intn(len(ip)+1)])
+	return ip
+}
+
+func TestPrefixTreeMatchesIPIsTrustedRandomly(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for round := 0; round < 50; round++ {
+		netblocks := make([]net.IPNet, 1+rnd.Intn(50))
+		for i := range netblocks {
+			netblocks[i] = randomNetblock(rnd)
+		}
+		tree := newPrefixTree(netblocks)
+		for i := 0; i < 200; i++ {
+			ip := randomIPNear(rnd, netblocks[rnd.Intn(len(netblocks))])
+			if got, want := tree.contains(ip), IPIsTrusted(netblocks, ip); got != want {
+				t.Fatalf("%s: got %t from the prefix tree, %t from IPIsTrusted over %v", ip, got, want, netblocks)
+			}
+		}
+	}
+}
+
+// benchmarkNetblocks returns 200000 distinct /24 netblocks with IP addresses half of which they contain
+func benchmarkNetblocks() ([]net.IPNet, []net.IP) {
+	rnd := rand.New(rand.NewSource(1))
+	netblocks := make([]net.IPNet, 200000)
+	for i := range netblocks {
+		netblocks[i] = net.IPNet{IP: net.IPv4(byte(i>>16), byte(i>>8), byte(i), 0).To4(), Mask: net.CIDRMask(24, 32)}
+	}
+	ips := make([]net.IP, 1024)
+	for i := range ips {
+		n := rnd.Intn(2 * len(netblocks))
+		ips[i] = net.IPv4(byte(n>>16), byte(n>>8), byte(n), 1)
+	}
+	return netblocks, ips
+}
+
+func BenchmarkPrefixTree(b *testing.B) {
+	netblocks, ips := benchmarkNetblocks()
+	tree := newPrefixTree(netblocks)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tree.contains(ips[i%len(ips)])
+	}
+}
+
+func BenchmarkLinearScan(b *testing.B) {
+	netblocks, ips := benchmarkNetblocks()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		IPIsTrusted(netblocks, ips[i%len(ips)])
+	}
+}
+
+func TestGlobalDenyTreeIsRebuilt(t *testing.T) {
+	fw := New()
+	denied := func(src string) bool {
+		return fw.Decide(newTestRequest(http.MethodGet, "/", src)).Reason == ReasonDenied
+	}
+	if err := fw.LoadRules(strings.NewReader(`{"deny": ["203.0.113.0/24"]}`)); err != nil {
+		t.Fatal(err)
+	}
+	// loading the rules builds the tree before any request
+	if !fw.globalDenyTree.Load().builtFrom(fw.Rules.DeniedNetblocks) {
+		t.Error("deny tree not built when loading the rules")
+	}
+	if !denied("203.0.113.1") {
+		t.Fatal("source in the deny list not denied")
+	}
+
+	// assigning a new list is picked up by the next request
+	fw.mu.Lock()
+	fw.Rules.DeniedNetblocks = []net.IPNet{mustParseCIDR(t, "198.51.100.0/24")}
+	fw.mu.Unlock()
+	if denied("203.0.113.1") || !denied("198.51.100.1") {
+		t.Error("assigned deny list not used")
+	}
+
+	// changes made in place take effect once the rules are replaced
+	fw.mu.Lock()
+	fw.Rules.DeniedNetblocks[0] = mustParseCIDR(t, "192.0.2.0/24")
+	fw.mu.Unlock()
+	if err := fw.ReplaceRules(fw.GetRules()); err != nil {
+		t.Fatal(err)
+	}
+	if denied("198.51.100.1") || !denied("192.0.2.1") {
+		t.Error("deny list edited in place not used once the rules were replaced")
+	}
+
+	if err := fw.ReplaceRules(Rules{}); err != nil {
+		t.Fatal(err)
+	}
+	if denied("192.0.2.1") || fw.globalDenyTree.Load() != nil {
+		t.Error("emptied deny list still applies")
+	}
+}
+
+func TestCompileBuildsGlobalDenyTree(t *testing.T) {
+	fw := New()
+	fw.Rules.DeniedNetblocks = []net.IPNet{mustParseCIDR(t, "203.0.113.0/24")}
+	if err := fw.Compile(); err != nil {
+		t.Fatal(err)
+	}
+	compiled := fw.globalDenyTree.Load()
+	if !compiled.builtFrom(fw.Rules.DeniedNetblocks) {
+		t.Fatal("Compile didn't build the deny tree")
+	}
+
+	// concurrent first requests share a single tree
+	fw = New()
+	fw.Rules.DeniedNetblocks = []net.IPNet{mustParseCIDR(t, "203.0.113.0/24")}
+	trees := make(chan *denyTree)
+	for i := 0; i < 8; i++ {
+		go func() {
+			fw.Decide(newTestRequest(http.MethodGet, "/", "203.0.113.1"))
+			trees <- fw.globalDenyTree.Load()
+		}()
+	}
+	first := <-trees
+	for i := 1; i < 8; i++ {
+		if tree := <-trees; tree != first {
+			t.Fatal("concurrent requests built separate deny trees")
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package firewall
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// preflightRequest returns a CORS preflight for a POST to a path
+func preflightRequest(path, src string) *http.Request {
+	r := newTestRequest(http.MethodOptions, path, src)
+	r.Header.Set("Origin", "https://app.example.com")
+	r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	return r
+}
+
+func TestPreflight(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		handler http.Handler
+		served  string
+	}{
+		{"wrapped handler", nil, "wrapped"},
+		{"preflight handler", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Header().Set("X-Served-By", "preflight") }), "preflight"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			fw := New()
+			fw.AllowPreflight = true
+			fw.PreflightHandler = test.handler
+			fw.Rules.DeniedNetblocks = []net.IPNet{mustParseCIDR(t, "203.0.113.0/24")}
+			if err := fw.AddPathRule("/api", []string{"10.0.0.0/8"}); err != nil {
+				t.Fatal(err)
+			}
+			h := fw.Wrap(func(w http.ResponseWriter, r *http.Request) { w.Header().Set("X-Served-By", "wrapped") })
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, preflightRequest("/api", "198.51.100.1"))
+			if w.Code != http.StatusOK || w.Header().Get("X-Served-By") != test.served {
+				t.Errorf("preflight: got %d served by %q, want 200 served by %q", w.Code, w.Header().Get("X-Served-By"), test.served)
+			}
+			w = httptest.NewRecorder()
+			h.ServeHTTP(w, newTestRequest(http.MethodPost, "/api", "198.51.100.1"))
+			if w.Code != http.StatusForbidden {
+				t.Errorf("POST following the preflight: got %d, want 403", w.Code)
+			}
+			w = httptest.NewRecorder()
+			h.ServeHTTP(w, preflightRequest("/api", "203.0.113.1"))
+			if w.Code != http.StatusForbidden {
+				t.Errorf("preflight from a denied source: got %d, want 403", w.Code)
+			}
+		})
+	}
+}
+
+func TestPreflightIsOptIn(t *testing.T) {
+	fw := New()
+	if err := fw.AddPathRule("/api", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	if d := fw.Decide(preflightRequest("/api", "198.51.100.1")); d.Reason != ReasonUntrusted {
+		t.Errorf("got %s without AllowPreflight, want untrusted", d.Reason)
+	}
+	fw.AllowPreflight = true
+	// OPTIONS requests which aren't preflights remain gated
+	if d := fw.Decide(newTestRequest(http.MethodOptions, "/api", "198.51.100.1")); d.Reason != ReasonUntrusted {
+		t.Errorf("got %s for an OPTIONS request which is not a preflight, want untrusted", d.Reason)
+	}
+	if d := fw.Decide(preflightRequest("/api", "198.51.100.1")); d.Reason != ReasonPreflight {
+		t.Errorf("got %s with AllowPreflight, want preflight", d.Reason)
+	}
+}
@@ -0,0 +1,32 @@
+package firewall
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Problem is an RFC 7807 problem details object
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// writeProblem writes a blocked response as an application/problem+json body
+func writeProblem(w http.ResponseWriter, d Decision, includePath bool) {
+	p := Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(d.Status),
+		Status: d.Status,
+		Detail: "the request was blocked by the firewall",
+	}
+	if includePath {
+		p.Detail = fmt.Sprintf("the request for %s was blocked by the firewall", d.Path)
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(d.Status)
+	json.NewEncoder(w).Encode(p)
+}
@@ -0,0 +1,60 @@
+package firewall
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestProblemJSON(t *testing.T) {
+	for _, includePath := range []bool{false, true} {
+		fw := New()
+		fw.ProblemJSON = true
+		fw.ProblemDetailIncludesPath = includePath
+		if err := fw.AddPathRule("/admin", []string{"10.0.0.0/8"}); err != nil {
+			t.Fatal(err)
+		}
+		w := serveBlocked(fw, newTestRequest(http.MethodGet, "/admin", "198.51.100.1"))
+		if w.Code != http.StatusForbidden {
+			t.Errorf("got %d, want 403", w.Code)
+		}
+		if got := w.Header().Get("Content-Type"); got != "application/problem+json" {
+			t.Errorf("got content type %q, want application/problem+json", got)
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &fields); err != nil {
+			t.Fatalf("could not decode %q: %s", w.Body.String(), err)
+		}
+		want := map[string]interface{}{
+			"type":   "about:blank",
+			"title":  "Forbidden",
+			"status": float64(http.StatusForbidden),
+			"detail": "the request was blocked by the firewall",
+		}
+		if includePath {
+			want["detail"] = "the request for /admin was blocked by the firewall"
+		}
+		if len(fields) != len(want) {
+			t.Errorf("got members %v, want %v", fields, want)
+		}
+		for name, value := range want {
+			if fields[name] != value {
+				t.Errorf("includePath=%t: got %s=%v, want %v", includePath, name, fields[name], value)
+			}
+		}
+	}
+}
+
+func TestProblemJSONUsesBlockStatus(t *testing.T) {
+	fw := New()
+	fw.ProblemJSON = true
+	fw.BlockStatus = http.StatusNotFound
+	w := serveBlocked(fw, newTestRequest(http.MethodGet, "/admin", "198.51.100.1"))
+	var p Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusNotFound || p.Status != http.StatusNotFound || p.Title != "Not Found" {
+		t.Errorf("got %d with problem %+v, want 404 Not Found", w.Code, p)
+	}
+}
@@ -0,0 +1,205 @@
+package firewall
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNoProxyHeader will be returned when a connection does not start with a PROXY protocol header
+	ErrNoProxyHeader = errors.New("no PROXY protocol header")
+	// ErrInvalidProxyHeader will be returned when a PROXY protocol header can't be parsed
+	ErrInvalidProxyHeader = errors.New("invalid PROXY protocol header")
+)
+
+const (
+	// proxyV1MaxLength is the maximum length of a v1 header, including the CRLF
+	proxyV1MaxLength = 107
+	// defaultProxyHeaderTimeout bounds how long a connection may take to send its header
+	defaultProxyHeaderTimeout = 5 * time.Second
+)
+
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+/*ReadProxyHeader consumes a PROXY protocol (v1 or v2) header from a reader and
+* returns the client's address it carries. The address is nil for headers which
+* don't carry one (v1 UNKNOWN and v2 LOCAL), i.e. the connection's own address
+* should be used. ErrNoProxyHeader is returned, without consuming anything, when
+* the reader does not start with a header
+ */
+func ReadProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	if peek, err := r.Peek(len(proxyV2Signature)); err == nil && bytes.Equal(peek, proxyV2Signature) {
+		return readProxyV2(r)
+	}
+	if peek, err := r.Peek(6); err == nil && string(peek) == "PROXY " {
+		return readProxyV1(r)
+	}
+	return nil, ErrNoProxyHeader
+}
+
+// readProxyV1 parses a header like "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n"
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < proxyV1MaxLength {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", ErrInvalidProxyHeader, err)
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, fmt.Errorf("%s: missing CRLF", ErrInvalidProxyHeader)
+	}
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("%s: %q", ErrInvalidProxyHeader, line)
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil || (fields[1] == "TCP4") != (ip.To4() != nil) {
+		return nil, fmt.Errorf("%s: %q", ErrInvalidProxyHeader, line)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readProxyV2 parses a binary header, see section 2.2 of the PROXY protocol specification
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, len(proxyV2Signature)+4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("%s: %s", ErrInvalidProxyHeader, err)
+	}
+	verCmd, family := header[12], header[13]
+	body := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, fmt.Errorf("%s: %s", ErrInvalidProxyHeader, err)
+	}
+	if verCmd>>4 != 2 {
+		return nil, fmt.Errorf("%s: unsupported version %d", ErrInvalidProxyHeader, verCmd>>4)
+	}
+	switch verCmd & 0x0f {
+	case 0x0:
+		// LOCAL, e.g. health checks from the proxy itself
+		return nil, nil
+	case 0x1:
+		// PROXY
+	default:
+		return nil, fmt.Errorf("%s: unsupported command %d", ErrInvalidProxyHeader, verCmd&0x0f)
+	}
+	var ipLen int
+	switch family >> 4 {
+	case 0x1:
+		ipLen = net.IPv4len
+	case 0x2:
+		ipLen = net.IPv6len
+	default:
+		// AF_UNSPEC and AF_UNIX carry no usable IP
+		return nil, nil
+	}
+	// source address, destination address, source port, destination port
+	if len(body) < 2*ipLen+4 {
+		return nil, fmt.Errorf("%s: address block too short", ErrInvalidProxyHeader)
+	}
+	ip := net.IP(append([]byte(nil), body[:ipLen]...))
+	port := binary.BigEndian.Uint16(body[2*ipLen : 2*ipLen+2])
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+/*ProxyProtocolListener wraps a net.Listener so that connections from TrustedProxies
+* which start with a PROXY protocol header report the client's address it carries as
+* their RemoteAddr. Serving HTTP on this listener makes the firewall, which evaluates
+* r.RemoteAddr, see the real client IP. Connections from other peers are untouched
+ */
+type ProxyProtocolListener struct {
+	net.Listener
+	// TrustedProxies are the netblocks of the proxies whose headers are believed
+	TrustedProxies []net.IPNet
+	// HeaderTimeout bounds how long a trusted proxy may take to send the header,
+	// it defaults to 5 seconds
+	HeaderTimeout time.Duration
+}
+
+// Accept waits for and returns the next connection to the listener
+func (l *ProxyProtocolListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !IPIsTrusted(l.TrustedProxies, addrIP(conn.RemoteAddr())) {
+		return conn, nil
+	}
+	timeout := l.HeaderTimeout
+	if timeout <= 0 {
+		timeout = defaultProxyHeaderTimeout
+	}
+	return &proxyConn{Conn: conn, reader: bufio.NewReader(conn), timeout: timeout}, nil
+}
+
+// proxyConn reads the PROXY protocol header lazily, from the goroutine serving the connection
+type proxyConn struct {
+	net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+
+	once sync.Once
+	src  net.Addr
+	err  error
+}
+
+func (c *proxyConn) readHeader() {
+	c.once.Do(func() {
+		c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+		c.src, c.err = ReadProxyHeader(c.reader)
+		c.Conn.SetReadDeadline(time.Time{})
+		if c.err == ErrNoProxyHeader {
+			c.err = nil
+		}
+	})
+}
+
+// Read reads data from the connection following the PROXY protocol header
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.readHeader()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+// RemoteAddr returns the client's address from the PROXY protocol header, if any
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.readHeader()
+	if c.src != nil {
+		return c.src
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// addrIP returns the IP of a network address
+func addrIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
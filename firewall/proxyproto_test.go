@@ -0,0 +1,121 @@
+package firewall
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// proxyV2Header builds a binary PROXY protocol header for a client address
+func proxyV2Header(verCmd, family byte, src, dst net.IP, srcPort uint16) []byte {
+	body := append(append([]byte(nil), src...), dst...)
+	body = binary.BigEndian.AppendUint16(body, srcPort)
+	body = binary.BigEndian.AppendUint16(body, 443)
+	header := append(append([]byte(nil), proxyV2Signature...), verCmd, family)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(body)))
+	return append(header, body...)
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		addr   string
+		err    error
+	}{
+		{"v1 TCP4", "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n", "192.0.2.1:56324", nil},
+		{"v1 TCP6", "PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n", "[2001:db8::1]:56324", nil},
+		{"v1 UNKNOWN", "PROXY UNKNOWN\r\n", "", nil},
+		{"v1 family mismatch", "PROXY TCP4 2001:db8::1 2001:db8::2 56324 443\r\n", "", ErrInvalidProxyHeader},
+		{"v1 bad port", "PROXY TCP4 192.0.2.1 198.51.100.1 99999 443\r\n", "", ErrInvalidProxyHeader},
+		{"v1 missing CRLF", "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\n", "", ErrInvalidProxyHeader},
+		{"v1 too long", "PROXY TCP4 " + strings.Repeat("1", proxyV1MaxLength), "", ErrInvalidProxyHeader},
+		{"v2 TCP4", string(proxyV2Header(0x21, 0x11, net.IPv4(192, 0, 2, 1).To4(), net.IPv4(198, 51, 100, 1).To4(), 56324)), "192.0.2.1:56324", nil},
+		{"v2 TCP6", string(proxyV2Header(0x21, 0x21, net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2"), 56324)), "[2001:db8::1]:56324", nil},
+		{"v2 LOCAL", string(proxyV2Header(0x20, 0x11, net.IPv4(192, 0, 2, 1).To4(), net.IPv4(198, 51, 100, 1).To4(), 56324)), "", nil},
+		{"v2 version 1", string(proxyV2Header(0x11, 0x11, net.IPv4(192, 0, 2, 1).To4(), net.IPv4(198, 51, 100, 1).To4(), 56324)), "", ErrInvalidProxyHeader},
+		{"v2 short address block", string(proxyV2Header(0x21, 0x21, net.IPv4(192, 0, 2, 1).To4(), net.IPv4(198, 51, 100, 1).To4(), 56324)), "", ErrInvalidProxyHeader},
+		{"no header", "GET / HTTP/1.1\r\n", "", ErrNoProxyHeader},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := bufio.NewReader(strings.NewReader(test.header + "payload"))
+			addr, err := ReadProxyHeader(r)
+			if test.err != nil {
+				if err == nil || !strings.HasPrefix(err.Error(), test.err.Error()) {
+					t.Fatalf("got error %v, want %v", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := ""
+			if addr != nil {
+				got = addr.String()
+			}
+			if got != test.addr {
+				t.Errorf("got address %q, want %q", got, test.addr)
+			}
+			if rest, _ := io.ReadAll(r); string(rest) != "payload" {
+				t.Errorf("got %q following the header, want payload", rest)
+			}
+		})
+	}
+}
+
+func TestNoProxyHeaderConsumesNothing(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("GET / HTTP/1.1\r\n"))
+	if _, err := ReadProxyHeader(r); !errors.Is(err, ErrNoProxyHeader) {
+		t.Fatalf("got error %v, want ErrNoProxyHeader", err)
+	}
+	if rest, _ := io.ReadAll(r); string(rest) != "GET / HTTP/1.1\r\n" {
+		t.Errorf("got %q, want the request untouched", rest)
+	}
+}
+
+func TestProxyProtocolListener(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		trusted  []net.IPNet
+		wantAddr string
+		wantData string
+	}{
+		{"trusted proxy", []net.IPNet{mustParseCIDR(t, "127.0.0.0/8")}, "192.0.2.1:56324", "payload"},
+		{"untrusted peer", nil, "127.0.0.1", "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\npayload"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			inner, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			l := &ProxyProtocolListener{Listener: inner, TrustedProxies: test.trusted}
+			defer l.Close()
+
+			go func() {
+				conn, err := net.Dial("tcp", inner.Addr().String())
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				io.WriteString(conn, "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\npayload")
+				conn.Close()
+			}()
+			conn, err := l.Accept()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			if addr := conn.RemoteAddr().String(); !strings.HasPrefix(addr, test.wantAddr) {
+				t.Errorf("got remote address %s, want %s", addr, test.wantAddr)
+			}
+			if data, _ := io.ReadAll(conn); string(data) != test.wantData {
+				t.Errorf("read %q, want %q", data, test.wantData)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package firewall
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Reason is the reason the firewall gives for a decision
+type Reason int
+
+const (
+	// ReasonTrusted means the source is trusted by the rule for the path
+	ReasonTrusted Reason = iota
+	// ReasonFailOpen means the path has no rule and the firewall fails open
+	ReasonFailOpen
+	// ReasonBypass means the path's rule is bypassed, see SetPathBypass
+	ReasonBypass
+	// ReasonPathTraversal means the path contains a traversal sequence
+	ReasonPathTraversal
+	// ReasonBanned means the source is banned
+	ReasonBanned
+	// ReasonRateLimited means the source exceeded the rate limit
+	ReasonRateLimited
+	// ReasonDenied means the source is part of a deny list
+	ReasonDenied
+	// ReasonUntrusted means the source is not trusted by the rule for the path
+	ReasonUntrusted
+	// ReasonNoRule means the path has no rule and the firewall fails closed
+	ReasonNoRule
+	// ReasonTLSRequired means the request was not made over TLS
+	ReasonTLSRequired
+	// ReasonBodyTooLarge means the request body exceeds the limit for the path
+	ReasonBodyTooLarge
+	// ReasonWrongListener means the path is not served on the listener the request arrived on
+	ReasonWrongListener
+	// ReasonResolverError means a resolver failed while FailClosedOnResolverError is set
+	ReasonResolverError
+	// ReasonTooManyInFlight means the path is already serving its maximum number of concurrent requests
+	ReasonTooManyInFlight
+	// ReasonAudited means the source is not trusted by the rule for the path, but
+	// the rule is staged and not enforced on the source, see PathOptions.Staged
+	ReasonAudited
+	// ReasonPreflight means the request is a CORS preflight and AllowPreflight is set
+	ReasonPreflight
+	// ReasonWeakTLS means the request's TLS version or cipher suite is not accepted on the path
+	ReasonWeakTLS
+	// ReasonShed means the path is shed because the global request rate is above its ShedAbove
+	ReasonShed
+	// ReasonSpoofed means a request from the public internet claims a private source, see RejectSpoofedSources
+	ReasonSpoofed
+)
+
+var reasonNames = map[Reason]string{
+	ReasonTrusted:         "trusted",
+	ReasonFailOpen:        "fail_open",
+	ReasonBypass:          "bypass",
+	ReasonPathTraversal:   "path_traversal",
+	ReasonBanned:          "banned",
+	ReasonRateLimited:     "rate_limited",
+	ReasonDenied:          "denied",
+	ReasonUntrusted:       "untrusted",
+	ReasonNoRule:          "no_rule",
+	ReasonTLSRequired:     "tls_required",
+	ReasonBodyTooLarge:    "body_too_large",
+	ReasonTooManyInFlight: "too_many_in_flight",
+	ReasonWrongListener:   "wrong_listener",
+	ReasonResolverError:   "resolver_error",
+	ReasonAudited:         "audited",
+	ReasonPreflight:       "preflight",
+	ReasonWeakTLS:         "weak_tls",
+	ReasonShed:            "shed",
+	ReasonSpoofed:         "spoofed",
+}
+
+// String returns the name of a reason
+func (reason Reason) String() string {
+	if name, ok := reasonNames[reason]; ok {
+		return name
+	}
+	return fmt.Sprintf("reason(%d)", int(reason))
+}
+
+// MarshalText encodes a reason as its name, e.g. for keys of JSON objects
+func (reason Reason) MarshalText() ([]byte, error) {
+	if _, ok := reasonNames[reason]; !ok {
+		return nil, fmt.Errorf("unknown reason: %d", int(reason))
+	}
+	return []byte(reason.String()), nil
+}
+
+// UnmarshalText decodes a reason from its name
+func (reason *Reason) UnmarshalText(text []byte) error {
+	for r, name := range reasonNames {
+		if name == string(text) {
+			*reason = r
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown reason: %s", text)
+}
+
+// Allowed checks whether a reason lets the request reach the wrapped handler
+func (reason Reason) Allowed() bool {
+	return reason == ReasonTrusted || reason == ReasonFailOpen || reason == ReasonBypass || reason == ReasonAudited || reason == ReasonPreflight
+}
+
+// HTTPStatus returns the default HTTP status code for a reason
+func (reason Reason) HTTPStatus() int {
+	switch reason {
+	case ReasonTrusted, ReasonFailOpen, ReasonBypass, ReasonAudited, ReasonPreflight:
+		return http.StatusOK
+	case ReasonPathTraversal:
+		return http.StatusBadRequest
+	case ReasonBanned, ReasonRateLimited:
+		return http.StatusTooManyRequests
+	case ReasonTLSRequired, ReasonWeakTLS:
+		return http.StatusUpgradeRequired
+	case ReasonBodyTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case ReasonTooManyInFlight, ReasonShed:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusForbidden
+	}
+}
+
+// accessDenied checks whether a reason denies access to the path, as opposed to rejecting the request itself
+func (reason Reason) accessDenied() bool {
+	switch reason {
+	case ReasonDenied, ReasonUntrusted, ReasonNoRule, ReasonWrongListener, ReasonResolverError:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,67 @@
+package firewall
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestReasonHTTPStatus(t *testing.T) {
+	want := map[Reason]int{
+		ReasonTrusted:         http.StatusOK,
+		ReasonFailOpen:        http.StatusOK,
+		ReasonBypass:          http.StatusOK,
+		ReasonPathTraversal:   http.StatusBadRequest,
+		ReasonBanned:          http.StatusTooManyRequests,
+		ReasonRateLimited:     http.StatusTooManyRequests,
+		ReasonDenied:          http.StatusForbidden,
+		ReasonUntrusted:       http.StatusForbidden,
+		ReasonNoRule:          http.StatusForbidden,
+		ReasonTLSRequired:     http.StatusUpgradeRequired,
+		ReasonBodyTooLarge:    http.StatusRequestEntityTooLarge,
+		ReasonWrongListener:   http.StatusForbidden,
+		ReasonResolverError:   http.StatusForbidden,
+		ReasonTooManyInFlight: http.StatusServiceUnavailable,
+		ReasonAudited:         http.StatusOK,
+		ReasonPreflight:       http.StatusOK,
+		ReasonWeakTLS:         http.StatusUpgradeRequired,
+		ReasonShed:            http.StatusServiceUnavailable,
+		ReasonSpoofed:         http.StatusForbidden,
+	}
+	if len(want) != len(reasonNames) {
+		t.Fatalf("test covers %d reasons, there are %d", len(want), len(reasonNames))
+	}
+	for reason, status := range want {
+		if got := reason.HTTPStatus(); got != status {
+			t.Errorf("%s: got status %d, want %d", reason, got, status)
+		}
+		if allowed := status == http.StatusOK; reason.Allowed() != allowed {
+			t.Errorf("%s: got allowed=%t, want %t", reason, reason.Allowed(), allowed)
+		}
+		if d := (Decision{Allowed: reason.Allowed(), Reason: reason}); d.HTTPStatus() != status {
+			t.Errorf("decision for %s: got status %d, want %d", reason, d.HTTPStatus(), status)
+		}
+	}
+	if d := (Decision{Reason: ReasonUntrusted, Status: http.StatusNotFound}); d.HTTPStatus() != http.StatusNotFound {
+		t.Errorf("got status %d, want the decision's own status", d.HTTPStatus())
+	}
+}
+
+func TestReasonText(t *testing.T) {
+	for reason, name := range reasonNames {
+		text, err := reason.MarshalText()
+		if err != nil || string(text) != name {
+			t.Errorf("%d: got %q, %v, want %q", int(reason), text, err, name)
+		}
+		var decoded Reason
+		if err := decoded.UnmarshalText(text); err != nil || decoded != reason {
+			t.Errorf("%s: decoded %s, %v", name, decoded, err)
+		}
+	}
+	if _, err := Reason(-1).MarshalText(); err == nil {
+		t.Error("encoded an unknown reason")
+	}
+	var decoded Reason
+	if err := decoded.UnmarshalText([]byte("nope")); err == nil {
+		t.Error("decoded an unknown reason")
+	}
+}
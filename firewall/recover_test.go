@@ -0,0 +1,77 @@
+package firewall
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// servePanicking serves a request from a trusted source, returning the response and what the handler chain panicked with
+func servePanicking(h http.Handler) (w *httptest.ResponseRecorder, rec interface{}) {
+	w = httptest.NewRecorder()
+	defer func() { rec = recover() }()
+	h.ServeHTTP(w, newTestRequest(http.MethodGet, "/slow", "10.1.2.3"))
+	return w, nil
+}
+
+func TestPanicReleasesSlot(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	for _, test := range []struct {
+		name                   string
+		recoverPanics, rePanic bool
+		value                  interface{}
+		repanicked             bool
+	}{
+		{"recovered", true, false, "boom", false},
+		{"re-panicked", true, true, "boom", true},
+		{"not recovered", false, false, "boom", true},
+		{"aborted", true, false, http.ErrAbortHandler, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			buf.Reset()
+			fw := New()
+			fw.RecoverPanics = test.recoverPanics
+			fw.RePanic = test.rePanic
+			var responses []int
+			fw.OnResponse = func(d Decision, status int, bytes int64) { responses = append(responses, status) }
+			if err := fw.AddPathRuleWithOptions("/slow", []string{"10.0.0.0/8"}, PathOptions{MaxConcurrent: 1}); err != nil {
+				t.Fatal(err)
+			}
+			panicking := true
+			h := fw.Wrap(func(w http.ResponseWriter, r *http.Request) {
+				if panicking {
+					panic(test.value)
+				}
+			})
+
+			w, rec := servePanicking(h)
+			if repanicked := rec != nil; repanicked != test.repanicked {
+				t.Fatalf("got panic %v, want a panic=%t", rec, test.repanicked)
+			}
+			if rec != nil && rec != test.value {
+				t.Errorf("got panic %v, want the handler's %v", rec, test.value)
+			}
+			if !test.repanicked && w.Code != http.StatusInternalServerError {
+				t.Errorf("got status %d for a recovered panic, want 500", w.Code)
+			}
+			if logged := strings.Contains(buf.String(), "recovered from panic"); logged != !test.repanicked {
+				t.Errorf("got recovery logged=%t, want %t", logged, !test.repanicked)
+			}
+			if len(responses) != 1 {
+				t.Errorf("got %d responses reported for the panicking request, want 1", len(responses))
+			}
+
+			panicking = false
+			if w, rec := servePanicking(h); rec != nil || w.Code != http.StatusOK {
+				t.Errorf("got status %d and panic %v after a panic, want the slot released", w.Code, rec)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package firewall
+
+import (
+	"container/list"
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+/*Resolver matches source IPs against data from an external source, such as a
+* geolocation or ASN database, or reverse DNS. A path's Resolver is consulted for
+* sources which are not trusted by the path's netblocks. When it fails, the
+* firewall blocks the request if FailClosedOnResolverError is set, and otherwise
+* treats the source as not matched. Match is called without the firewall's lock
+* held, so slow lookups only delay the requests waiting on them
+ */
+type Resolver interface {
+	// Match checks whether a source IP satisfies the resolver's criteria
+	Match(ctx context.Context, ip net.IP) (bool, error)
+}
+
+// ResolverFunc adapts a function to the Resolver interface
+type ResolverFunc func(ctx context.Context, ip net.IP) (bool, error)
+
+// Match calls the function
+func (f ResolverFunc) Match(ctx context.Context, ip net.IP) (bool, error) {
+	return f(ctx, ip)
+}
+
+/*ResolverCache caches the results of resolvers for a TTL so that slow or rate
+* limited external lookups are made at most once per source IP and TTL. A single
+* cache can be shared by several resolvers, see Cache. It holds at most Size
+* results, evicting the least recently used one when full. Failed lookups are
+* not cached. With a TTL of zero results are kept until evicted or purged
+ */
+type ResolverCache struct {
+	ttl  time.Duration
+	size int
+	now  func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	hits    uint64
+	misses  uint64
+}
+
+type resolverCacheEntry struct {
+	key     string
+	matched bool
+	expires time.Time
+}
+
+// ResolverCacheStats are the hit and miss counts of a ResolverCache
+type ResolverCacheStats struct {
+	Hits    uint64
+	Misses  uint64
+	Entries int
+}
+
+// DefaultResolverCacheSize is the size of a ResolverCache created with a size of zero
+const DefaultResolverCacheSize = 10000
+
+// NewResolverCache is the constructor for a ResolverCache, size defaults to DefaultResolverCacheSize and now to time.Now
+func NewResolverCache(ttl time.Duration, size int, now func() time.Time) *ResolverCache {
+	if size <= 0 {
+		size = DefaultResolverCacheSize
+	}
+	if now == nil {
+		now = time.Now
+	}
+	return &ResolverCache{
+		ttl:     ttl,
+		size:    size,
+		now:     now,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+/*Cache returns a Resolver which answers from the cache and falls back to the given
+* resolver. The name keeps the results of resolvers sharing the cache apart, e.g.
+* "geo" and "rdns"
+ */
+func (c *ResolverCache) Cache(name string, resolver Resolver) Resolver {
+	return ResolverFunc(func(ctx context.Context, ip net.IP) (bool, error) {
+		key := name + "|" + ip.String()
+		if matched, ok := c.get(key); ok {
+			return matched, nil
+		}
+		matched, err := resolver.Match(ctx, ip)
+		if err != nil {
+			return false, err
+		}
+		c.put(key, matched)
+		return matched, nil
+	})
+}
+
+// get returns an unexpired result from the cache, counting the hit or miss
+func (c *ResolverCache) get(key string) (bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*resolverCacheEntry)
+		if c.ttl <= 0 || c.now().Before(entry.expires) {
+			c.lru.MoveToFront(elem)
+			c.hits++
+			return entry.matched, true
+		}
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+	}
+	c.misses++
+	return false, false
+}
+
+// put stores a result in the cache, evicting the least recently used ones when full
+func (c *ResolverCache) put(key string, matched bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &resolverCacheEntry{key: key, matched: matched, expires: c.now().Add(c.ttl)}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*resolverCacheEntry).key)
+	}
+}
+
+// Purge drops every cached result, e.g. after the data behind a resolver changes
+func (c *ResolverCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+}
+
+// Stats returns the cache's hit and miss counts along with its number of entries
+func (c *ResolverCache) Stats() ResolverCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return ResolverCacheStats{Hits: c.hits, Misses: c.misses, Entries: c.lru.Len()}
+}
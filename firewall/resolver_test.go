@@ -0,0 +1,100 @@
+package firewall
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestResolver(t *testing.T) {
+	errLookup := errors.New("lookup failed")
+	resolver := ResolverFunc(func(ctx context.Context, ip net.IP) (bool, error) {
+		switch ip.String() {
+		case "198.51.100.1":
+			return true, nil
+		case "198.51.100.2":
+			return false, errLookup
+		}
+		return false, nil
+	})
+	for _, failClosed := range []bool{true, false} {
+		fw := New()
+		fw.FailClosedOnResolverError = failClosed
+		if err := fw.AddPathRuleWithOptions("/geo", []string{"10.0.0.0/8"}, PathOptions{Resolver: resolver}); err != nil {
+			t.Fatal(err)
+		}
+		errorReason := ReasonUntrusted
+		if failClosed {
+			errorReason = ReasonResolverError
+		}
+		tests := []struct {
+			src    string
+			reason Reason
+		}{
+			{"10.1.2.3", ReasonTrusted},
+			{"198.51.100.1", ReasonTrusted},
+			{"198.51.100.3", ReasonUntrusted},
+			{"198.51.100.2", errorReason},
+		}
+		for _, test := range tests {
+			d := fw.Decide(newTestRequest(http.MethodGet, "/geo", test.src))
+			if d.Reason != test.reason || d.Allowed != test.reason.Allowed() {
+				t.Errorf("FailClosedOnResolverError=%t, %s: got %s, want %s", failClosed, test.src, d.Reason, test.reason)
+			}
+		}
+	}
+}
+
+func TestResolverNotConsultedForTrustedSources(t *testing.T) {
+	fw := New()
+	calls := 0
+	resolver := ResolverFunc(func(ctx context.Context, ip net.IP) (bool, error) {
+		calls++
+		return false, nil
+	})
+	if err := fw.AddPathRuleWithOptions("/geo", []string{"10.0.0.0/8"}, PathOptions{Resolver: resolver}); err != nil {
+		t.Fatal(err)
+	}
+	fw.Decide(newTestRequest(http.MethodGet, "/geo", "10.1.2.3"))
+	if calls != 0 {
+		t.Errorf("resolver called %d times for a trusted source", calls)
+	}
+}
+
+func TestSlowResolverDoesNotHoldLock(t *testing.T) {
+	fw := New()
+	release := make(chan struct{})
+	started := make(chan struct{})
+	resolver := ResolverFunc(func(ctx context.Context, ip net.IP) (bool, error) {
+		close(started)
+		<-release
+		return true, nil
+	})
+	if err := fw.AddPathRuleWithOptions("/geo", nil, PathOptions{Resolver: resolver}); err != nil {
+		t.Fatal(err)
+	}
+	decided := make(chan Decision)
+	go func() { decided <- fw.Decide(newTestRequest(http.MethodGet, "/geo", "198.51.100.1")) }()
+	<-started
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := fw.AddPathRule("/new", []string{"10.0.0.0/8"}); err != nil {
+			t.Error(err)
+		}
+		fw.Decide(newTestRequest(http.MethodGet, "/new", "10.1.2.3"))
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a slow resolver blocked rule changes and other requests")
+	}
+	close(release)
+	if d := <-decided; d.Reason != ReasonTrusted {
+		t.Errorf("got %s once the resolver matched, want trusted", d.Reason)
+	}
+}
@@ -0,0 +1,114 @@
+package firewall
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// countingResolver matches the IPs in a set, counting its lookups
+type countingResolver struct {
+	matches map[string]bool
+	err     error
+	calls   int
+}
+
+func (r *countingResolver) Match(ctx context.Context, ip net.IP) (bool, error) {
+	r.calls++
+	return r.matches[ip.String()], r.err
+}
+
+func TestResolverCacheTTL(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	cache := NewResolverCache(time.Minute, 0, func() time.Time { return now })
+	geo := &countingResolver{matches: map[string]bool{"198.51.100.1": true}}
+	fw := New()
+	if err := fw.AddPathRuleWithOptions("/geo", []string{"10.0.0.0/8"}, PathOptions{Resolver: cache.Cache("geo", geo)}); err != nil {
+		t.Fatal(err)
+	}
+	decide := func() Decision {
+		return fw.Decide(newTestRequest(http.MethodGet, "/geo", "198.51.100.1"))
+	}
+
+	if d := decide(); d.Reason != ReasonTrusted {
+		t.Fatalf("got %s, want trusted", d.Reason)
+	}
+	now = now.Add(59 * time.Second)
+	if d := decide(); d.Reason != ReasonTrusted {
+		t.Fatalf("got %s from the cache, want trusted", d.Reason)
+	}
+	if geo.calls != 1 {
+		t.Errorf("resolver called %d times within the TTL, want once", geo.calls)
+	}
+	if stats := cache.Stats(); stats.Hits != 1 || stats.Misses != 1 || stats.Entries != 1 {
+		t.Errorf("got stats %+v, want 1 hit, 1 miss and 1 entry", stats)
+	}
+
+	now = now.Add(time.Second)
+	decide()
+	if geo.calls != 2 {
+		t.Errorf("resolver called %d times once the TTL expired, want twice", geo.calls)
+	}
+	cache.Purge()
+	decide()
+	if geo.calls != 3 {
+		t.Errorf("resolver called %d times after a purge, want 3 times", geo.calls)
+	}
+}
+
+func TestResolverCacheIsShared(t *testing.T) {
+	cache := NewResolverCache(0, 0, nil)
+	geo := &countingResolver{matches: map[string]bool{"198.51.100.1": true}}
+	rdns := &countingResolver{}
+	ip := net.ParseIP("198.51.100.1")
+	for i := 0; i < 2; i++ {
+		if matched, _ := cache.Cache("geo", geo).Match(context.Background(), ip); !matched {
+			t.Error("geo resolver: got no match")
+		}
+		if matched, _ := cache.Cache("rdns", rdns).Match(context.Background(), ip); matched {
+			t.Error("rdns resolver: got the geo resolver's match")
+		}
+	}
+	if geo.calls != 1 || rdns.calls != 1 {
+		t.Errorf("got %d geo and %d rdns lookups, want one each", geo.calls, rdns.calls)
+	}
+}
+
+func TestResolverCacheIsBounded(t *testing.T) {
+	cache := NewResolverCache(0, 2, nil)
+	resolver := &countingResolver{}
+	lookup := func(ip string) {
+		cache.Cache("geo", resolver).Match(context.Background(), net.ParseIP(ip))
+	}
+	lookup("198.51.100.1")
+	lookup("198.51.100.2")
+	// 198.51.100.1 is now the most recently used, 198.51.100.2 is evicted next
+	lookup("198.51.100.1")
+	lookup("198.51.100.3")
+	if stats := cache.Stats(); stats.Entries != 2 {
+		t.Errorf("got %d entries, want at most 2", stats.Entries)
+	}
+	resolver.calls = 0
+	lookup("198.51.100.1")
+	lookup("198.51.100.2")
+	if resolver.calls != 1 {
+		t.Errorf("got %d lookups, want only the evicted 198.51.100.2 looked up again", resolver.calls)
+	}
+}
+
+func TestResolverCacheSkipsErrors(t *testing.T) {
+	cache := NewResolverCache(time.Minute, 0, nil)
+	resolver := &countingResolver{err: errors.New("lookup failed")}
+	cached := cache.Cache("geo", resolver)
+	for i := 0; i < 2; i++ {
+		if _, err := cached.Match(context.Background(), net.ParseIP("198.51.100.1")); err == nil {
+			t.Error("got no error from a failing resolver")
+		}
+	}
+	if resolver.calls != 2 {
+		t.Errorf("got %d lookups, want failures not to be cached", resolver.calls)
+	}
+}
@@ -0,0 +1,135 @@
+package firewall
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+)
+
+// responseCounter is an http.ResponseWriter which counts what is written through it
+type responseCounter interface {
+	http.ResponseWriter
+	// counts returns the response's status code and the number of body bytes written
+	counts() (int, int64)
+}
+
+/*countingWriter counts the status and body bytes written to a ResponseWriter.
+* Bytes written to hijacked connections are not counted
+ */
+type countingWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+// newCountingWriter wraps a ResponseWriter, implementing http.Flusher and http.Hijacker only when it does
+func newCountingWriter(w http.ResponseWriter) responseCounter {
+	cw := &countingWriter{ResponseWriter: w}
+	_, flusher := w.(http.Flusher)
+	_, hijacker := w.(http.Hijacker)
+	switch {
+	case flusher && hijacker:
+		return &countingFlushHijacker{cw}
+	case flusher:
+		return &countingFlusher{cw}
+	case hijacker:
+		return &countingHijacker{cw}
+	}
+	return cw
+}
+
+// WriteHeader records the first final status code written
+func (w *countingWriter) WriteHeader(status int) {
+	if w.status == 0 && status >= http.StatusOK {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write counts the bytes written
+func (w *countingWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// ReadFrom counts the bytes copied, using the wrapped writer's ReadFrom (e.g. sendfile) when it has one
+func (w *countingWriter) ReadFrom(r io.Reader) (int64, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	var n int64
+	var err error
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(r)
+	} else {
+		n, err = io.Copy(struct{ io.Writer }{w.ResponseWriter}, r)
+	}
+	w.bytes += n
+	return n, err
+}
+
+// Unwrap returns the wrapped ResponseWriter, for http.ResponseController
+func (w *countingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *countingWriter) counts() (int, int64) {
+	return w.status, w.bytes
+}
+
+type countingFlusher struct{ *countingWriter }
+
+// Flush flushes the wrapped ResponseWriter
+func (w *countingFlusher) Flush() {
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+type countingHijacker struct{ *countingWriter }
+
+// Hijack hijacks the wrapped ResponseWriter's connection
+func (w *countingHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+type countingFlushHijacker struct{ *countingWriter }
+
+// Flush flushes the wrapped ResponseWriter
+func (w *countingFlushHijacker) Flush() {
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+// Hijack hijacks the wrapped ResponseWriter's connection
+func (w *countingFlushHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+// bytesWritten returns the number of body bytes written to a ResponseWriter wrapped by Wrap, zero for others
+func bytesWritten(w http.ResponseWriter) int64 {
+	if rc, ok := w.(responseCounter); ok {
+		_, n := rc.counts()
+		return n
+	}
+	return 0
+}
+
+// responded reports a response written by Wrap to the logs and the OnResponse hook
+func (fw *Firewall) responded(r *http.Request, d Decision, w responseCounter) {
+	status, bytes := w.counts()
+	fw.requestCounts.add(d.Reason)
+	if d.Allowed {
+		fw.logAllowed(r, d, status, bytes)
+		fw.observeResponse(d, status)
+	}
+	fw.mu.RLock()
+	onResponse := fw.OnResponse
+	fw.mu.RUnlock()
+
+	if onResponse != nil {
+		onResponse(d, status, bytes)
+	}
+}
@@ -0,0 +1,113 @@
+package firewall
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestBytesWritten(t *testing.T) {
+	fw := New()
+	fw.Log = true
+	if err := fw.AddPathRule("/admin", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	type response struct {
+		status int
+		bytes  int64
+	}
+	var responses []response
+	fw.OnResponse = func(d Decision, status int, bytes int64) {
+		responses = append(responses, response{status, bytes})
+	}
+	fw.AllowedLogSampleRate = 1
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	h := fw.Wrap(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		io.WriteString(w, "hello, ")
+		// counted through ReadFrom
+		io.Copy(w, strings.NewReader("world"))
+	})
+	h.ServeHTTP(httptest.NewRecorder(), newTestRequest(http.MethodGet, "/admin", "10.1.2.3"))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newTestRequest(http.MethodGet, "/admin", "198.51.100.1"))
+
+	blocked := response{w.Code, int64(w.Body.Len())}
+	want := []response{{http.StatusAccepted, 12}, blocked}
+	if len(responses) != len(want) || responses[0] != want[0] || responses[1] != want[1] {
+		t.Errorf("got responses %v, want %v", responses, want)
+	}
+	logs := buf.String()
+	if !strings.Contains(logs, "allowed request from 10.1.2.3 for /admin: trusted, wrote 12 bytes") {
+		t.Errorf("allowed request not logged with its size: %q", logs)
+	}
+	if !strings.Contains(logs, "blocked request from 198.51.100.1 for /admin: untrusted, wrote "+
+		strconv.FormatInt(blocked.bytes, 10)+" bytes") {
+		t.Errorf("blocked request not logged with its size: %q", logs)
+	}
+}
+
+func TestCountingWriterInterfaces(t *testing.T) {
+	// httptest.ResponseRecorder is a Flusher but not a Hijacker
+	w := newCountingWriter(httptest.NewRecorder())
+	if _, ok := w.(http.Flusher); !ok {
+		t.Error("wrapped ResponseRecorder is not a Flusher")
+	}
+	if _, ok := w.(http.Hijacker); ok {
+		t.Error("wrapped ResponseRecorder is a Hijacker")
+	}
+	plain := newCountingWriter(struct{ http.ResponseWriter }{httptest.NewRecorder()})
+	if _, ok := plain.(http.Flusher); ok {
+		t.Error("wrapped ResponseWriter which isn't a Flusher is one")
+	}
+	rc := http.NewResponseController(w)
+	if err := rc.Flush(); err != nil {
+		t.Errorf("flushing through a ResponseController: %v", err)
+	}
+}
+
+func TestHijackThroughWrap(t *testing.T) {
+	fw := New()
+	fw.Rules.FailOpen = true
+	hijacked := make(chan int64, 1)
+	fw.OnResponse = func(d Decision, status int, bytes int64) { hijacked <- bytes }
+	srv := httptest.NewServer(fw.Wrap(func(w http.ResponseWriter, r *http.Request) {
+		hj, ok := w.(http.Hijacker)
+		if !ok {
+			t.Error("ResponseWriter is not a Hijacker")
+			return
+		}
+		conn, rw, err := hj.Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+		rw.Flush()
+	}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "hijacked" {
+		t.Errorf("got body %q, want hijacked", body)
+	}
+	// bytes written to hijacked connections aren't counted
+	if n := <-hijacked; n != 0 {
+		t.Errorf("counted %d bytes written to a hijacked connection, want 0", n)
+	}
+}
@@ -0,0 +1,111 @@
+package firewall
+
+import (
+	"fmt"
+	"net"
+)
+
+/*ReplaceRules atomically swaps the firewall's rule set for a copy of a new one, so
+* that the caller may keep modifying its maps and netblock lists, e.g. those of a
+* rule set returned by GetRules
+ */
+func (fw *Firewall) ReplaceRules(rules Rules) (err error) {
+	defer fw.reloadDone(&err)
+
+	rules, err = prepareRules(copyRules(rules))
+	if err != nil {
+		return err
+	}
+	denyTree := newDenyTree(rules.DeniedNetblocks)
+
+	fw.mu.Lock()
+	if err := fw.checkRuleCount(ruleCount(rules)); err != nil {
+		fw.mu.Unlock()
+		return err
+	}
+	fw.Rules = rules
+	fw.globalDenyTree.Store(denyTree)
+	fw.groupRefs = nil
+	fw.lastReload = fw.now()
+	fw.version++
+	fw.mu.Unlock()
+
+	fw.ruleChanged(RuleChangeEvent{Action: RulesReloaded})
+	return nil
+}
+
+/*GetRules returns a copy of the firewall's rule set, taken at once so that it is
+* consistent even while rules are being changed. Its maps and netblock lists are
+* the caller's to modify, options are copied shallowly
+ */
+func (fw *Firewall) GetRules() Rules {
+	fw.mu.RLock()
+	defer fw.mu.RUnlock()
+
+	return copyRules(fw.Rules)
+}
+
+/*copyRules copies a rule set's maps and lists, so that the copy can be read, e.g.
+* serialized, without holding the lock it was taken under. Netblocks themselves
+* are shared, rules only ever replace them
+ */
+func copyRules(rules Rules) Rules {
+	copied := rules
+	copied.PathToNetblocks = copyNetblockMap(rules.PathToNetblocks)
+	copied.PathToDeniedNetblocks = copyNetblockMap(rules.PathToDeniedNetblocks)
+	copied.PathToOptions = make(map[string]PathOptions, len(rules.PathToOptions))
+	for path, opts := range rules.PathToOptions {
+		copied.PathToOptions[path] = opts
+	}
+	copied.PathToGrants = make(map[string][]Grant, len(rules.PathToGrants))
+	for path, grants := range rules.PathToGrants {
+		copied.PathToGrants[path] = append([]Grant(nil), grants...)
+	}
+	if rules.DisabledPaths != nil {
+		copied.DisabledPaths = make(map[string]bool, len(rules.DisabledPaths))
+		for path, disabled := range rules.DisabledPaths {
+			copied.DisabledPaths[path] = disabled
+		}
+	}
+	if rules.MethodFailOpen != nil {
+		copied.MethodFailOpen = make(map[string]bool, len(rules.MethodFailOpen))
+		for method, open := range rules.MethodFailOpen {
+			copied.MethodFailOpen[method] = open
+		}
+	}
+	copied.DeniedNetblocks = append([]net.IPNet(nil), rules.DeniedNetblocks...)
+	copied.DefaultNetblocks = append([]net.IPNet(nil), rules.DefaultNetblocks...)
+	return copied
+}
+
+// copyNetblockMap copies a map of netblock lists along with the lists
+func copyNetblockMap(netblocks map[string][]net.IPNet) map[string][]net.IPNet {
+	copied := make(map[string][]net.IPNet, len(netblocks))
+	for path, list := range netblocks {
+		// an empty, rather than nil, list keeps a rule trusting no source
+		copied[path] = append(make([]net.IPNet, 0, len(list)), list...)
+	}
+	return copied
+}
+
+// prepareRules compiles the options of a rule set and initializes its maps
+func prepareRules(rules Rules) (Rules, error) {
+	if rules.PathToNetblocks == nil {
+		rules.PathToNetblocks = make(map[string][]net.IPNet)
+	}
+	options := make(map[string]PathOptions, len(rules.PathToOptions))
+	for path, opts := range rules.PathToOptions {
+		if err := opts.compile(); err != nil {
+			return Rules{}, fmt.Errorf("invalid options for path %s: %s", path, err)
+		}
+		options[path] = opts
+	}
+	rules.PathToOptions = options
+	if err := rules.DefaultOptions.compile(); err != nil {
+		return Rules{}, fmt.Errorf("invalid default options: %s", err)
+	}
+	if rules.PathToGrants == nil {
+		rules.PathToGrants = make(map[string][]Grant)
+	}
+	return rules, nil
+}
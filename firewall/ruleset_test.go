@@ -0,0 +1,87 @@
+package firewall
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestReplaceRulesCopiesRules(t *testing.T) {
+	fw := New()
+	if err := fw.AddPathRule("/admin", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	rules := fw.GetRules()
+	if err := fw.ReplaceRules(rules); err != nil {
+		t.Fatal(err)
+	}
+	rules.PathToNetblocks["/admin"] = append(rules.PathToNetblocks["/admin"][:0], mustParseCIDR(t, "0.0.0.0/0"))
+	rules.PathToNetblocks["/new"] = nil
+	if d := fw.Decide(newTestRequest(http.MethodGet, "/admin", "192.168.1.1")); d.Allowed {
+		t.Error("modifying the replaced rule set changed the firewall's rules")
+	}
+	if fw.HasRule("/new") {
+		t.Error("path added to the replaced rule set has a rule")
+	}
+}
+
+// TestRuleChurn changes rules while taking snapshots of them and deciding requests, run it with -race
+func TestRuleChurn(t *testing.T) {
+	fw := New()
+	if err := fw.AddPathRule("/", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	run := func(f func(i int)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				f(i)
+			}
+		}()
+	}
+	run(func(i int) {
+		path := fmt.Sprintf("/path%d", i%10)
+		if err := fw.SetPathRule(path, []string{"10.0.0.0/8"}); err != nil {
+			t.Error(err)
+		}
+		fw.RemovePathRule(path)
+	})
+	run(func(i int) {
+		path := fmt.Sprintf("/netblocks%d", i)
+		if err := fw.AddPathNetblocks(path, []net.IPNet{mustParseCIDR(t, fmt.Sprintf("172.16.%d.0/24", i%256))}); err != nil {
+			t.Error(err)
+		}
+		fw.RemovePathRule(path)
+	})
+	run(func(i int) {
+		rules := fw.GetRules()
+		rules.PathToNetblocks[fmt.Sprintf("/replaced%d", i%10)] = nil
+		if err := fw.ReplaceRules(rules); err != nil {
+			t.Error(err)
+		}
+		delete(rules.PathToNetblocks, "/")
+	})
+	run(func(i int) {
+		if i%2 == 0 {
+			fw.DisablePathRule("/")
+		} else {
+			fw.EnablePathRule("/")
+		}
+	})
+	run(func(i int) {
+		fw.Export()
+		fw.Info()
+		_ = fw.String()
+		fw.AllTrustedNetblocks()
+		fw.ExportIptables()
+	})
+	run(func(i int) {
+		fw.Decide(newTestRequest(http.MethodGet, "/", "10.1.2.3"))
+		fw.Decide(newTestRequest(http.MethodGet, fmt.Sprintf("/path%d", i%10), "192.168.1.1"))
+	})
+	wg.Wait()
+}
@@ -0,0 +1,57 @@
+package firewall
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+/*RulesHandler returns a handler serving the firewall's current rule set as a JSON
+* RulesConfig, e.g. for admin tooling. Responses carry an ETag derived from the
+* rule set's contents, so pollers sending it back in If-None-Match get a 304 until
+* the rules change. The handler exposes the rules to anyone who can reach it, wrap
+* it with the firewall to restrict it
+ */
+func (fw *Firewall) RulesHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		fw.mu.RLock()
+		rules := copyRules(fw.Rules)
+		fw.mu.RUnlock()
+
+		config := rulesConfig(rules)
+		// maps are encoded with sorted keys, so equal rule sets encode identically
+		body, err := json.Marshal(config)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		sum := sha256.Sum256(body)
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "no-cache")
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(append(body, '\n'))
+	})
+}
+
+// etagMatches checks whether an If-None-Match header lists an ETag, comparing weakly as RFC 7232 requires
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package firewall
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRulesHandler(t *testing.T) {
+	fw := New()
+	if err := fw.AddPathRule("/admin", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	h := fw.RulesHandler()
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/rules", nil)
+		if ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := get("")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200", w.Code)
+	}
+	var config RulesConfig
+	if err := json.Unmarshal(w.Body.Bytes(), &config); err != nil {
+		t.Fatal(err)
+	}
+	if got := config.Paths["/admin"].Allow; len(got) != 1 || got[0] != "10.0.0.0/8" {
+		t.Errorf("got /admin allowing %v, want [10.0.0.0/8]", got)
+	}
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("response has no ETag")
+	}
+
+	for _, ifNoneMatch := range []string{etag, "W/" + etag, `"other", ` + etag, "*"} {
+		if w := get(ifNoneMatch); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+			t.Errorf("If-None-Match %s: got status %d with %d bytes, want an empty 304", ifNoneMatch, w.Code, w.Body.Len())
+		}
+	}
+	if w := get(`"other"`); w.Code != http.StatusOK {
+		t.Errorf("got status %d for a stale ETag, want 200", w.Code)
+	}
+
+	if err := fw.AddPathRule("/internal", []string{"192.168.0.0/16"}); err != nil {
+		t.Fatal(err)
+	}
+	w = get(etag)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d after a rule change, want 200", w.Code)
+	}
+	changed := w.Header().Get("ETag")
+	if changed == etag {
+		t.Error("ETag did not change with the rules")
+	}
+	if w := get(changed); w.Code != http.StatusNotModified {
+		t.Errorf("got status %d for the new ETag, want 304", w.Code)
+	}
+
+	// reverting the change restores the original ETag, as it depends on the contents only
+	if err := fw.RemovePathRule("/internal"); err != nil {
+		t.Fatal(err)
+	}
+	if w := get(etag); w.Code != http.StatusNotModified {
+		t.Errorf("got status %d once the rules were restored, want 304", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/rules", nil))
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "GET, HEAD" {
+		t.Errorf("got status %d allowing %q for a POST, want 405 allowing GET, HEAD", w.Code, w.Header().Get("Allow"))
+	}
+}
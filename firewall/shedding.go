@@ -0,0 +1,59 @@
+package firewall
+
+import (
+	"sync"
+	"time"
+)
+
+/*rateMeter estimates the global request arrival rate over a sliding one second
+* window, weighting the previous second's count by how much of it the window
+* still covers
+ */
+type rateMeter struct {
+	mu       sync.Mutex
+	second   time.Time
+	current  int
+	previous int
+}
+
+// hit records a request at a time
+func (m *rateMeter) hit(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.advance(now)
+	m.current++
+}
+
+// rate returns the estimated number of requests per second at a time
+func (m *rateMeter) rate(now time.Time) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.advance(now)
+	elapsed := float64(now.Sub(m.second)) / float64(time.Second)
+	if elapsed < 0 {
+		// the clock went back before the current second
+		elapsed = 0
+	}
+	return float64(m.previous)*(1-elapsed) + float64(m.current)
+}
+
+// advance moves the meter's window to the second containing a time, the meter's lock must be held
+func (m *rateMeter) advance(now time.Time) {
+	second := now.Truncate(time.Second)
+	switch {
+	case second.Equal(m.second) || second.Before(m.second):
+		return
+	case second.Sub(m.second) == time.Second:
+		m.previous = m.current
+	default:
+		m.previous = 0
+	}
+	m.second, m.current = second, 0
+}
+
+// RequestRate returns the estimated number of requests per second the firewall is deciding on, see PathOptions.ShedAbove
+func (fw *Firewall) RequestRate() float64 {
+	return fw.rateMeter.rate(fw.now())
+}
@@ -0,0 +1,76 @@
+package firewall
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShedAbove(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	fw := New()
+	fw.Now = func() time.Time { return now }
+	if err := fw.AddPathRuleWithOptions("/reports", []string{"10.0.0.0/8"}, PathOptions{ShedAbove: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.AddPathRule("/checkout", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	h := fw.Wrap(func(w http.ResponseWriter, r *http.Request) {})
+	serve := func(path string) int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, newTestRequest(http.MethodGet, path, "10.1.2.3"))
+		return w.Code
+	}
+
+	// a burst of 150 requests within a second, mostly to the critical path
+	for i := 0; i < 140; i++ {
+		if status := serve("/checkout"); status != http.StatusOK {
+			t.Fatalf("critical path got status %d, want 200", status)
+		}
+		now = now.Add(time.Millisecond)
+	}
+	if rate := fw.RequestRate(); rate != 140 {
+		t.Errorf("got rate %g, want 140", rate)
+	}
+	if status := serve("/reports"); status != http.StatusServiceUnavailable {
+		t.Errorf("got status %d for a shed path above its threshold, want 503", status)
+	}
+	if d := fw.Decide(newTestRequest(http.MethodGet, "/reports", "10.1.2.3")); d.Reason != ReasonShed || d.Allowed {
+		t.Errorf("got %s for a shed path, want shed", d.Reason)
+	}
+	if status := serve("/checkout"); status != http.StatusOK {
+		t.Errorf("critical path got status %d under load, want 200", status)
+	}
+
+	// 70% into the next second, the previous second's 142 requests, as Decide isn't counted, weigh 30%
+	now = now.Truncate(time.Second).Add(1700 * time.Millisecond)
+	if rate := fw.RequestRate(); rate < 42 || rate > 43 {
+		t.Errorf("got rate %g, want about 42.9", rate)
+	}
+	if status := serve("/reports"); status != http.StatusOK {
+		t.Errorf("got status %d once the rate dropped, want 200", status)
+	}
+
+	now = now.Add(time.Minute)
+	if rate := fw.RequestRate(); rate != 0 {
+		t.Errorf("got rate %g after a quiet minute, want 0", rate)
+	}
+}
+
+func TestShedAboveFromConfig(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	fw := New()
+	fw.Now = func() time.Time { return now }
+	if err := fw.LoadRules(strings.NewReader(`{"paths": {"/reports": {"allow": ["10.0.0.0/8"], "shed_above": 1}}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if d := fw.decide(newTestRequest(http.MethodGet, "/reports", "10.1.2.3"), true); d.Reason != ReasonTrusted {
+		t.Fatalf("got %s for the first request, want trusted", d.Reason)
+	}
+	if d := fw.decide(newTestRequest(http.MethodGet, "/reports", "10.1.2.3"), true); d.Reason != ReasonShed {
+		t.Errorf("got %s above shed_above, want shed", d.Reason)
+	}
+}
@@ -0,0 +1,73 @@
+package firewall
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DefaultSignatureMaxBodyBytes bounds the bodies buffered to verify signatures on paths without a MaxBodyBytes
+const DefaultSignatureMaxBodyBytes = 1 << 20
+
+/*matchesSignature checks a request's HMAC-SHA256 signature header against the
+* options' SignatureSecret. The body is read in full to compute the HMAC and is
+* replaced with a copy, so the wrapped handler can still read it. Bodies longer than
+* MaxBodyBytes, or DefaultSignatureMaxBodyBytes, fail verification. It is called
+* without the firewall's lock held, so that slow uploads don't stall other requests
+ */
+func (opts PathOptions) matchesSignature(r *http.Request) bool {
+	if opts.SignatureHeader == "" {
+		return true
+	}
+	signature := strings.TrimSpace(r.Header.Get(opts.SignatureHeader))
+	if signature == "" {
+		return false
+	}
+	// accept the "sha256=<hex>" form used by most webhook senders
+	signature = strings.TrimPrefix(signature, "sha256=")
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	limit := opts.MaxBodyBytes
+	if limit <= 0 {
+		limit = DefaultSignatureMaxBodyBytes
+	}
+	body, err := bufferBody(r, limit)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, opts.SignatureSecret)
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+/*bufferBody reads a request's body and replaces it with one which replays what was
+* read. With a limit set, bodies longer than the limit fail to buffer
+ */
+func bufferBody(r *http.Request, limit int64) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	reader := io.Reader(r.Body)
+	if limit > 0 {
+		reader = io.LimitReader(r.Body, limit+1)
+	}
+	body, err := io.ReadAll(reader)
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && int64(len(body)) > limit {
+		return nil, errors.New("request body exceeds the limit")
+	}
+	return body, nil
+}
@@ -0,0 +1,135 @@
+package firewall
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSignatureSecret = []byte("webhook secret")
+
+// sign returns the hex encoded HMAC-SHA256 of a body keyed with testSignatureSecret
+func sign(body []byte) string {
+	mac := hmac.New(sha256.New, testSignatureSecret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newSignatureFirewall(t *testing.T, opts PathOptions) *Firewall {
+	t.Helper()
+	fw := New()
+	opts.SignatureHeader = "X-Signature"
+	opts.SignatureSecret = testSignatureSecret
+	if err := fw.AddPathRuleWithOptions("/hook", []string{"10.0.0.0/8"}, opts); err != nil {
+		t.Fatal(err)
+	}
+	return fw
+}
+
+func TestSignature(t *testing.T) {
+	fw := newSignatureFirewall(t, PathOptions{})
+	body := []byte(`{"event":"push"}`)
+
+	tests := []struct {
+		name, signature, src string
+		allowed              bool
+	}{
+		{"valid", sign(body), "10.1.2.3", true},
+		{"valid with prefix", "sha256=" + sign(body), "10.1.2.3", true},
+		{"valid from untrusted source", sign(body), "203.0.113.9", false},
+		{"invalid", sign([]byte("other body")), "10.1.2.3", false},
+		{"not hex", "not-a-signature", "10.1.2.3", false},
+		{"missing", "", "10.1.2.3", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var received []byte
+			h := fw.Wrap(func(w http.ResponseWriter, r *http.Request) {
+				received, _ = io.ReadAll(r.Body)
+			})
+			r := httptest.NewRequest(http.MethodPost, "/hook", bytes.NewReader(body))
+			r.RemoteAddr = test.src + ":1234"
+			if test.signature != "" {
+				r.Header.Set("X-Signature", test.signature)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if allowed := w.Code == http.StatusOK; allowed != test.allowed {
+				t.Fatalf("got status %d, want allowed=%t", w.Code, test.allowed)
+			}
+			if test.allowed && !bytes.Equal(received, body) {
+				t.Errorf("handler read %q, want the buffered body %q", received, body)
+			}
+		})
+	}
+}
+
+func TestSignatureBodyIsBounded(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		opts    PathOptions
+		size    int
+		allowed bool
+	}{
+		{"within default limit", PathOptions{}, DefaultSignatureMaxBodyBytes, true},
+		{"beyond default limit", PathOptions{}, DefaultSignatureMaxBodyBytes + 1, false},
+		{"beyond MaxBodyBytes", PathOptions{MaxBodyBytes: 16}, 17, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			fw := newSignatureFirewall(t, test.opts)
+			body := bytes.Repeat([]byte("a"), test.size)
+			r := httptest.NewRequest(http.MethodPost, "/hook", bytes.NewReader(body))
+			r.RemoteAddr = "10.1.2.3:1234"
+			// no Content-Length, so that only buffering can enforce the limit
+			r.ContentLength = -1
+			r.Header.Set("X-Signature", sign(body))
+			if d := fw.Decide(r); d.Allowed != test.allowed {
+				t.Errorf("body of %d bytes: got %s, want allowed=%t", test.size, d.Reason, test.allowed)
+			}
+		})
+	}
+}
+
+func TestSlowSignedBodyDoesNotHoldLock(t *testing.T) {
+	fw := newSignatureFirewall(t, PathOptions{})
+	if err := fw.AddPathRule("/other", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	body, writer := io.Pipe()
+	r := httptest.NewRequest(http.MethodPost, "/hook", body)
+	r.RemoteAddr = "10.1.2.3:1234"
+	r.Header.Set("X-Signature", sign([]byte("payload")))
+	decided := make(chan Decision)
+	go func() { decided <- fw.Decide(r) }()
+	// let the decision start reading the stalled body
+	writer.Write([]byte("pay"))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := fw.AddPathRule("/new", []string{"10.0.0.0/8"}); err != nil {
+			t.Error(err)
+		}
+		if d := fw.Decide(newTestRequest(http.MethodGet, "/other", "10.1.2.3")); !d.Allowed {
+			t.Errorf("unrelated request blocked: %s", d.Reason)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a stalled request body blocked rule changes and other requests")
+	}
+
+	io.Copy(writer, strings.NewReader("load"))
+	writer.Close()
+	if d := <-decided; !d.Allowed {
+		t.Errorf("signed request blocked once its body arrived: %s", d.Reason)
+	}
+}
@@ -0,0 +1,48 @@
+package firewall
+
+import (
+	"net"
+	"net/http"
+)
+
+// bogonNetblocks are the special purpose ranges, beyond private and loopback ones, which no client on the public internet has
+var bogonNetblocks = mustParseCIDRs(
+	"0.0.0.0/8", "100.64.0.0/10", "169.254.0.0/16", "192.0.0.0/24", "192.0.2.0/24",
+	"198.18.0.0/15", "198.51.100.0/24", "203.0.113.0/24", "224.0.0.0/3",
+	"::/128", "100::/64", "2001:db8::/32", "fe80::/10", "ff00::/8",
+)
+
+// isBogon checks whether an IP address is private, loopback or otherwise unroutable on the public internet
+func isBogon(ip net.IP) bool {
+	return ip == nil || ip.IsPrivate() || ip.IsLoopback() || IPIsTrusted(bogonNetblocks, ip)
+}
+
+/*spoofedSource checks whether a request which came from the public internet claims
+* a private or bogon source, see RejectSpoofedSources. A request came from the
+* public internet when its peer is a public address which isn't one of the
+* TrustedProxies, or when it arrived on one of the PublicListeners. It claims a
+* bogon source when its resolved client IP is one or, for untrusted peers whose
+* forwarding headers are otherwise ignored, when any forwarded hop is one. The
+* firewall's lock must be held
+ */
+func (fw *Firewall) spoofedSource(r *http.Request, client net.IP) (net.IP, bool) {
+	peer := remoteIP(r)
+	untrustedPeer := peer != nil && !isBogon(peer) && !IPIsTrusted(fw.TrustedProxies, peer)
+	if !untrustedPeer && !containsString(fw.PublicListeners, fw.ListenerName(r)) {
+		return nil, false
+	}
+	if isBogon(client) {
+		return client, true
+	}
+	if !untrustedPeer {
+		return nil, false
+	}
+	for _, chain := range [][]net.IP{ForwardedChain(r), forwardedFor(r)} {
+		for _, hop := range chain {
+			if hop != nil && isBogon(hop) {
+				return hop, true
+			}
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,95 @@
+package firewall
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRejectSpoofedSources(t *testing.T) {
+	fw := New()
+	fw.Log = true
+	fw.RejectSpoofedSources = true
+	fw.PublicListeners = []string{"443"}
+	fw.TrustedProxies = []net.IPNet{mustParseCIDR(t, "8.8.4.0/24")}
+	fw.Rules.FailOpen = true
+
+	tests := []struct {
+		name, peer   string
+		port         int
+		header, hops string
+		spoofed      bool
+	}{
+		{"public peer", "8.8.8.8", 8443, "", "", false},
+		{"public peer forwarding a public source", "8.8.8.8", 8443, "X-Forwarded-For", "1.1.1.1", false},
+		{"spoofed X-Forwarded-For from an untrusted peer", "8.8.8.8", 8443, "X-Forwarded-For", "1.1.1.1, 10.0.0.1", true},
+		{"spoofed Forwarded from an untrusted peer", "8.8.8.8", 8443, "Forwarded", "for=192.168.1.1", true},
+		{"loopback source from an untrusted peer", "8.8.8.8", 8443, "X-Forwarded-For", "127.0.0.1", true},
+		{"documentation range source from an untrusted peer", "8.8.8.8", 8443, "X-Forwarded-For", "203.0.113.9", true},
+		{"trusted proxy forwarding a private client", "8.8.4.4", 8443, "X-Forwarded-For", "10.1.2.3", false},
+		{"trusted proxy forwarding a private client to a public listener", "8.8.4.4", 443, "X-Forwarded-For", "10.1.2.3", true},
+		{"private peer on an internal listener", "10.0.0.5", 8443, "", "", false},
+		{"bogus private peer on a public listener", "10.0.0.5", 443, "", "", true},
+		{"public peer on a public listener", "8.8.8.8", 443, "", "", false},
+	}
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	h := fw.Wrap(func(w http.ResponseWriter, r *http.Request) {})
+	for _, test := range tests {
+		buf.Reset()
+		r := onPort(newTestRequest(http.MethodGet, "/", test.peer), test.port)
+		if test.header != "" {
+			r.Header.Set(test.header, test.hops)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if spoofed := w.Code == http.StatusForbidden; spoofed != test.spoofed {
+			t.Errorf("%s: got status %d, want spoofed=%t", test.name, w.Code, test.spoofed)
+		}
+		if logged := strings.Contains(buf.String(), "claiming private source"); logged != test.spoofed {
+			t.Errorf("%s: logged %q, want a rejection logged=%t", test.name, buf.String(), test.spoofed)
+		}
+	}
+
+	r := newTestRequest(http.MethodGet, "/", "8.8.8.8")
+	r.Header.Set("X-Forwarded-For", "10.0.0.1")
+	if d := fw.Decide(r); d.Reason != ReasonSpoofed || d.Allowed {
+		t.Errorf("got %s, want spoofed", d.Reason)
+	}
+	fw.RejectSpoofedSources = false
+	if d := fw.Decide(r); d.Reason != ReasonFailOpen {
+		t.Errorf("got %s with RejectSpoofedSources off, want fail_open", d.Reason)
+	}
+}
+
+func TestIsBogon(t *testing.T) {
+	for ip, bogon := range map[string]bool{
+		"10.1.2.3":     true,
+		"172.16.0.1":   true,
+		"192.168.1.1":  true,
+		"127.0.0.1":    true,
+		"100.64.0.1":   true,
+		"169.254.1.1":  true,
+		"224.0.0.1":    true,
+		"fd00::1":      true,
+		"fe80::1":      true,
+		"::1":          true,
+		"2001:db8::1":  true,
+		"8.8.8.8":      false,
+		"1.1.1.1":      false,
+		"2606:4700::1": false,
+	} {
+		if got := isBogon(net.ParseIP(ip)); got != bogon {
+			t.Errorf("%s: got bogon=%t, want %t", ip, got, bogon)
+		}
+	}
+	if !isBogon(nil) {
+		t.Error("unparsable address not treated as a bogon")
+	}
+}
@@ -0,0 +1,66 @@
+package firewall
+
+import (
+	"bytes"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestStagedRollout(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	// untrusted sources, picked by a seeded generator
+	rng := rand.New(rand.NewSource(1))
+	sources := make([]string, 2000)
+	for i := range sources {
+		sources[i] = net.IPv4(198, 51, byte(rng.Intn(256)), byte(rng.Intn(256))).String()
+	}
+	for _, test := range []struct {
+		percentage float64
+		min, max   int
+	}{
+		{0, 0, 0},
+		{100, len(sources), len(sources)},
+		{10, 150, 250},
+	} {
+		buf.Reset()
+		fw := New()
+		fw.Log = true
+		opts := PathOptions{Staged: true, EnforcePercentage: test.percentage}
+		if err := fw.AddPathRuleWithOptions("/admin", []string{"10.0.0.0/8"}, opts); err != nil {
+			t.Fatal(err)
+		}
+		enforced, audited := 0, 0
+		for _, src := range sources {
+			d := fw.Decide(newTestRequest(http.MethodGet, "/admin", src))
+			switch d.Reason {
+			case ReasonUntrusted:
+				enforced++
+			case ReasonAudited:
+				audited++
+			default:
+				t.Fatalf("%s: got %s, want untrusted or audited", src, d.Reason)
+			}
+			// selection is sticky for a source
+			if again := fw.Decide(newTestRequest(http.MethodGet, "/admin", src)); again.Reason != d.Reason {
+				t.Errorf("%s: got %s, then %s", src, d.Reason, again.Reason)
+			}
+		}
+		if enforced < test.min || enforced > test.max {
+			t.Errorf("%v%%: enforced on %d of %d sources, want %d to %d", test.percentage, enforced, len(sources), test.min, test.max)
+		}
+		if logged := strings.Count(buf.String(), "audit: staged rule for /admin would have blocked"); logged != 2*audited {
+			t.Errorf("%v%%: logged %d audits for %d audited requests", test.percentage, logged, 2*audited)
+		}
+		if d := fw.Decide(newTestRequest(http.MethodGet, "/admin", "10.1.2.3")); d.Reason != ReasonTrusted {
+			t.Errorf("%v%%: got %s for a trusted source, want trusted", test.percentage, d.Reason)
+		}
+	}
+}
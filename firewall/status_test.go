@@ -0,0 +1,67 @@
+package firewall
+
+import (
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestStatusPerReason(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	fw := New()
+	fw.Now = func() time.Time { return now }
+	fw.RateLimit = 1
+	fw.BanDuration = 90 * time.Second
+	fw.Rules.DeniedNetblocks = []net.IPNet{mustParseCIDR(t, "203.0.113.0/24")}
+	if err := fw.AddPathRule("/", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, src, retryAfter string
+		status                int
+	}{
+		{"trusted", "10.1.2.3", "", http.StatusOK},
+		{"rate limited", "10.1.2.3", "90", http.StatusTooManyRequests},
+		// 60.5 seconds left on the ban, rounded up
+		{"banned", "10.1.2.3", "61", http.StatusTooManyRequests},
+		{"untrusted", "198.51.100.1", "", http.StatusForbidden},
+		{"denied", "203.0.113.1", "", http.StatusForbidden},
+	}
+	for i, test := range tests {
+		if i == 2 {
+			now = now.Add(29*time.Second + 500*time.Millisecond)
+		}
+		w := serveBlocked(fw, newTestRequest(http.MethodGet, "/", test.src))
+		if w.Code != test.status {
+			t.Errorf("%s: got status %d, want %d", test.name, w.Code, test.status)
+		}
+		if got := w.Header().Get("Retry-After"); got != test.retryAfter {
+			t.Errorf("%s: got Retry-After %q, want %q", test.name, got, test.retryAfter)
+		}
+	}
+}
+
+func TestReasonStatusOverrides(t *testing.T) {
+	fw := New()
+	fw.RateLimit = 1
+	fw.BlockStatus = http.StatusNotFound
+	fw.ReasonStatus = map[Reason]int{ReasonRateLimited: http.StatusServiceUnavailable, ReasonUntrusted: http.StatusUnauthorized}
+	if err := fw.AddPathRule("/", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, path, src string
+		status          int
+	}{
+		{"untrusted", "/", "198.51.100.1", http.StatusUnauthorized},
+		{"no rule", "/nothing", "198.51.100.2", http.StatusNotFound},
+		{"trusted", "/", "10.1.2.3", http.StatusOK},
+		{"rate limited", "/", "10.1.2.3", http.StatusServiceUnavailable},
+	}
+	for _, test := range tests {
+		if w := serveBlocked(fw, newTestRequest(http.MethodGet, test.path, test.src)); w.Code != test.status {
+			t.Errorf("%s: got status %d, want %d", test.name, w.Code, test.status)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package firewall
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+const (
+	// summaryPaths and summaryNetblocks bound how many paths, and netblocks per
+	// list, the String methods include before eliding the rest
+	summaryPaths     = 5
+	summaryNetblocks = 3
+)
+
+/*String summarizes the rule set for logs: the number of paths, the fail-open
+* setting, the deny and default lists and the rules of the first paths in lexical
+* order. Long lists are truncated, e.g.
+*	2 paths, fail_open=false, deny=[203.0.113.0/24], /a=[10.0.0.0/8 10.1.0.0/16 10.2.0.0/16 +4 more], /b=[] (disabled)
+ */
+func (rules Rules) String() string {
+	summary := fmt.Sprintf("%d paths, fail_open=%t", len(rules.PathToNetblocks), rules.FailOpen)
+	if len(rules.DeniedNetblocks) > 0 {
+		summary += ", deny=" + summarizeNetblocks(rules.DeniedNetblocks)
+	}
+	if len(rules.DefaultNetblocks) > 0 {
+		summary += ", default=" + summarizeNetblocks(rules.DefaultNetblocks)
+	}
+	var paths []string
+	for path := range rules.PathToNetblocks {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for i, path := range paths {
+		if i == summaryPaths {
+			summary += fmt.Sprintf(", +%d more paths", len(paths)-summaryPaths)
+			break
+		}
+		summary += ", " + path + "=" + summarizeNetblocks(rules.PathToNetblocks[path])
+		if rules.DisabledPaths[path] {
+			summary += " (disabled)"
+		}
+	}
+	return summary
+}
+
+// summarizeNetblocks formats at most summaryNetblocks netblocks, followed by how many were left out
+func summarizeNetblocks(netblocks []net.IPNet) string {
+	var summary []string
+	for i, netblock := range netblocks {
+		if i == summaryNetblocks {
+			summary = append(summary, fmt.Sprintf("+%d more", len(netblocks)-summaryNetblocks))
+			break
+		}
+		summary = append(summary, netblock.String())
+	}
+	return "[" + strings.Join(summary, " ") + "]"
+}
+
+// String summarizes the firewall for logs: the settings which are enabled followed by its rules, see Rules.String
+func (fw *Firewall) String() string {
+	fw.mu.RLock()
+	rules := copyRules(fw.Rules)
+	var flags []string
+	for _, flag := range []struct {
+		name string
+		set  bool
+	}{
+		{"log", fw.Log},
+		{"block_path_traversal", fw.BlockPathTraversal},
+		{"collapse_slashes", fw.CollapseSlashes},
+		{"resolve_dot_segments", fw.ResolveDotSegments},
+		{"problem_json", fw.ProblemJSON},
+		{"require_tls", fw.RequireTLS},
+		{"trust_localhost", fw.TrustLocalhost},
+		{"trust_private_ranges", fw.TrustPrivateRanges},
+		{"fail_closed_on_resolver_error", fw.FailClosedOnResolverError},
+		{"recover_panics", fw.RecoverPanics},
+		{"reject_spoofed_sources", fw.RejectSpoofedSources},
+		{"who_am_i_reasons", fw.WhoAmIReasons},
+	} {
+		if flag.set {
+			flags = append(flags, flag.name)
+		}
+	}
+	if fw.LogFormat != LogFormatDefault {
+		flags = append(flags, "log_format="+string(fw.LogFormat))
+	}
+	if fw.RateLimit > 0 {
+		flags = append(flags, fmt.Sprintf("rate_limit=%d/%s", fw.RateLimit, fw.rateWindow()))
+	}
+	if len(fw.TrustedProxies) > 0 {
+		flags = append(flags, "trusted_proxies="+summarizeNetblocks(fw.TrustedProxies))
+	}
+	fw.mu.RUnlock()
+
+	return fmt.Sprintf("firewall{%s; %s}", strings.Join(flags, " "), rules)
+}
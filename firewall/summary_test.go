@@ -0,0 +1,55 @@
+package firewall
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestRulesString(t *testing.T) {
+	fw := New()
+	if err := fw.AddPathRule("/a", []string{"10.0.0.0/8", "10.1.0.0/16", "10.2.0.0/16", "10.3.0.0/16", "10.4.0.0/16"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.AddPathRule("/b", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.DisablePathRule("/b"); err != nil {
+		t.Fatal(err)
+	}
+	rules := fw.GetRules()
+	rules.DeniedNetblocks = []net.IPNet{mustParseCIDR(t, "203.0.113.0/24")}
+	want := "2 paths, fail_open=false, deny=[203.0.113.0/24], /a=[10.0.0.0/8 10.1.0.0/16 10.2.0.0/16 +2 more], /b=[] (disabled)"
+	if got := rules.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRulesStringTruncatesPaths(t *testing.T) {
+	fw := New()
+	for i := 0; i < 100; i++ {
+		if err := fw.AddPathRule(fmt.Sprintf("/path%03d", i), []string{"10.0.0.0/8"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := fw.GetRules().String()
+	if !strings.HasPrefix(got, "100 paths, fail_open=false, /path000=[10.0.0.0/8], ") || !strings.HasSuffix(got, "/path004=[10.0.0.0/8], +95 more paths") {
+		t.Errorf("got %q, want the first 5 of 100 paths", got)
+	}
+}
+
+func TestFirewallString(t *testing.T) {
+	fw := New()
+	fw.Log = true
+	fw.RequireTLS = true
+	fw.TrustedProxies = []net.IPNet{mustParseCIDR(t, "172.16.0.0/12")}
+	if err := fw.AddPathRule("/a", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	// New enables FailClosedOnResolverError
+	want := "firewall{log require_tls fail_closed_on_resolver_error trusted_proxies=[172.16.0.0/12]; 1 paths, fail_open=false, /a=[10.0.0.0/8]}"
+	if got := fw.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,139 @@
+package firewall
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireTLS(t *testing.T) {
+	for _, global := range []bool{false, true} {
+		fw := New()
+		fw.TrustedProxies = []net.IPNet{mustParseCIDR(t, "172.16.0.0/12")}
+		fw.RequireTLS = global
+		opts := PathOptions{RequireTLS: !global}
+		if err := fw.AddPathRuleWithOptions("/secure", []string{"10.0.0.0/8", "172.16.0.0/12"}, opts); err != nil {
+			t.Fatal(err)
+		}
+		tests := []struct {
+			name    string
+			src     string
+			tls     bool
+			proto   string
+			allowed bool
+		}{
+			{"plaintext", "10.1.2.3", false, "", false},
+			{"TLS", "10.1.2.3", true, "", true},
+			{"forwarded https from trusted proxy", "172.16.0.1", false, "https", true},
+			{"forwarded http from trusted proxy", "172.16.0.1", false, "http", false},
+			{"forwarded https from client", "10.1.2.3", false, "https", false},
+		}
+		for _, test := range tests {
+			r := newTestRequest(http.MethodGet, "/secure", test.src)
+			if test.tls {
+				r.TLS = &tls.ConnectionState{Version: tls.VersionTLS13}
+			}
+			if test.proto != "" {
+				r.Header.Set("X-Forwarded-Proto", test.proto)
+			}
+			d := fw.Decide(r)
+			if d.Allowed != test.allowed {
+				t.Errorf("%s, global=%t: got %s, want allowed=%t", test.name, global, d.Reason, test.allowed)
+			}
+			if !test.allowed && (d.Reason != ReasonTLSRequired || d.HTTPStatus() != http.StatusUpgradeRequired) {
+				t.Errorf("%s, global=%t: got %s with status %d, want tls_required with 426", test.name, global, d.Reason, d.HTTPStatus())
+			}
+		}
+	}
+}
+
+func TestTLSVersionAndCipherSuite(t *testing.T) {
+	fw := New()
+	for path, opts := range map[string]PathOptions{
+		"/modern": {MinTLSVersion: tls.VersionTLS13},
+		"/no-aes128": {
+			MinTLSVersion:          tls.VersionTLS12,
+			DisallowedCipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+		},
+	} {
+		if err := fw.AddPathRuleWithOptions(path, []string{"127.0.0.0/8"}, opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv := httptest.NewUnstartedServer(fw.Wrap(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.StartTLS()
+	defer srv.Close()
+
+	tests := []struct {
+		name, path string
+		config     *tls.Config
+		status     int
+	}{
+		{"TLS 1.3", "/modern", &tls.Config{MinVersion: tls.VersionTLS13}, http.StatusOK},
+		{"TLS 1.2 below minimum", "/modern", &tls.Config{MaxVersion: tls.VersionTLS12}, http.StatusUpgradeRequired},
+		{"allowed cipher suite", "/no-aes128", &tls.Config{
+			MaxVersion:   tls.VersionTLS12,
+			CipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384},
+		}, http.StatusOK},
+		{"disallowed cipher suite", "/no-aes128", &tls.Config{
+			MaxVersion:   tls.VersionTLS12,
+			CipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+		}, http.StatusUpgradeRequired},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := srv.Client()
+			transport := client.Transport.(*http.Transport).Clone()
+			config := test.config.Clone()
+			config.RootCAs = transport.TLSClientConfig.RootCAs
+			transport.TLSClientConfig = config
+			client.Transport = transport
+			defer transport.CloseIdleConnections()
+
+			resp, err := client.Get(srv.URL + test.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != test.status {
+				t.Errorf("got status %d, want %d", resp.StatusCode, test.status)
+			}
+		})
+	}
+
+	// TLS parameters of plaintext and forwarded requests are unknown
+	fw.TrustedProxies = []net.IPNet{mustParseCIDR(t, "127.0.0.0/8")}
+	r := newTestRequest(http.MethodGet, "/modern", "127.0.0.1")
+	if d := fw.Decide(r); d.Reason != ReasonWeakTLS {
+		t.Errorf("plaintext: got %s, want weak_tls", d.Reason)
+	}
+	r.Header.Set("X-Forwarded-Proto", "https")
+	if d := fw.Decide(r); d.Reason != ReasonWeakTLS {
+		t.Errorf("forwarded by a trusted proxy: got %s, want weak_tls", d.Reason)
+	}
+}
+
+func TestUpgradeRequiredHeaders(t *testing.T) {
+	fw := New()
+	fw.RequireTLS = true
+	if err := fw.AddPathRule("/admin", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	w := serveBlocked(fw, newTestRequest(http.MethodGet, "/admin", "10.1.2.3"))
+	if w.Code != http.StatusUpgradeRequired {
+		t.Fatalf("got status %d for a plaintext request, want 426", w.Code)
+	}
+	if upgrade, connection := w.Header().Get("Upgrade"), w.Header().Get("Connection"); upgrade != "TLS/1.2, HTTP/1.1" || connection != "Upgrade" {
+		t.Errorf("got Upgrade %q and Connection %q, want TLS/1.2, HTTP/1.1 and Upgrade", upgrade, connection)
+	}
+
+	// other block responses don't offer an upgrade
+	r := newTestRequest(http.MethodGet, "/admin", "198.51.100.1")
+	r.TLS = &tls.ConnectionState{Version: tls.VersionTLS13}
+	w = serveBlocked(fw, r)
+	if w.Code != http.StatusForbidden || w.Header().Get("Upgrade") != "" {
+		t.Errorf("got status %d with Upgrade %q for an untrusted source, want 403 without an Upgrade", w.Code, w.Header().Get("Upgrade"))
+	}
+}
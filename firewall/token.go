@@ -0,0 +1,131 @@
+package firewall
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+/*TokenVerifier verifies bearer tokens, e.g. JWTs against a key or a JWKS source,
+* and returns their claims. Verifiers must reject tokens which are not valid yet,
+* or anymore. The firewall only ships HMACTokenVerifier, verifiers for other
+* algorithms plug in through this interface. Verify is called without the
+* firewall's lock held, so it may fetch keys over the network
+ */
+type TokenVerifier interface {
+	Verify(ctx context.Context, token string) (map[string]interface{}, error)
+}
+
+// TokenVerifierFunc adapts a function to the TokenVerifier interface
+type TokenVerifierFunc func(ctx context.Context, token string) (map[string]interface{}, error)
+
+// Verify calls the function
+func (f TokenVerifierFunc) Verify(ctx context.Context, token string) (map[string]interface{}, error) {
+	return f(ctx, token)
+}
+
+/*matchesToken checks the bearer token of a request with the options' TokenVerifier
+* and, when RequiredClaim is set, that the claim holds RequiredClaimValue, see
+* claimHolds
+ */
+func (opts PathOptions) matchesToken(r *http.Request) bool {
+	if opts.TokenVerifier == nil {
+		return true
+	}
+	auth := r.Header.Get("Authorization")
+	if len(auth) < len("Bearer ") || !strings.EqualFold(auth[:len("Bearer ")], "Bearer ") {
+		return false
+	}
+	claims, err := opts.TokenVerifier.Verify(r.Context(), strings.TrimSpace(auth[len("Bearer "):]))
+	if err != nil {
+		return false
+	}
+	return opts.RequiredClaim == "" || claimHolds(claims[opts.RequiredClaim], opts.RequiredClaimValue)
+}
+
+/*claimHolds checks whether a claim holds a value: a string claim must equal it or,
+* as OAuth scopes are, be a space separated list containing it, and a list claim
+* (e.g. roles) must contain it. With an empty value the claim only needs to be present
+ */
+func claimHolds(claim interface{}, value string) bool {
+	if value == "" {
+		return claim != nil
+	}
+	switch c := claim.(type) {
+	case string:
+		return containsString(strings.Fields(c), value) || c == value
+	case []interface{}:
+		for _, item := range c {
+			if s, ok := item.(string); ok && s == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HMACTokenVerifier verifies HS256 signed JWTs with a shared secret, along with their exp and nbf claims
+type HMACTokenVerifier struct {
+	Secret []byte
+	// Leeway is the clock skew tolerated when checking exp and nbf
+	Leeway time.Duration
+	// Now returns the current time, it defaults to time.Now when nil
+	Now func() time.Time
+}
+
+// Verify verifies a JWT and returns its claims
+func (v HMACTokenVerifier) Verify(ctx context.Context, token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeTokenPart(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid token header: %s", err)
+	}
+	if header.Alg != "HS256" {
+		return nil, fmt.Errorf("unsupported token algorithm: %s", header.Alg)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid token signature: %s", err)
+	}
+	mac := hmac.New(sha256.New, v.Secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return nil, errors.New("token signature does not match")
+	}
+	var claims map[string]interface{}
+	if err := decodeTokenPart(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid token claims: %s", err)
+	}
+	now := time.Now()
+	if v.Now != nil {
+		now = v.Now()
+	}
+	if exp, ok := claims["exp"].(float64); ok && !now.Before(time.Unix(int64(exp), 0).Add(v.Leeway)) {
+		return nil, errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(v.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, errors.New("token not valid yet")
+	}
+	return claims, nil
+}
+
+// decodeTokenPart decodes a base64url encoded JSON part of a JWT
+func decodeTokenPart(part string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
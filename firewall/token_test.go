@@ -0,0 +1,134 @@
+package firewall
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testTokenSecret = []byte("token secret")
+
+// newToken returns an HS256 JWT carrying the given claims, signed with a secret
+func newToken(t *testing.T, secret []byte, claims map[string]interface{}) string {
+	t.Helper()
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestToken(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	verifier := HMACTokenVerifier{Secret: testTokenSecret, Now: func() time.Time { return now }}
+	fw := New()
+	opts := PathOptions{TokenVerifier: verifier, RequiredClaim: "scope", RequiredClaimValue: "admin:write"}
+	if err := fw.AddPathRuleWithOptions("/admin", []string{"10.0.0.0/8"}, opts); err != nil {
+		t.Fatal(err)
+	}
+	valid := map[string]interface{}{"scope": "read admin:write", "exp": now.Add(time.Hour).Unix()}
+	tests := []struct {
+		name          string
+		authorization string
+		allowed       bool
+	}{
+		{"valid", "Bearer " + newToken(t, testTokenSecret, valid), true},
+		{"lowercase scheme", "bearer " + newToken(t, testTokenSecret, valid), true},
+		{"expired", "Bearer " + newToken(t, testTokenSecret, map[string]interface{}{"scope": "admin:write", "exp": now.Add(-time.Minute).Unix()}), false},
+		{"not valid yet", "Bearer " + newToken(t, testTokenSecret, map[string]interface{}{"scope": "admin:write", "nbf": now.Add(time.Minute).Unix()}), false},
+		{"insufficient scope", "Bearer " + newToken(t, testTokenSecret, map[string]interface{}{"scope": "read admin:writer"}), false},
+		{"scope in a list", "Bearer " + newToken(t, testTokenSecret, map[string]interface{}{"scope": []string{"admin:write"}}), true},
+		{"wrong secret", "Bearer " + newToken(t, []byte("other"), valid), false},
+		{"malformed", "Bearer abc", false},
+		{"basic auth", "Basic dXNlcjpwYXNz", false},
+		{"missing", "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := newTestRequest(http.MethodGet, "/admin", "10.1.2.3")
+			if test.authorization != "" {
+				r.Header.Set("Authorization", test.authorization)
+			}
+			if d := fw.Decide(r); d.Allowed != test.allowed {
+				t.Errorf("got %s, want allowed=%t", d.Reason, test.allowed)
+			}
+		})
+	}
+	r := newTestRequest(http.MethodGet, "/admin", "192.168.1.1")
+	r.Header.Set("Authorization", "Bearer "+newToken(t, testTokenSecret, valid))
+	if d := fw.Decide(r); d.Allowed {
+		t.Error("valid token allowed from an untrusted source")
+	}
+}
+
+func TestSlowTokenVerifierDoesNotHoldLock(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	verifier := TokenVerifierFunc(func(ctx context.Context, token string) (map[string]interface{}, error) {
+		close(started)
+		<-release
+		return map[string]interface{}{}, nil
+	})
+	fw := New()
+	if err := fw.AddPathRuleWithOptions("/admin", []string{"10.0.0.0/8"}, PathOptions{TokenVerifier: verifier}); err != nil {
+		t.Fatal(err)
+	}
+	r := newTestRequest(http.MethodGet, "/admin", "10.1.2.3")
+	r.Header.Set("Authorization", "Bearer token")
+	decided := make(chan Decision)
+	go func() { decided <- fw.Decide(r) }()
+	<-started
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := fw.AddPathRule("/new", []string{"10.0.0.0/8"}); err != nil {
+			t.Error(err)
+		}
+		fw.Decide(newTestRequest(http.MethodGet, "/new", "10.1.2.3"))
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a slow token verifier blocked rule changes and other requests")
+	}
+	close(release)
+	if d := <-decided; !d.Allowed {
+		t.Errorf("got %s once the token verified, want allowed", d.Reason)
+	}
+}
+
+func TestRequiredClaimSurvivesImport(t *testing.T) {
+	verifier := HMACTokenVerifier{Secret: testTokenSecret}
+	fw := New()
+	opts := PathOptions{TokenVerifier: verifier, RequiredClaim: "scope", RequiredClaimValue: "admin:write"}
+	if err := fw.AddPathRuleWithOptions("/admin", []string{"10.0.0.0/8"}, opts); err != nil {
+		t.Fatal(err)
+	}
+	config := fw.Export()
+	if got := config.Paths["/admin"]; got.RequiredClaim != "scope" || got.RequiredClaimValue != "admin:write" {
+		t.Errorf("got required claim %q = %q, want scope = admin:write", got.RequiredClaim, got.RequiredClaimValue)
+	}
+	if err := fw.Import(config); err != nil {
+		t.Fatal(err)
+	}
+	r := newTestRequest(http.MethodGet, "/admin", "10.1.2.3")
+	r.Header.Set("Authorization", "Bearer "+newToken(t, testTokenSecret, map[string]interface{}{"scope": "read"}))
+	if d := fw.Decide(r); d.Allowed {
+		t.Error("token without the required claim allowed after an import")
+	}
+
+	err := New().LoadRules(strings.NewReader(`{"paths": {"/admin": {"allow": ["10.0.0.0/8"], "required_claim": "scope"}}}`))
+	if err == nil {
+		t.Error("loaded a required claim without a token verifier")
+	}
+}
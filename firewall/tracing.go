@@ -0,0 +1,43 @@
+package firewall
+
+import (
+	"context"
+	"strconv"
+)
+
+/*Tracer records the firewall's decisions in a tracing system. Implementations
+* typically add a span event, or a child span, to the span in the request's
+* context, using the decision's Attributes. See Firewall.Tracer
+ */
+type Tracer interface {
+	TraceDecision(ctx context.Context, d Decision)
+}
+
+// Attributes returns the decision as span attributes
+func (d Decision) Attributes() map[string]string {
+	attributes := map[string]string{
+		"firewall.allowed": strconv.FormatBool(d.Allowed),
+		"firewall.reason":  d.Reason.String(),
+		"firewall.rule":    d.Rule,
+		"firewall.path":    d.Path,
+		"firewall.src_ip":  "",
+	}
+	if d.SrcIP != nil {
+		attributes["firewall.src_ip"] = d.SrcIP.String()
+	}
+	if !d.Allowed {
+		attributes["firewall.status"] = strconv.Itoa(d.Status)
+	}
+	return attributes
+}
+
+// trace hands a decision to the firewall's Tracer, if any
+func (fw *Firewall) trace(ctx context.Context, d Decision) {
+	fw.mu.RLock()
+	tracer := fw.Tracer
+	fw.mu.RUnlock()
+
+	if tracer != nil {
+		tracer.TraceDecision(ctx, d)
+	}
+}
@@ -0,0 +1,81 @@
+package firewall
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type spanKey struct{}
+
+// fakeTracer captures the attributes of traced decisions along with the span they were recorded on
+type fakeTracer struct {
+	spans      []string
+	attributes []map[string]string
+}
+
+func (tracer *fakeTracer) TraceDecision(ctx context.Context, d Decision) {
+	span, _ := ctx.Value(spanKey{}).(string)
+	tracer.spans = append(tracer.spans, span)
+	tracer.attributes = append(tracer.attributes, d.Attributes())
+}
+
+func TestTracer(t *testing.T) {
+	tracer := &fakeTracer{}
+	fw := New()
+	fw.Tracer = tracer
+	if err := fw.AddPathRule("/admin", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	h := fw.Wrap(func(w http.ResponseWriter, r *http.Request) {})
+	for _, src := range []string{"10.1.2.3", "198.51.100.1"} {
+		r := newTestRequest(http.MethodGet, "/admin", src)
+		r = r.WithContext(context.WithValue(r.Context(), spanKey{}, "span for "+src))
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	want := []map[string]string{
+		{
+			"firewall.allowed": "true",
+			"firewall.reason":  "trusted",
+			"firewall.rule":    "/admin",
+			"firewall.path":    "/admin",
+			"firewall.src_ip":  "10.1.2.3",
+		},
+		{
+			"firewall.allowed": "false",
+			"firewall.reason":  "untrusted",
+			"firewall.rule":    "/admin",
+			"firewall.path":    "/admin",
+			"firewall.src_ip":  "198.51.100.1",
+			"firewall.status":  "403",
+		},
+	}
+	if len(tracer.attributes) != len(want) {
+		t.Fatalf("got %d traced decisions, want %d", len(tracer.attributes), len(want))
+	}
+	for i, attributes := range want {
+		got := tracer.attributes[i]
+		if len(got) != len(attributes) {
+			t.Errorf("decision %d: got attributes %v, want %v", i, got, attributes)
+		}
+		for name, value := range attributes {
+			if got[name] != value {
+				t.Errorf("decision %d: got %s=%q, want %q", i, name, got[name], value)
+			}
+		}
+	}
+	if tracer.spans[0] != "span for 10.1.2.3" || tracer.spans[1] != "span for 198.51.100.1" {
+		t.Errorf("got decisions traced on spans %q, want the requests' own", tracer.spans)
+	}
+}
+
+func TestNoTracer(t *testing.T) {
+	fw := New()
+	w := httptest.NewRecorder()
+	fw.Wrap(func(w http.ResponseWriter, r *http.Request) {}).ServeHTTP(w, newTestRequest(http.MethodGet, "/admin", "10.1.2.3"))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("got status %d without a tracer, want 403", w.Code)
+	}
+}
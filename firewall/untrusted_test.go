@@ -0,0 +1,53 @@
+package firewall
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOnUntrusted(t *testing.T) {
+	fw := New()
+	stepUp := func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://sso.example.com/login", http.StatusFound)
+	}
+	config := `{"paths": {"/admin": {"allow": ["10.0.0.0/8"], "deny": ["10.9.0.0/16"], "code_options": ["on_untrusted"]}}}`
+	// the hook is code, a config can only keep the one already set
+	if err := fw.LoadRules(strings.NewReader(config)); err == nil {
+		t.Fatal("loaded an on_untrusted option the firewall doesn't have")
+	}
+	if err := fw.AddPathRuleWithOptions("/admin", []string{"10.0.0.0/8"}, PathOptions{OnUntrusted: stepUp}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.LoadRules(strings.NewReader(config)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, path, src string
+		status          int
+	}{
+		{"trusted", "/admin", "10.1.2.3", http.StatusOK},
+		{"untrusted", "/admin", "198.51.100.1", http.StatusFound},
+		{"denied", "/admin", "10.9.1.1", http.StatusForbidden},
+		{"other path", "/other", "198.51.100.1", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reached := false
+			h := fw.Wrap(func(w http.ResponseWriter, r *http.Request) { reached = true })
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, newTestRequest(http.MethodGet, test.path, test.src))
+			if w.Code != test.status {
+				t.Errorf("got status %d, want %d", w.Code, test.status)
+			}
+			if reached != (test.status == http.StatusOK) {
+				t.Errorf("handler reached=%t with status %d", reached, w.Code)
+			}
+			if redirected := w.Header().Get("Location") != ""; redirected != (test.status == http.StatusFound) {
+				t.Errorf("got redirect=%t, want the hook to run only for untrusted sources", redirected)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package firewall
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// WhoAmI is the response of WhoAmIHandler
+type WhoAmI struct {
+	// IP is the caller's source IP as resolved by the firewall, see ClientIP
+	IP     string `json:"ip"`
+	Path   string `json:"path"`
+	Method string `json:"method"`
+	// Allowed and Reason are the firewall's decision for the caller on the path.
+	// Reason is "allowed" or "blocked" unless the firewall's WhoAmIReasons is set
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason"`
+}
+
+/*WhoAmIHandler returns a handler which tells callers their source IP and whether
+* the firewall would allow them on the path (and method, GET by default) given in
+* the query, e.g. "?path=/admin&method=POST". The decision is made with the
+* caller's own headers and is not counted towards rate limits. Only whether the
+* caller would be allowed is disclosed, not the matching rule nor, unless the
+* firewall's WhoAmIReasons is set, the reason, which would tell which paths have a
+* rule. Sources in the global deny list get a 403. Wrap the handler with the
+* firewall to restrict it further
+ */
+func (fw *Firewall) WhoAmIHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		fw.mu.RLock()
+		src := fw.clientIP(r)
+		denied := fw.globalDenied(src)
+		fw.mu.RUnlock()
+		if denied {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		path := r.URL.Query().Get("path")
+		if path == "" || path[0] != '/' {
+			http.Error(w, "query parameter path must be an absolute path", http.StatusBadRequest)
+			return
+		}
+		method := r.URL.Query().Get("method")
+		if method == "" {
+			method = http.MethodGet
+		}
+		probe := r.Clone(r.Context())
+		probe.Method = method
+		probe.URL.Path, probe.URL.RawPath, probe.URL.RawQuery = path, "", ""
+		probe.Body, probe.ContentLength = http.NoBody, 0
+		d := fw.decide(probe, false)
+		reason := "blocked"
+		if d.Allowed {
+			reason = "allowed"
+		}
+		fw.mu.RLock()
+		if fw.WhoAmIReasons {
+			reason = d.Reason.String()
+		}
+		fw.mu.RUnlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(WhoAmI{
+			IP:      src.String(),
+			Path:    d.Path,
+			Method:  method,
+			Allowed: d.Allowed,
+			Reason:  reason,
+		})
+	})
+}
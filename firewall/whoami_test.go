@@ -0,0 +1,72 @@
+package firewall
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func whoAmI(t *testing.T, fw *Firewall, target, src string) WhoAmI {
+	t.Helper()
+	w := httptest.NewRecorder()
+	fw.WhoAmIHandler().ServeHTTP(w, newTestRequest(http.MethodGet, target, src))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d for %s", w.Code, target)
+	}
+	var got WhoAmI
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestWhoAmI(t *testing.T) {
+	fw := New()
+	if err := fw.AddPathRule("/admin", []string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		target, src string
+		allowed     bool
+		reason      string
+		detailed    string
+	}{
+		{"/whoami?path=/admin", "10.1.2.3", true, "allowed", "trusted"},
+		{"/whoami?path=/admin", "198.51.100.1", false, "blocked", "untrusted"},
+		{"/whoami?path=/nothing", "198.51.100.1", false, "blocked", "no_rule"},
+		{"/whoami?path=/admin&method=POST", "10.1.2.3", true, "allowed", "trusted"},
+	}
+	for _, test := range tests {
+		got := whoAmI(t, fw, test.target, test.src)
+		if got.IP != test.src || got.Allowed != test.allowed || got.Reason != test.reason {
+			t.Errorf("%s from %s: got %+v, want allowed=%t reason=%s", test.target, test.src, got, test.allowed, test.reason)
+		}
+	}
+
+	fw.WhoAmIReasons = true
+	for _, test := range tests {
+		if got := whoAmI(t, fw, test.target, test.src); got.Reason != test.detailed {
+			t.Errorf("%s from %s with reasons: got reason %s, want %s", test.target, test.src, got.Reason, test.detailed)
+		}
+	}
+}
+
+func TestWhoAmIRejectsInvalidQueries(t *testing.T) {
+	fw := New()
+	for target, status := range map[string]int{
+		"/whoami":            http.StatusBadRequest,
+		"/whoami?path=admin": http.StatusBadRequest,
+	} {
+		w := httptest.NewRecorder()
+		fw.WhoAmIHandler().ServeHTTP(w, newTestRequest(http.MethodGet, target, "10.1.2.3"))
+		if w.Code != status {
+			t.Errorf("%s: got %d, want %d", target, w.Code, status)
+		}
+	}
+	w := httptest.NewRecorder()
+	fw.WhoAmIHandler().ServeHTTP(w, newTestRequest(http.MethodPost, "/whoami?path=/", "10.1.2.3"))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: got %d, want 405", w.Code)
+	}
+}